@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+)
+
+// AccessToken is the record of a token issued to a user, used to revoke it before it expires
+type AccessToken struct {
+	// ID the token unique identifier, also its jti claim
+	ID string `db:"id" json:"id"`
+
+	// UserID the ID of the user the token was issued to
+	UserID int `db:"user_id" json:"userId"`
+
+	// Scope the space separated scopes the token was issued for
+	Scope string `db:"scope" json:"scope"`
+
+	// IssuedAt the moment the token was issued
+	IssuedAt time.Time `db:"issued_at" json:"issuedAt"`
+
+	// ExpiresAt the moment the token expires
+	ExpiresAt time.Time `db:"expires_at" json:"expiresAt"`
+
+	// UserAgent the user agent of the client the token was issued to
+	UserAgent string `db:"user_agent" json:"userAgent"`
+
+	// IP the address of the client the token was issued to
+	IP string `db:"ip" json:"ip"`
+
+	// FamilyID the ID of the refresh token family the token was issued in, empty if none
+	FamilyID string `db:"family_id" json:"-"`
+
+	// Current whether this is the token used for the current request
+	Current bool `db:"-" json:"current"`
+}
+
+// SessionInfo describes the client a token is issued to
+type SessionInfo struct {
+	// UserAgent the client user agent
+	UserAgent string
+
+	// IP the client address
+	IP string
+
+	// FamilyID the refresh token family the token is issued in, empty if none
+	FamilyID string
+}
+
+// GenerateTokenID returns a random token identifier
+func GenerateTokenID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// NewAccessToken records a token issued to the user and purges their expired tokens
+func (u *User) NewAccessToken(ctx context.Context, store Store, id, scope string, issuedAt, expiresAt time.Time, session SessionInfo) (*AccessToken, error) {
+	t := &AccessToken{
+		ID:        id,
+		UserID:    u.ID,
+		Scope:     scope,
+		IssuedAt:  issuedAt.UTC(),
+		ExpiresAt: expiresAt.UTC(),
+		UserAgent: session.UserAgent,
+		IP:        session.IP,
+		FamilyID:  session.FamilyID,
+	}
+
+	if err := store.DeleteExpiredAccessTokens(ctx, u, t.IssuedAt); err != nil {
+		return nil, err
+	}
+
+	if err := store.InsertAccessToken(ctx, t); err != nil {
+		return nil, err
+	}
+
+	return t, nil
+}
+
+// Delete revokes the access token, along with its refresh token family if any
+func (t *AccessToken) Delete(ctx context.Context, store Store) error {
+	if t.FamilyID != "" {
+		return store.DeleteTokenFamily(ctx, t.FamilyID)
+	}
+
+	return store.DeleteAccessToken(ctx, t)
+}
+
+// InsertAccessToken records an access token
+func (store *PostgresStore) InsertAccessToken(ctx context.Context, t *AccessToken) error {
+	_, err := store.db.ExecContext(ctx, `insert into autochrone.access_tokens
+		(id, user_id, scope, issued_at, expires_at, user_agent, ip, family_id)
+		values ($1, $2, $3, $4, $5, $6, $7, $8)`, t.ID, t.UserID, t.Scope, t.IssuedAt, t.ExpiresAt, t.UserAgent, t.IP, t.FamilyID)
+	return err
+}
+
+// DeleteExpiredAccessTokens deletes the user’s access tokens expired before the given time
+func (store *PostgresStore) DeleteExpiredAccessTokens(ctx context.Context, u *User, before time.Time) error {
+	_, err := store.db.ExecContext(ctx, "delete from autochrone.access_tokens where user_id = $1 and expires_at < $2", u.ID, before.UTC())
+	return err
+}
+
+// GetAccessTokenByID returns the unexpired access token with the given ID and a potential error
+func (store *PostgresStore) GetAccessTokenByID(ctx context.Context, id string) (*AccessToken, error) {
+	t := &AccessToken{}
+	if err := store.db.GetContext(ctx, t, "select * from autochrone.access_tokens where id = $1 and expires_at >= $2", id, time.Now().UTC()); err != nil {
+		return nil, err
+	}
+
+	return t, nil
+}
+
+// GetUserAccessTokens returns the unexpired access tokens of the user, most recent first
+func (store *PostgresStore) GetUserAccessTokens(ctx context.Context, u *User) ([]*AccessToken, error) {
+	tokens := []*AccessToken{}
+	if err := store.db.SelectContext(ctx, &tokens, "select * from autochrone.access_tokens where user_id = $1 and expires_at >= $2 order by issued_at desc", u.ID, time.Now().UTC()); err != nil {
+		return nil, err
+	}
+
+	return tokens, nil
+}
+
+// DeleteAccessToken deletes the access token
+func (store *PostgresStore) DeleteAccessToken(ctx context.Context, t *AccessToken) error {
+	_, err := store.db.ExecContext(ctx, "delete from autochrone.access_tokens where id = $1", t.ID)
+	return err
+}
+
+// DeleteUserTokens deletes all access and refresh tokens of the user
+func (store *PostgresStore) DeleteUserTokens(ctx context.Context, u *User) error {
+	return store.inTx(ctx, func(tx *PostgresStore) error {
+		if _, err := tx.db.ExecContext(ctx, "delete from autochrone.access_tokens where user_id = $1", u.ID); err != nil {
+			return err
+		}
+
+		_, err := tx.db.ExecContext(ctx, "delete from autochrone.refresh_tokens where user_id = $1", u.ID)
+		return err
+	})
+}
@@ -3,43 +3,357 @@ package main
 import (
 	"github.com/gin-gonic/gin"
 
+	"log"
+	"math"
 	"net/http"
+	"strconv"
 )
 
 // AuthPOSTRequest contains authentication fields
 type AuthPOSTRequest struct {
 	Username string `json:"username"`
 	Password string `json:"password"`
+	// Scope space separated requested scopes, defaults to "basic"
+	Scope string `json:"scope"`
 }
 
 // AuthPOST replies to an authentication request with a JSON token or error message
 func AuthPOST(c *gin.Context) {
+	store := c.MustGet("store").(Store)
+	ctx := c.Request.Context()
 	// gets username and password
 	req := &AuthPOSTRequest{}
 	if err := c.BindJSON(req); err != nil {
 		return
 	}
 
-	// get user or replies to request with an error
-	user, err := GetUserByUsername(req.Username)
+	// check client and username are not locked out
+	if !checkLoginThrottle(c, req.Username) {
+		return
+	}
+
+	// get and authenticate user, upgrading their password hash if needed,
+	// or reply with the same error whether the user exists or not
+	user, err := store.GetUserByUsername(ctx, req.Username)
+	if err != nil {
+		VerifyDummyPassword(req.Password)
+	}
+	if err != nil || !user.CheckPasswordAndRehash(ctx, store, req.Password) {
+		if err := loginThrottle.Fail(ctx, store, c.ClientIP(), req.Username); err != nil {
+			log.Printf("could not record authentication failure: %v", err)
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid credentials"})
+		return
+	}
+
+	// check requested scopes
+	scopes := ParseScopes(req.Scope)
+	if len(scopes) == 0 {
+		scopes = Scopes{"basic"}
+	}
+	if !user.CanUseScopes(ctx, store, scopes) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid scope"})
+		return
+	}
+
+	// users with a second factor get a token to exchange with a code at /auth/mfa
+	hasTOTP, err := user.HasTOTP(ctx, store)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not authenticate"})
+		return
+	} else if hasTOTP {
+		mfaToken, err := user.GenerateMFAPendingToken(ctx, store, scopes, SessionInfo{UserAgent: c.Request.UserAgent(), IP: c.ClientIP()})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "could not generate token"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"mfaRequired": true, "mfaToken": mfaToken})
+		return
+	}
+
+	// failures are only forgotten once fully authenticated
+	if err := loginThrottle.Succeed(ctx, store, req.Username); err != nil {
+		log.Printf("could not reset authentication failures: %v", err)
+	}
+
+	// generate tokens in a new family, maybe reply with an error
+	tokenPair, err := user.GenerateTokenPair(ctx, store, scopes, SessionInfo{UserAgent: c.Request.UserAgent(), IP: c.ClientIP()})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not generate token"})
+		return
+	}
+
+	// OK: reply with tokens
+	c.JSON(http.StatusOK, tokenPair)
+}
+
+// AuthMFAPOSTRequest contains a "mfa_pending" token and a second factor: a TOTP code or a recovery code
+type AuthMFAPOSTRequest struct {
+	MFAToken     string `json:"mfaToken"`
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recoveryCode"`
+}
+
+// AuthMFAPOST exchanges a "mfa_pending" token and a second factor for an access token and a refresh token
+func AuthMFAPOST(c *gin.Context) {
+	store := c.MustGet("store").(Store)
+	ctx := c.Request.Context()
+	req := &AuthMFAPOSTRequest{}
+	if err := c.BindJSON(req); err != nil {
+		return
+	}
+
+	// get pending token or reply with an error
+	claims, err := ParseToken(ctx, store, req.MFAToken)
+	if err != nil || !claims.Scopes().Has("mfa_pending") {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid mfa token"})
+		return
+	}
+
+	user, err := store.GetUserByUsername(ctx, claims.Username)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid mfa token"})
 		return
 	}
 
-	// authenticates user or replies with an error
-	if !user.CheckPassword(req.Password) {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid password"})
+	// check client and username are not locked out
+	if !checkLoginThrottle(c, user.Username) {
 		return
 	}
 
-	// generate token, maybe reply with an error
-	token, err := user.GenerateToken("basic")
+	// check second factor
+	ok := (req.Code != "" && user.CheckTOTP(ctx, store, req.Code)) || (req.RecoveryCode != "" && user.UseRecoveryCode(ctx, store, req.RecoveryCode))
+	if !ok {
+		if err := loginThrottle.Fail(ctx, store, c.ClientIP(), user.Username); err != nil {
+			log.Printf("could not record authentication failure: %v", err)
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid code"})
+		return
+	}
+	if err := loginThrottle.Succeed(ctx, store, user.Username); err != nil {
+		log.Printf("could not reset authentication failures: %v", err)
+	}
+
+	// pending token can only be exchanged once
+	if pendingToken, err := store.GetAccessTokenByID(ctx, claims.Id); err == nil {
+		if err := pendingToken.Delete(ctx, store); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "could not revoke mfa token"})
+			return
+		}
+	}
+
+	// generate tokens in a new family
+	tokenPair, err := user.GenerateTokenPair(ctx, store, ParseScopes(claims.PendingScope), SessionInfo{UserAgent: c.Request.UserAgent(), IP: c.ClientIP()})
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not generate token"})
 		return
 	}
 
-	// OK: reply with token
-	c.JSON(http.StatusOK, gin.H{"token": token})
+	c.JSON(http.StatusOK, tokenPair)
+}
+
+// checkLoginThrottle replies with an error and returns false if the client or username is locked out
+func checkLoginThrottle(c *gin.Context, username string) bool {
+	store := c.MustGet("store").(Store)
+	ctx := c.Request.Context()
+	retryAfter, err := loginThrottle.Check(ctx, store, c.ClientIP(), username)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not authenticate"})
+		return false
+	} else if retryAfter > 0 {
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "too many attempts"})
+		return false
+	}
+	return true
+}
+
+// AuthRefreshPOSTRequest contains the refresh token to exchange
+type AuthRefreshPOSTRequest struct {
+	RefreshToken string `json:"refreshToken"`
+}
+
+// AuthRefreshPOST exchanges a refresh token for a new access token and a new refresh token.
+// Presenting an already exchanged refresh token revokes its whole family.
+func AuthRefreshPOST(c *gin.Context) {
+	store := c.MustGet("store").(Store)
+	ctx := c.Request.Context()
+	req := &AuthRefreshPOSTRequest{}
+	if err := c.BindJSON(req); err != nil {
+		return
+	}
+
+	// get refresh token or reply with an error
+	refreshToken, err := GetRefreshToken(ctx, store, req.RefreshToken)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid refresh token"})
+		return
+	}
+
+	// mark token as used, revoking the family on reuse
+	if err := store.UseRefreshToken(ctx, refreshToken); err == ErrRefreshTokenReused {
+		if err := store.DeleteTokenFamily(ctx, refreshToken.FamilyID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "could not revoke tokens"})
+			return
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "refresh token reuse detected"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not use refresh token"})
+		return
+	}
+
+	user, err := store.GetUserByID(ctx, refreshToken.UserID)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "user not found"})
+		return
+	}
+
+	// check scopes are still granted
+	scopes := ParseScopes(refreshToken.Scope)
+	if !user.CanUseScopes(ctx, store, scopes) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid scope"})
+		return
+	}
+
+	// generate tokens in the same family
+	tokenPair, err := user.GenerateTokenPair(ctx, store, scopes, SessionInfo{UserAgent: c.Request.UserAgent(), IP: c.ClientIP(), FamilyID: refreshToken.FamilyID})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not generate token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, tokenPair)
+}
+
+// AuthLogoutPOST revokes the token used to authenticate the request, along with its refresh token family,
+// or the personal access token used
+func AuthLogoutPOST(c *gin.Context) {
+	store := c.MustGet("store").(Store)
+	ctx := c.Request.Context()
+	principal := c.MustGet("principal").(*Principal)
+
+	if principal.PersonalAccessTokenID != 0 {
+		t, err := store.GetPersonalAccessTokenByID(ctx, principal.PersonalAccessTokenID)
+		if err != nil {
+			c.AbortWithStatus(http.StatusNotFound)
+			return
+		}
+
+		if err := store.DeletePersonalAccessToken(ctx, t); err != nil {
+			c.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+
+		c.Status(http.StatusOK)
+		return
+	}
+
+	token, err := store.GetAccessTokenByID(ctx, principal.TokenID)
+	if err != nil {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+
+	if err := token.Delete(ctx, store); err != nil {
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	c.Status(http.StatusOK)
+}
+
+// AuthForgotPasswordPOSTRequest contains the email address of the user who forgot their password
+type AuthForgotPasswordPOSTRequest struct {
+	Email string `json:"email"`
+}
+
+// AuthForgotPasswordPOST sends a password reset link to a verified email address.
+// Always replies with the same status so as not to disclose which addresses are registered.
+func AuthForgotPasswordPOST(c *gin.Context) {
+	store := c.MustGet("store").(Store)
+	ctx := c.Request.Context()
+	req := &AuthForgotPasswordPOSTRequest{}
+	if err := c.BindJSON(req); err != nil {
+		return
+	}
+
+	if user, err := store.GetUserByEmail(ctx, req.Email); err == nil {
+		if err := user.SendPasswordResetEmail(ctx, store); err != nil {
+			log.Printf("could not send password reset email to user %q: %v", user.Username, err)
+		}
+	}
+
+	c.Status(http.StatusAccepted)
+}
+
+// AuthResetPasswordPOSTRequest contains a password reset token and the new password
+type AuthResetPasswordPOSTRequest struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+	Confirm  string `json:"confirm"`
+}
+
+// AuthResetPasswordPOST sets a new password with a token received by email, revoking all of the user’s tokens
+func AuthResetPasswordPOST(c *gin.Context) {
+	store := c.MustGet("store").(Store)
+	ctx := c.Request.Context()
+	req := &AuthResetPasswordPOSTRequest{}
+	if err := c.BindJSON(req); err != nil {
+		return
+	}
+
+	if len(req.Password) < 8 || req.Confirm != req.Password {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid password"})
+		return
+	}
+
+	user, err := UseEmailToken(ctx, store, req.Token, emailTokenReset)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid token"})
+		return
+	}
+
+	if err := user.UpdatePassword(ctx, store, req.Password); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not update password"})
+		return
+	}
+
+	// other reset links are no longer needed
+	if err := store.DeleteUserEmailTokens(ctx, user, emailTokenReset); err != nil {
+		log.Printf("could not delete password reset tokens of user %q: %v", user.Username, err)
+	}
+
+	c.Status(http.StatusOK)
+}
+
+// AuthVerifyEmailPOSTRequest contains an email verification token
+type AuthVerifyEmailPOSTRequest struct {
+	Token string `json:"token"`
+}
+
+// AuthVerifyEmailPOST marks a user’s email address as verified with a token received by email
+func AuthVerifyEmailPOST(c *gin.Context) {
+	store := c.MustGet("store").(Store)
+	ctx := c.Request.Context()
+	req := &AuthVerifyEmailPOSTRequest{}
+	if err := c.BindJSON(req); err != nil {
+		return
+	}
+
+	user, err := UseEmailToken(ctx, store, req.Token, emailTokenVerify)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid token"})
+		return
+	}
+
+	if err := user.SetEmailVerified(ctx, store); err == ErrEmailTaken {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not verify email"})
+		return
+	}
+
+	c.Status(http.StatusOK)
 }
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"github.com/gin-gonic/gin"
+
+	"context"
+	"net/http"
+	"testing"
+)
+
+func TestAuth(t *testing.T) {
+	r := NewRouter(NewMemoryStore(), NewRoomHub())
+	testSignUp(t, r, "alice")
+
+	for _, tc := range []struct {
+		name     string
+		username string
+		password string
+		scope    string
+		want     int
+	}{
+		{"valid credentials", "alice", testPassword, "", http.StatusOK},
+		{"wrong password", "alice", "wrong password", "", http.StatusUnauthorized},
+		{"unknown user", "nobody", testPassword, "", http.StatusUnauthorized},
+		{"scope not granted", "alice", testPassword, "admin", http.StatusBadRequest},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			w := testRequest(r, http.MethodPost, "/auth/", "", gin.H{"username": tc.username, "password": tc.password, "scope": tc.scope})
+			if w.Code != tc.want {
+				t.Errorf("status %d, want %d", w.Code, tc.want)
+			}
+		})
+	}
+}
+
+func TestAuthTokens(t *testing.T) {
+	r := NewRouter(NewMemoryStore(), NewRoomHub())
+	testSignUp(t, r, "alice")
+	pair := testLogIn(t, r, "alice", "basic")
+
+	for _, tc := range []struct {
+		name  string
+		token string
+		want  int
+	}{
+		{"no token", "", http.StatusUnauthorized},
+		{"invalid token", "not.a.token", http.StatusUnauthorized},
+		{"access token", pair.AccessToken, http.StatusOK},
+		{"refresh token", pair.RefreshToken, http.StatusUnauthorized},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if w := testRequest(r, http.MethodGet, "/users/alice/sessions/", tc.token, nil); w.Code != tc.want {
+				t.Errorf("status %d, want %d", w.Code, tc.want)
+			}
+		})
+	}
+
+	// a token in the read scope cannot write
+	read := testLogIn(t, r, "alice", "read")
+	if w := testRequest(r, http.MethodPost, "/users/alice/projects/", read.AccessToken, gin.H{}); w.Code != http.StatusForbidden {
+		t.Errorf("write with a read token: status %d, want %d", w.Code, http.StatusForbidden)
+	}
+
+	// refresh tokens are exchanged once, reusing one revokes the family
+	w := testRequest(r, http.MethodPost, "/auth/refresh", "", gin.H{"refreshToken": pair.RefreshToken})
+	if w.Code != http.StatusOK {
+		t.Fatalf("refresh: status %d", w.Code)
+	}
+	refreshed := &TokenPair{}
+	decodeJSON(t, w, refreshed)
+	if w := testRequest(r, http.MethodGet, "/users/alice/sessions/", refreshed.AccessToken, nil); w.Code != http.StatusOK {
+		t.Errorf("refreshed access token: status %d, want %d", w.Code, http.StatusOK)
+	}
+	if w := testRequest(r, http.MethodPost, "/auth/refresh", "", gin.H{"refreshToken": pair.RefreshToken}); w.Code != http.StatusUnauthorized {
+		t.Errorf("reused refresh token: status %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+	if w := testRequest(r, http.MethodGet, "/users/alice/sessions/", refreshed.AccessToken, nil); w.Code != http.StatusUnauthorized {
+		t.Errorf("access token of a revoked family: status %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+
+	// logging out revokes the access token
+	other := testLogIn(t, r, "alice", "basic")
+	if w := testRequest(r, http.MethodPost, "/auth/logout", other.AccessToken, nil); w.Code != http.StatusOK {
+		t.Fatalf("logout: status %d", w.Code)
+	}
+	if w := testRequest(r, http.MethodGet, "/users/alice/sessions/", other.AccessToken, nil); w.Code != http.StatusUnauthorized {
+		t.Errorf("access token after logout: status %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestAuthRefreshPOSTReuse(t *testing.T) {
+	r := NewRouter(NewMemoryStore(), NewRoomHub())
+	testSignUp(t, r, "alice")
+	first := testLogIn(t, r, "alice", "basic")
+	other := testLogIn(t, r, "alice", "basic")
+
+	refresh := func(token string) (*TokenPair, int) {
+		t.Helper()
+		w := testRequest(r, http.MethodPost, "/auth/refresh", "", gin.H{"refreshToken": token})
+		pair := &TokenPair{}
+		if w.Code == http.StatusOK {
+			decodeJSON(t, w, pair)
+		}
+		return pair, w.Code
+	}
+
+	// each refresh rotates the refresh token within the family
+	second, code := refresh(first.RefreshToken)
+	if code != http.StatusOK {
+		t.Fatalf("refresh: status %d", code)
+	}
+	if second.RefreshToken == first.RefreshToken {
+		t.Error("refresh token was not rotated")
+	}
+	third, code := refresh(second.RefreshToken)
+	if code != http.StatusOK {
+		t.Fatalf("second refresh: status %d", code)
+	}
+
+	// reusing any earlier token revokes every token of the family, the latest ones too
+	if _, code := refresh(first.RefreshToken); code != http.StatusUnauthorized {
+		t.Errorf("reused refresh token: status %d, want %d", code, http.StatusUnauthorized)
+	}
+	if _, code := refresh(third.RefreshToken); code != http.StatusUnauthorized {
+		t.Errorf("latest refresh token of a revoked family: status %d, want %d", code, http.StatusUnauthorized)
+	}
+	for name, token := range map[string]string{"second": second.AccessToken, "third": third.AccessToken} {
+		if w := testRequest(r, http.MethodGet, "/users/alice/sessions/", token, nil); w.Code != http.StatusUnauthorized {
+			t.Errorf("%s access token of a revoked family: status %d, want %d", name, w.Code, http.StatusUnauthorized)
+		}
+	}
+
+	// other sessions are not affected
+	if w := testRequest(r, http.MethodGet, "/users/alice/sessions/", other.AccessToken, nil); w.Code != http.StatusOK {
+		t.Errorf("access token of another family: status %d, want %d", w.Code, http.StatusOK)
+	}
+	if _, code := refresh(other.RefreshToken); code != http.StatusOK {
+		t.Errorf("refresh token of another family: status %d, want %d", code, http.StatusOK)
+	}
+}
+
+func TestAuthPOSTRehash(t *testing.T) {
+	store := NewMemoryStore()
+	r := NewRouter(store, NewRoomHub())
+	testSignUp(t, r, "alice")
+	ctx := context.Background()
+	alice, err := store.GetUserByUsername(ctx, "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bcryptHash, err := DefaultBcryptHasher.Hash(testPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name         string
+		passwordHash string
+		passwordSalt string
+	}{
+		{"legacy", HashPassword(testPassword, "salt"), "salt"},
+		{"bcrypt", bcryptHash, ""},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			store.users[alice.ID].passwordHash = tc.passwordHash
+			store.users[alice.ID].passwordSalt = tc.passwordSalt
+
+			// a failed login keeps the hash
+			if w := testRequest(r, http.MethodPost, "/auth/", "", gin.H{"username": "alice", "password": "wrong password"}); w.Code != http.StatusUnauthorized {
+				t.Fatalf("wrong password: status %d, want %d", w.Code, http.StatusUnauthorized)
+			}
+			if passwordHash, _, _ := store.GetPasswordHash(ctx, alice); passwordHash != tc.passwordHash {
+				t.Errorf("hash changed after a failed login")
+			}
+
+			// a successful one upgrades it to the current hasher
+			testLogIn(t, r, "alice", "basic")
+			passwordHash, passwordSalt, err := store.GetPasswordHash(ctx, alice)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !passwordHasher.Handles(passwordHash) || passwordHasher.NeedsRehash(passwordHash) || passwordSalt != "" {
+				t.Errorf("hash %q with salt %q after login, want one from the current hasher", passwordHash, passwordSalt)
+			}
+			testLogIn(t, r, "alice", "basic")
+		})
+	}
+}
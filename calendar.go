@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// calendarMaxDays the largest number of days in a calendar
+const calendarMaxDays = 3660
+
+// ErrInvalidDateRange is returned when a date range ends before it starts or is too long
+var ErrInvalidDateRange = errors.New("invalid date range")
+
+// CalendarDay is a day of a project calendar, with the sprints starting on that local date
+type CalendarDay struct {
+	DateSprints
+
+	// WordCount the words written during the sprints of the day
+	WordCount int `json:"wordCount"`
+
+	// Duration the minutes spent in the sprints of the day
+	Duration int `json:"duration"`
+
+	// Target the words to write during the day to reach the goal on time, 0 outside of the project dates
+	Target int `json:"target"`
+}
+
+// LocalDate returns the date of t in loc, as midnight UTC like project dates
+func LocalDate(t time.Time, loc *time.Location) time.Time {
+	year, month, day := t.In(loc).Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+// CheckDateRange returns ErrInvalidDateRange if the range from one date to another, both included,
+// ends before it starts or spans more than calendarMaxDays days
+func CheckDateRange(from, to time.Time) error {
+	if to.Before(from) || to.Sub(from) >= calendarMaxDays*oneDay {
+		return ErrInvalidDateRange
+	}
+	return nil
+}
+
+// StartOfDay returns the first instant of the date in loc: midnight, unless a time change skips it
+func StartOfDay(date time.Time, loc *time.Location) time.Time {
+	t := time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, loc)
+	if LocalDate(t, loc).Before(date) {
+		// the skipped midnight was normalised to the previous day, the date starts with the time change
+		// at midnight by the clock in use before it
+		_, offset := t.Zone()
+		t = time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, time.FixedZone("", offset)).In(loc)
+	}
+	return t
+}
+
+// DailyTarget returns the words to write on the given date to reach the goal on time,
+// given the project’s word count at the start of the day. It is 0 outside of the project dates.
+func (p *Project) DailyTarget(date time.Time, wordCount int) int {
+	if date.Before(p.DateStart) || date.After(p.DateEnd) || wordCount >= p.WordCountGoal {
+		return 0
+	}
+
+	daysLeft := int(p.DateEnd.Sub(date)/oneDay) + 1
+	return (p.WordCountGoal - wordCount + daysLeft - 1) / daysLeft
+}
+
+// GetCalendar returns every day from one date to another, both included, with the sprints starting on that date in loc.
+// Dates are midnight UTC like project dates.
+func (p *Project) GetCalendar(ctx context.Context, store Store, loc *time.Location, from, to time.Time) ([]*CalendarDay, error) {
+	if err := CheckDateRange(from, to); err != nil {
+		return nil, err
+	}
+
+	// local starts of day bounding the sprints
+	start := StartOfDay(from, loc)
+	end := StartOfDay(to.AddDate(0, 0, 1), loc)
+
+	written, err := store.SumProjectWordCount(ctx, p, start)
+	if err != nil {
+		return nil, err
+	}
+	sprints, err := store.GetProjectSprintsBetween(ctx, p, start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	days := make([]*CalendarDay, int(to.Sub(from)/oneDay)+1)
+	for i := range days {
+		days[i] = &CalendarDay{DateSprints: DateSprints{Date: from.AddDate(0, 0, i), Sprints: []*Sprint{}}}
+	}
+	for _, s := range sprints {
+		d := days[int(LocalDate(s.TimeStart, loc).Sub(from)/oneDay)]
+		d.Sprints = append(d.Sprints, s)
+		d.WordCount += s.WordCount
+		d.Duration += s.Duration
+	}
+
+	wordCount := p.WordCountStart + written
+	for _, d := range days {
+		d.Target = p.DailyTarget(d.Date, wordCount)
+		wordCount += d.WordCount
+	}
+
+	return days, nil
+}
+
+// GetProjectSprintsBetween returns the sprints on the project starting in [from, to), earliest first
+func (store *PostgresStore) GetProjectSprintsBetween(ctx context.Context, p *Project, from, to time.Time) ([]*Sprint, error) {
+	sprints := []*Sprint{}
+	err := store.db.SelectContext(ctx, &sprints, "select * from sprints_with_details where project_id = $1 and time_start >= $2 and time_start < $3 order by time_start",
+		p.ID, from.UTC().Format("2006-01-02 15:04:05"), to.UTC().Format("2006-01-02 15:04:05"))
+	if err != nil {
+		return nil, err
+	}
+
+	return sprints, nil
+}
+
+// SumProjectWordCount returns the words written during the sprints on the project starting before the given time
+func (store *PostgresStore) SumProjectWordCount(ctx context.Context, p *Project, before time.Time) (int, error) {
+	var wordCount int
+	err := store.db.GetContext(ctx, &wordCount, "select coalesce(sum(word_count), 0) from autochrone.sprints where project_id = $1 and time_start < $2",
+		p.ID, before.UTC().Format("2006-01-02 15:04:05"))
+	return wordCount, err
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+	_ "time/tzdata"
+)
+
+func TestStartOfDay(t *testing.T) {
+	santiago, err := time.LoadLocation("America/Santiago")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for date, want := range map[string]string{
+		"2022-09-10": "2022-09-10T00:00:00-04:00",
+		// clocks went from 00:00 to 01:00
+		"2022-09-11": "2022-09-11T01:00:00-03:00",
+		"2022-09-12": "2022-09-12T00:00:00-03:00",
+	} {
+		d, _ := time.Parse("2006-01-02", date)
+		if got := StartOfDay(d, santiago).Format(time.RFC3339); got != want {
+			t.Errorf("StartOfDay(%s) = %s, want %s", date, got, want)
+		}
+	}
+}
+
+func TestGetCalendarSkippedMidnight(t *testing.T) {
+	santiago, err := time.LoadLocation("America/Santiago")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	store := NewMemoryStore()
+	date := func(s string) time.Time {
+		d, _ := time.Parse("2006-01-02", s)
+		return d
+	}
+
+	user, err := NewUser(ctx, store, "alice", testPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// projects cannot start in the past through NewProject
+	project := &Project{UserID: user.ID, Name: "Novel", Slug: "novel", DateStart: date("2022-09-01"), DateEnd: date("2022-09-30"), WordCountGoal: 30000}
+	if err := store.InsertProject(ctx, project); err != nil {
+		t.Fatal(err)
+	}
+	// the last hour of the day before midnight was skipped, and the first of the next day
+	for _, timeStart := range []string{"2022-09-10T23:30:00-04:00", "2022-09-11T01:30:00-03:00"} {
+		ts, _ := time.Parse(time.RFC3339, timeStart)
+		if _, err := project.NewSprint(ctx, store, ts, 20, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, test := range []struct {
+		from, to string
+		sprints  []int
+	}{
+		{"2022-09-10", "2022-09-10", []int{1}},
+		{"2022-09-11", "2022-09-11", []int{1}},
+		{"2022-09-10", "2022-09-11", []int{1, 1}},
+	} {
+		calendar, err := project.GetCalendar(ctx, store, santiago, date(test.from), date(test.to))
+		if err != nil {
+			t.Fatal(err)
+		}
+		sprints := []int{}
+		for _, d := range calendar {
+			sprints = append(sprints, len(d.Sprints))
+		}
+		if !equalInts(sprints, test.sprints) {
+			t.Errorf("calendar from %s to %s: sprints %v, want %v", test.from, test.to, sprints, test.sprints)
+		}
+	}
+}
@@ -0,0 +1,477 @@
+package main
+
+import (
+	"github.com/goccy/go-yaml"
+	"github.com/golang-jwt/jwt/v4"
+
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// config the configuration of the API, loaded in main
+var config = DefaultConfig()
+
+// defaultConfigPath the configuration file read if it exists and no other is given
+const defaultConfigPath = "autochrone.yaml"
+
+// Config is the configuration of the API, read from a YAML file then overridden by
+// AUTOCHRONE_* environment variables and command line flags named after the YAML keys:
+// db.max_open_conns is set by AUTOCHRONE_DB_MAX_OPEN_CONNS and -db-max-open-conns
+type Config struct {
+	// Listen the address the API listens on
+	Listen string `yaml:"listen"`
+
+	// Domain the domain the API is served on
+	Domain string `yaml:"domain"`
+
+	// FrontendURL the base URL of the frontend, for links sent by email
+	FrontendURL string `yaml:"frontend_url"`
+
+	// DB the database connection
+	DB DBConfig `yaml:"db"`
+
+	// Tokens the signing and lifetimes of tokens
+	Tokens TokensConfig `yaml:"tokens"`
+
+	// Mail the sending of emails
+	Mail MailConfig `yaml:"mail"`
+
+	// CORS the cross-origin requests allowed
+	CORS CORSConfig `yaml:"cors"`
+
+	// TLS serves the API over HTTPS if set
+	TLS TLSConfig `yaml:"tls"`
+
+	// Log the logging of requests and errors
+	Log LogConfig `yaml:"log"`
+
+	// LoginThrottle the rate limiting of authentication failures
+	LoginThrottle LoginThrottleConfig `yaml:"login_throttle"`
+
+	// TrustedProxies the addresses or CIDR ranges of the reverse proxies whose X-Forwarded-For header
+	// gives the client address, none if empty
+	TrustedProxies []string `yaml:"trusted_proxies"`
+}
+
+// DBConfig configures the database connection
+type DBConfig struct {
+	// URL the connection string of the database
+	URL string `yaml:"url"`
+
+	PoolConfig `yaml:",inline"`
+
+	// QueryTimeout the time the database queries of a request may take, 0 for no limit
+	QueryTimeout time.Duration `yaml:"query_timeout"`
+
+	// RouteQueryTimeouts overrides QueryTimeout for some routes, as "METHOD /route/:param=duration"
+	RouteQueryTimeouts []string `yaml:"route_query_timeouts"`
+}
+
+// ParseRouteQueryTimeouts returns the query timeouts by "METHOD /route/:param"
+func (cfg *DBConfig) ParseRouteQueryTimeouts() (map[string]time.Duration, error) {
+	timeouts := map[string]time.Duration{}
+	for _, entry := range cfg.RouteQueryTimeouts {
+		route, timeout, ok := strings.Cut(entry, "=")
+		method, path, _ := strings.Cut(strings.TrimSpace(route), " ")
+		if !ok || method == "" || !strings.HasPrefix(path, "/") {
+			return nil, fmt.Errorf("invalid route query timeout %q", entry)
+		}
+		d, err := time.ParseDuration(strings.TrimSpace(timeout))
+		if err != nil || d < 0 {
+			return nil, fmt.Errorf("invalid route query timeout %q", entry)
+		}
+		timeouts[strings.ToUpper(method)+" "+path] = d
+	}
+	return timeouts, nil
+}
+
+// TokensConfig configures the signing and lifetimes of tokens
+type TokensConfig struct {
+	// SigningKeysDir the directory holding the signing keys
+	SigningKeysDir string `yaml:"signing_keys_dir"`
+
+	// SigningAlgorithm the algorithm of newly generated keys: HS384, EdDSA or RS256
+	SigningAlgorithm string `yaml:"signing_algorithm"`
+
+	// KeyRotationPeriod the age after which the signing key is replaced
+	KeyRotationPeriod time.Duration `yaml:"key_rotation_period"`
+
+	// AccessTokenLifetime the lifetime of access tokens
+	AccessTokenLifetime time.Duration `yaml:"access_token_lifetime"`
+
+	// RefreshTokenLifetime the lifetime of refresh tokens
+	RefreshTokenLifetime time.Duration `yaml:"refresh_token_lifetime"`
+
+	// MFAPendingTokenLifetime the time given to provide the second factor after the password
+	MFAPendingTokenLifetime time.Duration `yaml:"mfa_pending_token_lifetime"`
+}
+
+// SignedTokenLifetime returns the longest lifetime of the tokens signed with the signing keys,
+// access and mfa_pending tokens, for which retired keys are kept
+func (cfg *TokensConfig) SignedTokenLifetime() time.Duration {
+	if cfg.MFAPendingTokenLifetime > cfg.AccessTokenLifetime {
+		return cfg.MFAPendingTokenLifetime
+	}
+	return cfg.AccessTokenLifetime
+}
+
+// MailConfig configures the sending of emails
+type MailConfig struct {
+	// From the sender address, autochrone@<domain> if empty
+	From string `yaml:"from"`
+
+	// SMTPAddr the SMTP server, host:port, emails are written to DropDir if empty
+	SMTPAddr string `yaml:"smtp_addr"`
+
+	// SMTPUsername and SMTPPassword authenticate to the SMTP server, no authentication if SMTPUsername is empty
+	SMTPUsername string `yaml:"smtp_username"`
+	SMTPPassword string `yaml:"smtp_password"`
+
+	// DropDir the directory emails are written to when there is no SMTP server
+	DropDir string `yaml:"drop_dir"`
+
+	// VerificationTokenLifetime the lifetime of email verification links
+	VerificationTokenLifetime time.Duration `yaml:"verification_token_lifetime"`
+
+	// PasswordResetTokenLifetime the lifetime of password reset links
+	PasswordResetTokenLifetime time.Duration `yaml:"password_reset_token_lifetime"`
+}
+
+// CORSConfig configures cross-origin requests
+type CORSConfig struct {
+	// AllowOrigins the origins allowed to call the API, * for any
+	AllowOrigins []string `yaml:"allow_origins"`
+}
+
+// TLSConfig configures HTTPS
+type TLSConfig struct {
+	// CertFile the PEM certificate chain, HTTPS is used if set
+	CertFile string `yaml:"cert_file"`
+
+	// KeyFile the PEM private key of the certificate
+	KeyFile string `yaml:"key_file"`
+}
+
+// LogConfig configures logging
+type LogConfig struct {
+	// Mode the gin mode: debug, release or test
+	Mode string `yaml:"mode"`
+
+	// File the file logs are appended to, standard output and error if empty
+	File string `yaml:"file"`
+}
+
+// LoginThrottleConfig configures the rate limiting of authentication failures
+type LoginThrottleConfig struct {
+	// IP the policy for client addresses, usually more lenient as addresses may be shared
+	IP LoginThrottlePolicy `yaml:"ip"`
+
+	// Username the policy for usernames, whether they exist or not
+	Username LoginThrottlePolicy `yaml:"username"`
+}
+
+// DefaultConfig returns the configuration used for anything that is not configured
+func DefaultConfig() *Config {
+	return &Config{
+		Listen:      ":8080",
+		Domain:      "localhost",
+		FrontendURL: "http://localhost:4200",
+		DB: DBConfig{
+			URL: "user=autochrone password=autochrone dbname=autochrone sslmode=disable",
+			PoolConfig: PoolConfig{
+				MaxOpenConns:    20,
+				MaxIdleConns:    10,
+				ConnMaxLifetime: 30 * time.Minute,
+				ConnMaxIdleTime: 5 * time.Minute,
+			},
+			QueryTimeout: 10 * time.Second,
+		},
+		Tokens: TokensConfig{
+			SigningKeysDir:          "./tokenSigningKeys",
+			SigningAlgorithm:        "EdDSA",
+			KeyRotationPeriod:       7 * 24 * time.Hour,
+			AccessTokenLifetime:     15 * time.Minute,
+			RefreshTokenLifetime:    30 * 24 * time.Hour,
+			MFAPendingTokenLifetime: 5 * time.Minute,
+		},
+		Mail: MailConfig{
+			DropDir:                    "./mail",
+			VerificationTokenLifetime:  48 * time.Hour,
+			PasswordResetTokenLifetime: time.Hour,
+		},
+		CORS: CORSConfig{
+			AllowOrigins: []string{"http://localhost:4200"},
+		},
+		Log: LogConfig{
+			Mode: "debug",
+		},
+		LoginThrottle: LoginThrottleConfig{
+			IP: LoginThrottlePolicy{
+				FreeAttempts: 20,
+				BaseLockout:  time.Second,
+				MaxLockout:   15 * time.Minute,
+				ResetAfter:   time.Hour,
+			},
+			Username: LoginThrottlePolicy{
+				FreeAttempts: 5,
+				BaseLockout:  time.Second,
+				MaxLockout:   time.Hour,
+				ResetAfter:   24 * time.Hour,
+			},
+		},
+	}
+}
+
+// configField is a configurable value, named after its YAML key
+type configField struct {
+	// key the dotted YAML key, db.max_open_conns
+	key string
+
+	// value the field in the configuration
+	value reflect.Value
+}
+
+// flagName returns the command line flag setting the field, db-max-open-conns
+func (f configField) flagName() string {
+	return strings.NewReplacer(".", "-", "_", "-").Replace(f.key)
+}
+
+// envName returns the environment variable setting the field, AUTOCHRONE_DB_MAX_OPEN_CONNS
+func (f configField) envName() string {
+	return "AUTOCHRONE_" + strings.ToUpper(strings.ReplaceAll(f.key, ".", "_"))
+}
+
+// set parses s into the field: comma separated lists, Go durations, numbers or booleans
+func (f configField) set(s string) error {
+	switch {
+	case f.value.Type() == reflect.TypeOf(time.Duration(0)):
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		f.value.SetInt(int64(d))
+	case f.value.Kind() == reflect.Int:
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			return err
+		}
+		f.value.SetInt(int64(n))
+	case f.value.Kind() == reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		f.value.SetBool(b)
+	case f.value.Kind() == reflect.Slice:
+		list := []string{}
+		for _, item := range strings.Split(s, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+		f.value.Set(reflect.ValueOf(list))
+	default:
+		f.value.SetString(s)
+	}
+	return nil
+}
+
+// fields returns all configurable values of cfg
+func (cfg *Config) fields() []configField {
+	return appendConfigFields(nil, "", reflect.ValueOf(cfg).Elem())
+}
+
+// appendConfigFields appends the fields of the struct v, and of its nested structs, prefixing their keys
+func appendConfigFields(fields []configField, prefix string, v reflect.Value) []configField {
+	for i := 0; i < v.NumField(); i++ {
+		name, opts, _ := strings.Cut(v.Type().Field(i).Tag.Get("yaml"), ",")
+		field := v.Field(i)
+
+		if opts == "inline" {
+			fields = appendConfigFields(fields, prefix, field)
+		} else if field.Kind() == reflect.Struct {
+			fields = appendConfigFields(fields, prefix+name+".", field)
+		} else {
+			fields = append(fields, configField{key: prefix + name, value: field})
+		}
+	}
+	return fields
+}
+
+// configFlag sets a configuration field once the file and environment are read
+type configFlag struct {
+	field configField
+	value *string
+}
+
+// String returns the value given on the command line
+func (f configFlag) String() string {
+	if f.value == nil {
+		return ""
+	}
+	return *f.value
+}
+
+// Set records the value given on the command line
+func (f configFlag) Set(s string) error {
+	*f.value = s
+	return nil
+}
+
+// LoadConfig parses the command line arguments and returns the validated configuration,
+// along with the arguments left after the flags
+func LoadConfig(args []string) (*Config, []string, error) {
+	cfg := DefaultConfig()
+	fields := cfg.fields()
+
+	// flags are parsed first to find the configuration file, but applied last
+	flags := flag.NewFlagSet("autochrone-api", flag.ContinueOnError)
+	configPath := flags.String("config", os.Getenv("AUTOCHRONE_CONFIG"), "configuration file, "+defaultConfigPath+" if it exists")
+	values := make([]*string, len(fields))
+	for i, f := range fields {
+		values[i] = new(string)
+		flags.Var(configFlag{field: f, value: values[i]}, f.flagName(), "sets "+f.key+", overrides "+f.envName())
+	}
+	if err := flags.Parse(args); err != nil {
+		return nil, nil, err
+	}
+	setFlags := map[string]bool{}
+	flags.Visit(func(fl *flag.Flag) { setFlags[fl.Name] = true })
+
+	// configuration file
+	path := *configPath
+	if path == "" {
+		if _, err := os.Stat(defaultConfigPath); err == nil {
+			path = defaultConfigPath
+		}
+	}
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := yaml.UnmarshalWithOptions(data, cfg, yaml.DisallowUnknownField()); err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+
+	// environment, then flags
+	for _, f := range fields {
+		if s, ok := os.LookupEnv(f.envName()); ok {
+			if err := f.set(s); err != nil {
+				return nil, nil, fmt.Errorf("%s: %w", f.envName(), err)
+			}
+		}
+	}
+	for i, f := range fields {
+		if setFlags[f.flagName()] {
+			if err := f.set(*values[i]); err != nil {
+				return nil, nil, fmt.Errorf("-%s: %w", f.flagName(), err)
+			}
+		}
+	}
+
+	if cfg.Mail.From == "" {
+		cfg.Mail.From = "autochrone@" + cfg.Domain
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, nil, err
+	}
+	return cfg, flags.Args(), nil
+}
+
+// Validate returns all the problems of the configuration, nil if there is none
+func (cfg *Config) Validate() error {
+	errs := []error{}
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Errorf("config: "+format, args...))
+		}
+	}
+
+	_, _, err := net.SplitHostPort(cfg.Listen)
+	check(err == nil, "listen: invalid address %q", cfg.Listen)
+	check(cfg.Domain != "", "domain: required")
+	check(validHTTPURL(cfg.FrontendURL), "frontend_url: invalid URL %q", cfg.FrontendURL)
+
+	check(cfg.DB.URL != "", "db.url: required")
+	check(cfg.DB.MaxOpenConns >= 0, "db.max_open_conns: must not be negative")
+	check(cfg.DB.MaxIdleConns >= 0, "db.max_idle_conns: must not be negative")
+	check(cfg.DB.MaxOpenConns == 0 || cfg.DB.MaxIdleConns <= cfg.DB.MaxOpenConns, "db.max_idle_conns: must not exceed db.max_open_conns")
+	check(cfg.DB.ConnMaxLifetime >= 0, "db.conn_max_lifetime: must not be negative")
+	check(cfg.DB.ConnMaxIdleTime >= 0, "db.conn_max_idle_time: must not be negative")
+	check(cfg.DB.QueryTimeout >= 0, "db.query_timeout: must not be negative")
+	_, err = cfg.DB.ParseRouteQueryTimeouts()
+	check(err == nil, "db.route_query_timeouts: %v", err)
+
+	check(cfg.Tokens.SigningKeysDir != "", "tokens.signing_keys_dir: required")
+	switch jwt.GetSigningMethod(cfg.Tokens.SigningAlgorithm) {
+	case jwt.SigningMethodHS384, jwt.SigningMethodEdDSA, jwt.SigningMethodRS256:
+	default:
+		check(false, "tokens.signing_algorithm: must be HS384, EdDSA or RS256")
+	}
+	check(cfg.Tokens.KeyRotationPeriod > 0, "tokens.key_rotation_period: must be positive")
+	check(cfg.Tokens.AccessTokenLifetime > 0, "tokens.access_token_lifetime: must be positive")
+	check(cfg.Tokens.RefreshTokenLifetime > cfg.Tokens.AccessTokenLifetime, "tokens.refresh_token_lifetime: must exceed tokens.access_token_lifetime")
+	check(cfg.Tokens.MFAPendingTokenLifetime > 0, "tokens.mfa_pending_token_lifetime: must be positive")
+
+	check(ValidEmail(cfg.Mail.From), "mail.from: invalid email %q", cfg.Mail.From)
+	if cfg.Mail.SMTPAddr != "" {
+		_, _, err := net.SplitHostPort(cfg.Mail.SMTPAddr)
+		check(err == nil, "mail.smtp_addr: invalid address %q", cfg.Mail.SMTPAddr)
+	} else {
+		check(cfg.Mail.DropDir != "", "mail.drop_dir: required without mail.smtp_addr")
+	}
+	check(cfg.Mail.VerificationTokenLifetime > 0, "mail.verification_token_lifetime: must be positive")
+	check(cfg.Mail.PasswordResetTokenLifetime > 0, "mail.password_reset_token_lifetime: must be positive")
+
+	check(len(cfg.CORS.AllowOrigins) > 0, "cors.allow_origins: required")
+	for _, origin := range cfg.CORS.AllowOrigins {
+		check(origin == "*" || validHTTPURL(origin), "cors.allow_origins: invalid origin %q", origin)
+	}
+
+	check((cfg.TLS.CertFile == "") == (cfg.TLS.KeyFile == ""), "tls: cert_file and key_file go together")
+	for _, file := range []string{cfg.TLS.CertFile, cfg.TLS.KeyFile} {
+		if file != "" {
+			_, err := os.Stat(file)
+			check(err == nil, "tls: %v", err)
+		}
+	}
+
+	switch cfg.Log.Mode {
+	case "debug", "release", "test":
+	default:
+		check(false, "log.mode: must be debug, release or test")
+	}
+
+	checkThrottlePolicy := func(key string, policy LoginThrottlePolicy) {
+		check(policy.FreeAttempts >= 0, "%s.free_attempts: must not be negative", key)
+		check(policy.BaseLockout > 0, "%s.base_lockout: must be positive", key)
+		check(policy.MaxLockout >= policy.BaseLockout, "%s.max_lockout: must not be less than base_lockout", key)
+		check(policy.ResetAfter > 0, "%s.reset_after: must be positive", key)
+	}
+	checkThrottlePolicy("login_throttle.ip", cfg.LoginThrottle.IP)
+	checkThrottlePolicy("login_throttle.username", cfg.LoginThrottle.Username)
+
+	for _, proxy := range cfg.TrustedProxies {
+		_, _, err := net.ParseCIDR(proxy)
+		check(err == nil || net.ParseIP(proxy) != nil, "trusted_proxies: invalid address %q", proxy)
+	}
+
+	return errors.Join(errs...)
+}
+
+// validHTTPURL returns true if s is an absolute http or https URL
+func validHTTPURL(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
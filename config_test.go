@@ -0,0 +1,58 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLoadConfigLoginThrottle(t *testing.T) {
+	t.Setenv("AUTOCHRONE_LOGIN_THROTTLE_IP_FREE_ATTEMPTS", "50")
+	t.Setenv("AUTOCHRONE_TRUSTED_PROXIES", "10.0.0.1, 192.168.0.0/16")
+
+	cfg, _, err := LoadConfig([]string{"-login-throttle-username-max-lockout", "2h"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.LoginThrottle.IP.FreeAttempts != 50 {
+		t.Errorf("login_throttle.ip.free_attempts = %d, want 50", cfg.LoginThrottle.IP.FreeAttempts)
+	}
+	if cfg.LoginThrottle.Username.MaxLockout != 2*time.Hour {
+		t.Errorf("login_throttle.username.max_lockout = %v, want 2h", cfg.LoginThrottle.Username.MaxLockout)
+	}
+	if len(cfg.TrustedProxies) != 2 || cfg.TrustedProxies[1] != "192.168.0.0/16" {
+		t.Errorf("trusted_proxies = %q", cfg.TrustedProxies)
+	}
+
+	if _, _, err := LoadConfig([]string{"-trusted-proxies", "proxy.example"}); err == nil {
+		t.Error("LoadConfig accepted an invalid trusted proxy")
+	}
+	if _, _, err := LoadConfig([]string{"-login-throttle-ip-max-lockout", "0s"}); err == nil {
+		t.Error("LoadConfig accepted a maximum lockout shorter than the base lockout")
+	}
+}
+
+func TestLoadConfigPool(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "autochrone.yaml")
+	if err := os.WriteFile(path, []byte("db:\n  max_open_conns: 40\n  max_idle_conns: 30\n  conn_max_lifetime: 1h\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("AUTOCHRONE_DB_MAX_IDLE_CONNS", "5")
+
+	cfg, _, err := LoadConfig([]string{"-config", path, "-db-conn-max-idle-time", "1m"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := PoolConfig{MaxOpenConns: 40, MaxIdleConns: 5, ConnMaxLifetime: time.Hour, ConnMaxIdleTime: time.Minute}
+	if cfg.DB.PoolConfig != want {
+		t.Errorf("db pool %+v, want %+v", cfg.DB.PoolConfig, want)
+	}
+
+	if _, _, err := LoadConfig([]string{"-db-max-open-conns", "5", "-db-max-idle-conns", "10"}); err == nil {
+		t.Error("LoadConfig accepted more idle connections than open ones")
+	}
+	if _, _, err := LoadConfig([]string{"-db-conn-max-lifetime", "-1s"}); err == nil {
+		t.Error("LoadConfig accepted a negative connection lifetime")
+	}
+}
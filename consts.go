@@ -1,7 +0,0 @@
-package main
-
-const (
-	connStr                 string = "user=autochrone password=autochrone dbname=autochrone sslmode=disable"
-	domain                  string = "192.168.0.42"
-	tokenSigningKeyFilePath string = "./tokenSigningKey"
-)
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+)
+
+// Email token purposes
+const (
+	emailTokenVerify = "verify"
+	emailTokenReset  = "reset"
+)
+
+// hashEmailToken returns the identifier under which an email token is stored
+func hashEmailToken(token string) string {
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(token)))
+}
+
+// EmailToken is a single-use token sent by email, bound to the address it was sent to.
+// Only its hash is stored.
+type EmailToken struct {
+	// ID the sha256 hash of the token
+	ID string `db:"id"`
+
+	// UserID the ID of the user the token was sent to
+	UserID int `db:"user_id"`
+
+	// Purpose what the token may be used for, emailTokenVerify or emailTokenReset
+	Purpose string `db:"purpose"`
+
+	// Email the address the token was sent to
+	Email string `db:"email"`
+
+	// ExpiresAt the moment the token expires
+	ExpiresAt time.Time `db:"expires_at"`
+}
+
+// ErrEmailTaken is returned when an email address is already used by another user
+var ErrEmailTaken = errors.New("email address already in use")
+
+// UpdateEmail sets a new unverified email address for the user and invalidates previous verification tokens.
+// Returns ErrEmailTaken if another user verified the address.
+func (u *User) UpdateEmail(ctx context.Context, store Store, email string) error {
+	if email != "" && !ValidEmail(email) {
+		return errors.New("UpdateEmail: invalid email")
+	}
+
+	err := store.Transaction(ctx, func(tx Store) error {
+		if email != "" {
+			if other, err := tx.GetUserByEmail(ctx, email); err == nil && other.ID != u.ID {
+				return ErrEmailTaken
+			} else if err != nil && err != sql.ErrNoRows {
+				return err
+			}
+		}
+		if err := tx.UpdateUserEmail(ctx, u, email); err != nil {
+			return err
+		}
+
+		return tx.DeleteUserEmailTokens(ctx, u, emailTokenVerify)
+	})
+	if err != nil {
+		return err
+	}
+
+	u.Email = email
+	u.EmailVerified = false
+	return nil
+}
+
+// NewEmailToken generates a token for the given purpose, bound to the user’s current email address
+func (u *User) NewEmailToken(ctx context.Context, store Store, purpose string, lifetime time.Duration) (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(b)
+
+	err := store.InsertEmailToken(ctx, &EmailToken{
+		ID:        hashEmailToken(token),
+		UserID:    u.ID,
+		Purpose:   purpose,
+		Email:     u.Email,
+		ExpiresAt: time.Now().UTC().Add(lifetime),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// UseEmailToken deletes an unexpired email token for the given purpose and returns its user,
+// as long as their email address did not change since it was sent
+func UseEmailToken(ctx context.Context, store Store, token, purpose string) (*User, error) {
+	t, err := store.UseEmailToken(ctx, hashEmailToken(token), purpose)
+	if err != nil {
+		return nil, errors.New("UseEmailToken: invalid token")
+	}
+
+	u, err := store.GetUserByID(ctx, t.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if u.Email != t.Email {
+		return nil, errors.New("UseEmailToken: email changed")
+	}
+
+	return u, nil
+}
+
+// SetEmailVerified marks the user’s email address as verified and removes it from the other users who did not verify it.
+// Returns ErrEmailTaken if another user verified it first.
+func (u *User) SetEmailVerified(ctx context.Context, store Store) error {
+	err := store.Transaction(ctx, func(tx Store) error {
+		if err := tx.UpdateUserEmailVerified(ctx, u, true); err != nil {
+			return err
+		}
+
+		return tx.DeleteUnverifiedEmails(ctx, u)
+	})
+	if err != nil {
+		return err
+	}
+
+	u.EmailVerified = true
+	return nil
+}
+
+// SendVerificationEmail sends the user a link to verify their email address
+func (u *User) SendVerificationEmail(ctx context.Context, store Store) error {
+	if u.Email == "" {
+		return errors.New("SendVerificationEmail: no email")
+	}
+
+	token, err := u.NewEmailToken(ctx, store, emailTokenVerify, config.Mail.VerificationTokenLifetime)
+	if err != nil {
+		return err
+	}
+
+	return mailer.Send(Message{
+		To:      u.Email,
+		Subject: "Verify your email address",
+		Body: fmt.Sprintf("Hello %s,\r\n\r\nPlease verify your email address by following this link:\r\n%s/verify-email?token=%s\r\n\r\nIt expires on %s.\r\n",
+			u.Username, config.FrontendURL, url.QueryEscape(token), u.FormatTime(time.Now().Add(config.Mail.VerificationTokenLifetime))),
+	})
+}
+
+// SendPasswordResetEmail sends the user a link to reset their password
+func (u *User) SendPasswordResetEmail(ctx context.Context, store Store) error {
+	if u.Email == "" || !u.EmailVerified {
+		return errors.New("SendPasswordResetEmail: no verified email")
+	}
+
+	token, err := u.NewEmailToken(ctx, store, emailTokenReset, config.Mail.PasswordResetTokenLifetime)
+	if err != nil {
+		return err
+	}
+
+	return mailer.Send(Message{
+		To:      u.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Hello %s,\r\n\r\nYou can choose a new password by following this link:\r\n%s/reset-password?token=%s\r\n\r\nIt expires on %s. If you did not ask for it, you can ignore this email.\r\n",
+			u.Username, config.FrontendURL, url.QueryEscape(token), u.FormatTime(time.Now().Add(config.Mail.PasswordResetTokenLifetime))),
+	})
+}
+
+// UpdateUserEmail sets the email address of the user, unverified
+func (store *PostgresStore) UpdateUserEmail(ctx context.Context, u *User, email string) error {
+	_, err := store.db.ExecContext(ctx, "update autochrone.users set (email, email_verified) = ($1, false) where id = $2", email, u.ID)
+	return err
+}
+
+// UpdateUserEmailVerified sets whether the user’s email address is verified, ErrEmailTaken if another user verified it
+func (store *PostgresStore) UpdateUserEmailVerified(ctx context.Context, u *User, verified bool) error {
+	_, err := store.db.ExecContext(ctx, "update autochrone.users set email_verified = $1 where id = $2", verified, u.ID)
+	if isUniqueViolation(err, "users_email") {
+		return ErrEmailTaken
+	}
+	return err
+}
+
+// DeleteUnverifiedEmails removes the user’s email address from the other users who did not verify it
+func (store *PostgresStore) DeleteUnverifiedEmails(ctx context.Context, u *User) error {
+	_, err := store.db.ExecContext(ctx, "update autochrone.users set email = '' where id <> $1 and lower(email) = lower($2) and not email_verified", u.ID, u.Email)
+	return err
+}
+
+// GetUserByEmail returns the user with given verified email address and a potential error
+func (store *PostgresStore) GetUserByEmail(ctx context.Context, email string) (*User, error) {
+	u := &User{}
+	err := store.db.GetContext(ctx, u, "select id, username, email, email_verified, timezone, locale from autochrone.users where lower(email) = lower($1) and email_verified", email)
+	if err != nil {
+		return nil, err
+	}
+
+	return u, nil
+}
+
+// InsertEmailToken records an email token
+func (store *PostgresStore) InsertEmailToken(ctx context.Context, t *EmailToken) error {
+	_, err := store.db.ExecContext(ctx, `insert into autochrone.email_tokens (id, user_id, purpose, email, expires_at)
+		values ($1, $2, $3, $4, $5)`, t.ID, t.UserID, t.Purpose, t.Email, t.ExpiresAt)
+	return err
+}
+
+// UseEmailToken deletes the unexpired email token with the given ID and purpose and returns it
+func (store *PostgresStore) UseEmailToken(ctx context.Context, id, purpose string) (*EmailToken, error) {
+	t := &EmailToken{}
+	err := store.db.GetContext(ctx, t, `delete from autochrone.email_tokens
+		where id = $1 and purpose = $2 and expires_at >= $3
+		returning *`, id, purpose, time.Now().UTC())
+	if err != nil {
+		return nil, err
+	}
+
+	return t, nil
+}
+
+// DeleteUserEmailTokens deletes the user’s email tokens for the given purpose
+func (store *PostgresStore) DeleteUserEmailTokens(ctx context.Context, u *User, purpose string) error {
+	_, err := store.db.ExecContext(ctx, "delete from autochrone.email_tokens where user_id = $1 and purpose = $2", u.ID, purpose)
+	return err
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"github.com/gin-gonic/gin"
+
+	"net/http"
+)
+
+// EmailGET responds with the email address of a user and whether it was verified
+func EmailGET(c *gin.Context) {
+	user := c.MustGet("user").(*User)
+
+	c.JSON(http.StatusOK, gin.H{"email": user.Email, "verified": user.EmailVerified})
+}
+
+// EmailVerificationPOST sends a new verification link to the user’s email address
+func EmailVerificationPOST(c *gin.Context) {
+	store := c.MustGet("store").(Store)
+	ctx := c.Request.Context()
+	user := c.MustGet("user").(*User)
+
+	if user.Email == "" || user.EmailVerified {
+		c.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+
+	if err := user.SendVerificationEmail(ctx, store); err != nil {
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	c.Status(http.StatusAccepted)
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Sprint event types, in the order events happening at the same time are sent
+const (
+	sprintEventCreated   = "created"
+	sprintEventStarted   = "started"
+	sprintEventEnded     = "ended"
+	sprintEventBreakOver = "break-over"
+	sprintEventUpdated   = "updated"
+)
+
+// sprintEventTypes the sprint event types, in order
+var sprintEventTypes = []string{sprintEventCreated, sprintEventStarted, sprintEventEnded, sprintEventBreakOver, sprintEventUpdated}
+
+// SprintEventID identifies a sprint event, events being ordered by time, sprint ID and type.
+// Clients resume a stream from the ID of the last event they received.
+type SprintEventID struct {
+	// Time the moment of the event
+	Time time.Time
+
+	// SprintID the ID of the sprint
+	SprintID int
+
+	// Type the type of the event
+	Type string
+}
+
+// String returns the ID as <unix microseconds>-<sprint ID>-<type>
+func (id SprintEventID) String() string {
+	return fmt.Sprintf("%d-%d-%s", id.Time.UnixMicro(), id.SprintID, id.Type)
+}
+
+// ParseSprintEventID parses the string representation of a sprint event ID
+func ParseSprintEventID(s string) (SprintEventID, error) {
+	parts := strings.SplitN(s, "-", 3)
+	if len(parts) != 3 {
+		return SprintEventID{}, errors.New("ParseSprintEventID: invalid event ID")
+	}
+
+	micro, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return SprintEventID{}, errors.New("ParseSprintEventID: invalid event time")
+	}
+	sprintID, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return SprintEventID{}, errors.New("ParseSprintEventID: invalid sprint ID")
+	}
+	if sprintEventRank(parts[2]) == -1 {
+		return SprintEventID{}, errors.New("ParseSprintEventID: invalid event type")
+	}
+
+	return SprintEventID{Time: time.UnixMicro(micro).UTC(), SprintID: sprintID, Type: parts[2]}, nil
+}
+
+// Before returns true if the event identified by id happened before the one identified by other
+func (id SprintEventID) Before(other SprintEventID) bool {
+	if !id.Time.Equal(other.Time) {
+		return id.Time.Before(other.Time)
+	}
+	if id.SprintID != other.SprintID {
+		return id.SprintID < other.SprintID
+	}
+	return sprintEventRank(id.Type) < sprintEventRank(other.Type)
+}
+
+// sprintEventRank returns the position of the event type in sprintEventTypes, -1 if it is unknown
+func sprintEventRank(eventType string) int {
+	for i, t := range sprintEventTypes {
+		if t == eventType {
+			return i
+		}
+	}
+	return -1
+}
+
+// SprintEvent is a step in the lifecycle of a sprint
+type SprintEvent struct {
+	// ID the ID of the event
+	ID SprintEventID `json:"-"`
+
+	// Type the type of the event: created, started, ended, break-over or updated
+	Type string `json:"type"`
+
+	// Time the moment of the event
+	Time time.Time `json:"time"`
+
+	// Sprint the sprint as it is now
+	Sprint *Sprint `json:"sprint"`
+}
+
+// Events returns the events of the sprint, past and scheduled, in order.
+// The sprint starts, ends and its break is over at the times Upcoming, Running and Over change,
+// these events are left out if they happened before the sprint was created.
+// Only the latest update is known.
+func (s *Sprint) Events() []*SprintEvent {
+	times := map[string]time.Time{
+		sprintEventCreated: s.CreatedAt,
+		sprintEventStarted: s.TimeStart,
+		sprintEventEnded:   s.TimeEnd(),
+	}
+	if s.Break > 0 {
+		times[sprintEventBreakOver] = s.TimeBreakEnd()
+	}
+	if s.UpdatedAt.After(s.CreatedAt) {
+		times[sprintEventUpdated] = s.UpdatedAt
+	}
+
+	events := []*SprintEvent{}
+	for _, eventType := range sprintEventTypes {
+		t, ok := times[eventType]
+		if !ok || (eventType != sprintEventCreated && t.Before(s.CreatedAt)) {
+			continue
+		}
+
+		t = t.UTC()
+		events = append(events, &SprintEvent{
+			ID:     SprintEventID{Time: t, SprintID: s.ID, Type: eventType},
+			Type:   eventType,
+			Time:   t,
+			Sprint: s,
+		})
+	}
+	sort.Slice(events, func(i, j int) bool { return events[i].ID.Before(events[j].ID) })
+	return events
+}
+
+// GetSprintEvents returns the events of the user’s sprints after the given one and up to now, in order,
+// along with the time of the next scheduled event, the zero time if none is
+func GetSprintEvents(ctx context.Context, store Store, u *User, after SprintEventID, now time.Time) (events []*SprintEvent, next time.Time, err error) {
+	sprints, err := store.GetUserSprintsChangedSince(ctx, u, after.Time)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	events = []*SprintEvent{}
+	for _, s := range sprints {
+		for _, e := range s.Events() {
+			switch {
+			case !after.Before(e.ID):
+			case e.Time.After(now):
+				if next.IsZero() || e.Time.Before(next) {
+					next = e.Time
+				}
+			default:
+				events = append(events, e)
+			}
+		}
+	}
+	sort.Slice(events, func(i, j int) bool { return events[i].ID.Before(events[j].ID) })
+
+	return events, next, nil
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"github.com/gin-contrib/sse"
+	"github.com/gin-gonic/gin"
+
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Sprint events stream settings
+const (
+	// eventsPollInterval the time between two checks for created and updated sprints
+	eventsPollInterval = 2 * time.Second
+
+	// eventsKeepAlive the time without event after which a comment is sent to keep the connection open
+	eventsKeepAlive = 30 * time.Second
+)
+
+// EventsGET streams the lifecycle events of the user’s sprints as server-sent events.
+// Resumes after the event with the ID given in the Last-Event-ID header, otherwise starts with the events to come.
+func EventsGET(c *gin.Context) {
+	store := c.MustGet("store").(Store)
+	ctx := c.Request.Context()
+	user := c.MustGet("user").(*User)
+	principal := c.MustGet("principal").(*Principal)
+
+	after := SprintEventID{Time: time.Now().UTC()}
+	if lastEventID := c.GetHeader("Last-Event-ID"); lastEventID != "" {
+		id, err := ParseSprintEventID(lastEventID)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		after = id
+	}
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+	c.Writer.Flush()
+
+	lastWrite := time.Now()
+	for {
+		events, next, err := pollSprintEvents(ctx, store, principal, user, after)
+		if err != nil {
+			// the client reconnects with the ID of the last event it received, with a valid token
+			return
+		}
+
+		for _, e := range events {
+			if err := sse.Encode(c.Writer, sse.Event{Id: e.ID.String(), Event: e.Type, Data: e}); err != nil {
+				return
+			}
+			after = e.ID
+			lastWrite = time.Now()
+		}
+		if time.Since(lastWrite) >= eventsKeepAlive {
+			if _, err := fmt.Fprint(c.Writer, ": keep-alive\n\n"); err != nil {
+				return
+			}
+			lastWrite = time.Now()
+		}
+		c.Writer.Flush()
+
+		wait := eventsPollInterval
+		if !next.IsZero() && time.Until(next) < wait {
+			wait = time.Until(next)
+		}
+		// the stream closes when the token expires
+		if !principal.ExpiresAt.IsZero() && time.Until(principal.ExpiresAt) < wait {
+			wait = time.Until(principal.ExpiresAt)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+	}
+}
+
+// pollSprintEvents returns the events of the user’s sprints after the given one and up to now,
+// or an error if the token of the principal expired or was revoked since the stream opened.
+// Its queries take at most the configured query timeout.
+func pollSprintEvents(ctx context.Context, store Store, principal *Principal, u *User, after SprintEventID) ([]*SprintEvent, time.Time, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	if err := principal.CheckToken(ctx, store, time.Now()); err != nil {
+		return nil, time.Time{}, err
+	}
+
+	return GetSprintEvents(ctx, store, u, after, time.Now())
+}
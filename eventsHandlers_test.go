@@ -0,0 +1,45 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestEventsGETRevokedToken(t *testing.T) {
+	r := NewRouter(NewMemoryStore(), NewRoomHub())
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	testSignUp(t, r, "alice")
+	alice := testLogIn(t, r, "alice", "basic").AccessToken
+
+	resp, err := http.Get(server.URL + "/users/alice/events?access_token=" + alice)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+
+	// logging out ends the stream at the next poll
+	if w := testRequest(r, http.MethodPost, "/auth/logout", alice, nil); w.Code != http.StatusOK {
+		t.Fatalf("logout: status %d", w.Code)
+	}
+	done := make(chan error, 1)
+	go func() {
+		_, err := io.Copy(io.Discard, resp.Body)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("stream error %v, want it closed", err)
+		}
+	case <-time.After(2*eventsPollInterval + time.Second):
+		t.Error("stream still open after logout")
+	}
+}
@@ -0,0 +1,281 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// Invite errors
+var (
+	// ErrSprintAlreadyOpen is returned when opening a sprint that is already open to guests
+	ErrSprintAlreadyOpen = errors.New("sprint already open to guests")
+
+	// ErrSprintNotOpen is returned when managing or joining the invite of a sprint that is not open to guests
+	ErrSprintNotOpen = errors.New("sprint not open to guests")
+
+	// ErrInviteExpired is returned when joining a sprint after its invite expired
+	ErrInviteExpired = errors.New("invite expired")
+
+	// ErrInviteFull is returned when joining a sprint that has as many guests as its invite allows
+	ErrInviteFull = errors.New("invite full")
+)
+
+// Invite opens a host sprint to guests
+type Invite struct {
+	// HostSprintID the ID of the sprint guests join
+	HostSprintID int `db:"host_sprint_id" json:"-"`
+
+	// Slug the random slug guests join with
+	Slug string `db:"invite_slug" json:"inviteSlug"`
+
+	// Comment the public comment shown to guests
+	Comment string `db:"comment" json:"comment"`
+
+	// CreatedAt the moment the invite was opened or its slug last regenerated
+	CreatedAt time.Time `db:"created_at" json:"createdAt"`
+
+	// ExpiresAt the moment after which guests may no longer join, nil if never
+	ExpiresAt *time.Time `db:"expires_at" json:"expiresAt"`
+
+	// MaxGuests the number of guests allowed, 0 for no limit
+	MaxGuests int `db:"max_guests" json:"maxGuests"`
+
+	// ClosedAt the moment the host closed the invite, nil while it is open
+	ClosedAt *time.Time `db:"closed_at" json:"-"`
+}
+
+// InvitePreview is what anyone with an invite slug can see before joining
+type InvitePreview struct {
+	// Host the username of the host
+	Host string `json:"host"`
+
+	// TimeStart the moment the sprint starts
+	TimeStart time.Time `json:"timeStart"`
+
+	// Duration the duration of the sprint in minutes
+	Duration int `json:"duration"`
+
+	// Break the break after the sprint in minutes
+	Break int `json:"break"`
+
+	// Comment the public comment of the invite
+	Comment string `json:"comment"`
+
+	// ExpiresAt the moment after which guests may no longer join, nil if never
+	ExpiresAt *time.Time `json:"expiresAt"`
+
+	// MaxGuests the number of guests allowed, 0 for no limit
+	MaxGuests int `json:"maxGuests"`
+
+	// Guests the number of guests who joined
+	Guests int `json:"guests"`
+}
+
+// GenerateInviteSlug returns a new random invite slug
+func GenerateInviteSlug() (string, error) {
+	return GenerateTokenID()
+}
+
+// IsOpen is true until the host closes the invite
+func (i *Invite) IsOpen() bool {
+	return i.ClosedAt == nil
+}
+
+// Expired is true if the invite expired at the given time
+func (i *Invite) Expired(now time.Time) bool {
+	return i.ExpiresAt != nil && !now.Before(*i.ExpiresAt)
+}
+
+// CheckJoinable returns nil if a new guest may join with the invite at the given time,
+// ErrSprintNotOpen, ErrInviteExpired or ErrInviteFull otherwise
+func (i *Invite) CheckJoinable(ctx context.Context, store Store, now time.Time) error {
+	if !i.IsOpen() {
+		return ErrSprintNotOpen
+	}
+	if i.Expired(now) {
+		return ErrInviteExpired
+	}
+	if i.MaxGuests > 0 {
+		guests, err := store.CountGuestSprints(ctx, i.HostSprintID)
+		if err != nil {
+			return err
+		}
+		if guests >= i.MaxGuests {
+			return ErrInviteFull
+		}
+	}
+	return nil
+}
+
+// OpenToGuests opens the sprint to guests with a new random invite slug and returns the invite.
+// An invite the host closed is reopened. expiresAt may be nil for an invite that never expires, and maxGuests 0 for no limit.
+func (s *Sprint) OpenToGuests(ctx context.Context, store Store, comment string, expiresAt *time.Time, maxGuests int) (*Invite, error) {
+	now := time.Now().UTC()
+	if expiresAt != nil && !expiresAt.After(now) {
+		return nil, errors.New("OpenToGuests: expiresAt is in the past")
+	}
+	if maxGuests < 0 {
+		return nil, errors.New("OpenToGuests: maxGuests is negative")
+	}
+
+	slug, err := GenerateInviteSlug()
+	if err != nil {
+		return nil, err
+	}
+
+	if expiresAt != nil {
+		utc := expiresAt.UTC()
+		expiresAt = &utc
+	}
+	invite := &Invite{
+		HostSprintID: s.ID,
+		Slug:         slug,
+		Comment:      comment,
+		CreatedAt:    now,
+		ExpiresAt:    expiresAt,
+		MaxGuests:    maxGuests,
+	}
+
+	err = store.Transaction(ctx, func(tx Store) error {
+		current, err := tx.GetInvite(ctx, s.ID)
+		if err == nil && current.IsOpen() {
+			return ErrSprintAlreadyOpen
+		} else if err == nil {
+			return tx.UpdateInvite(ctx, invite)
+		}
+
+		return tx.InsertInvite(ctx, invite)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.InviteSlug = invite.Slug
+	s.InviteComment = invite.Comment
+	return invite, nil
+}
+
+// CloseInvite closes the invite of the sprint, its guests remain
+func (s *Sprint) CloseInvite(ctx context.Context, store Store) error {
+	err := store.Transaction(ctx, func(tx Store) error {
+		invite, err := tx.GetInvite(ctx, s.ID)
+		if err != nil || !invite.IsOpen() {
+			return ErrSprintNotOpen
+		}
+
+		now := time.Now().UTC()
+		invite.ClosedAt = &now
+		return tx.UpdateInvite(ctx, invite)
+	})
+	if err != nil {
+		return err
+	}
+
+	s.InviteSlug = ""
+	s.InviteComment = ""
+	return nil
+}
+
+// RegenerateInvite replaces the slug of the sprint’s open invite, for instance after it leaked, and returns the invite
+func (s *Sprint) RegenerateInvite(ctx context.Context, store Store) (*Invite, error) {
+	slug, err := GenerateInviteSlug()
+	if err != nil {
+		return nil, err
+	}
+
+	var invite *Invite
+	err = store.Transaction(ctx, func(tx Store) error {
+		invite, err = tx.GetInvite(ctx, s.ID)
+		if err != nil || !invite.IsOpen() {
+			return ErrSprintNotOpen
+		}
+
+		invite.Slug = slug
+		invite.CreatedAt = time.Now().UTC()
+		return tx.UpdateInvite(ctx, invite)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.InviteSlug = invite.Slug
+	return invite, nil
+}
+
+// GetInvitePreview returns the preview of the open invite with the given slug
+func GetInvitePreview(ctx context.Context, store Store, slug string) (*InvitePreview, *Invite, error) {
+	invite, err := store.GetInviteBySlug(ctx, slug)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	host, err := store.GetSprintByID(ctx, invite.HostSprintID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	guests, err := store.CountGuestSprints(ctx, invite.HostSprintID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return &InvitePreview{
+		Host:      host.Username,
+		TimeStart: host.TimeStart,
+		Duration:  host.Duration,
+		Break:     host.Break,
+		Comment:   invite.Comment,
+		ExpiresAt: invite.ExpiresAt,
+		MaxGuests: invite.MaxGuests,
+		Guests:    guests,
+	}, invite, nil
+}
+
+// InsertInvite opens a sprint to guests
+func (store *PostgresStore) InsertInvite(ctx context.Context, i *Invite) error {
+	_, err := store.db.ExecContext(ctx, `insert into autochrone.host_sprints
+		(host_sprint_id, invite_slug, comment, created_at, expires_at, max_guests)
+		values ($1, $2, $3, $4, $5, $6)`, i.HostSprintID, i.Slug, i.Comment, i.CreatedAt, i.ExpiresAt, i.MaxGuests)
+	return err
+}
+
+// GetInvite returns the invite of the host sprint with the given ID, open or closed.
+// Within a transaction, the invite is locked until the transaction ends.
+func (store *PostgresStore) GetInvite(ctx context.Context, hostSprintID int) (*Invite, error) {
+	query := "select * from autochrone.host_sprints where host_sprint_id = $1"
+	if store.tx != nil {
+		query += " for update"
+	}
+
+	i := &Invite{}
+	if err := store.db.GetContext(ctx, i, query, hostSprintID); err != nil {
+		return nil, err
+	}
+	return i, nil
+}
+
+// GetInviteBySlug returns the open invite with the given slug
+func (store *PostgresStore) GetInviteBySlug(ctx context.Context, slug string) (*Invite, error) {
+	i := &Invite{}
+	if err := store.db.GetContext(ctx, i, "select * from autochrone.host_sprints where invite_slug = $1 and closed_at is null", slug); err != nil {
+		return nil, err
+	}
+	return i, nil
+}
+
+// UpdateInvite saves an existing invite
+func (store *PostgresStore) UpdateInvite(ctx context.Context, i *Invite) error {
+	_, err := store.db.ExecContext(ctx, `update autochrone.host_sprints
+		set (invite_slug, comment, created_at, expires_at, max_guests, closed_at)
+		= ($1, $2, $3, $4, $5, $6)
+		where host_sprint_id = $7`, i.Slug, i.Comment, i.CreatedAt, i.ExpiresAt, i.MaxGuests, i.ClosedAt, i.HostSprintID)
+	return err
+}
+
+// CountGuestSprints returns the number of guest sprints of the host sprint with the given ID
+func (store *PostgresStore) CountGuestSprints(ctx context.Context, hostSprintID int) (int, error) {
+	var n int
+	err := store.db.GetContext(ctx, &n, "select count(*) from autochrone.guest_sprints where host_sprint_id = $1", hostSprintID)
+	return n, err
+}
@@ -4,24 +4,59 @@ import (
 	"github.com/gin-gonic/gin"
 
 	"net/http"
+	"time"
 )
 
 // JoinInviteSlugGET creates a guest sprint
 func JoinInviteSlugGET(c *gin.Context) {
 	// get current user project, and target host sprint
+	store := c.MustGet("store").(Store)
+	ctx := c.Request.Context()
 	project := c.MustGet("project").(*Project)
-	hostSprint, err := GetSprintByInviteSlug(c.Param("islug"))
+	hostSprint, err := store.GetSprintByInviteSlug(ctx, c.Param("islug"))
 	if err != nil {
 		c.AbortWithStatus(http.StatusNotFound)
 		return
 	}
 
 	// create guest sprint on user project with model host sprint
-	guestSprint, err := project.NewGuestSprint(hostSprint)
-	if err != nil {
+	guestSprint, err := project.NewGuestSprint(ctx, store, hostSprint)
+	switch err {
+	case nil:
+	case ErrSprintAlreadyJoined, ErrInviteFull:
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	case ErrInviteExpired:
+		c.JSON(http.StatusGone, gin.H{"error": err.Error()})
+		return
+	case ErrSprintJoinedByHost:
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	case ErrSprintNotOpen:
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	default:
 		c.AbortWithStatus(http.StatusInternalServerError)
 		return
 	}
 
 	c.JSON(http.StatusOK, guestSprint)
 }
+
+// InvitesSlugGET previews an open invite, without authentication
+func InvitesSlugGET(c *gin.Context) {
+	store := c.MustGet("store").(Store)
+	ctx := c.Request.Context()
+
+	preview, invite, err := GetInvitePreview(ctx, store, c.Param("islug"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "invite not found"})
+		return
+	}
+	if invite.Expired(time.Now()) {
+		c.JSON(http.StatusGone, gin.H{"error": ErrInviteExpired.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, preview)
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"github.com/gin-gonic/gin"
+
+	"net/http"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestJoinInviteSlugGET(t *testing.T) {
+	r := NewRouter(NewMemoryStore(), NewRoomHub())
+	testSignUp(t, r, "alice")
+	testSignUp(t, r, "bob")
+	alice := testLogIn(t, r, "alice", "basic").AccessToken
+	bob := testLogIn(t, r, "bob", "basic").AccessToken
+
+	sprint := testSprint(t, r, alice, testProject(t, r, alice, "alice", "novel"), time.Now().Add(time.Hour), 20)
+	w := testRequest(r, http.MethodPost, sprint+"/open", alice, gin.H{})
+	if w.Code != http.StatusOK {
+		t.Fatalf("open: status %d", w.Code)
+	}
+	invite := &Invite{}
+	decodeJSON(t, w, invite)
+
+	// the host cannot join their own sprint, even from another project
+	hostJoin := testProject(t, r, alice, "alice", "essay") + "/join-invite/" + invite.Slug
+	if w := testRequest(r, http.MethodGet, hostJoin, alice, nil); w.Code != http.StatusBadRequest {
+		t.Errorf("host join: status %d, want %d", w.Code, http.StatusBadRequest)
+	}
+
+	// simultaneous joins by the same guest, from two projects: one succeeds, the others conflict
+	joins := []string{
+		testProject(t, r, bob, "bob", "poems") + "/join-invite/" + invite.Slug,
+		testProject(t, r, bob, "bob", "diary") + "/join-invite/" + invite.Slug,
+	}
+	codes := make([]int, 4)
+	var wg sync.WaitGroup
+	for i := range codes {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			codes[i] = testRequest(r, http.MethodGet, joins[i%len(joins)], bob, nil).Code
+		}(i)
+	}
+	wg.Wait()
+
+	sort.Ints(codes)
+	if want := []int{http.StatusOK, http.StatusConflict, http.StatusConflict, http.StatusConflict}; !equalInts(codes, want) {
+		t.Errorf("statuses %v, want %v", codes, want)
+	}
+}
+
+// equalInts returns true if both slices hold the same values in the same order
+func equalInts(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
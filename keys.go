@@ -0,0 +1,365 @@
+package main
+
+import (
+	"github.com/golang-jwt/jwt/v4"
+
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// signingKeys holds the keys used to sign and verify tokens, set up in main
+var signingKeys *KeyManager
+
+// SigningKey is a key used to sign and verify tokens, identified by the kid token header
+type SigningKey struct {
+	// ID the key identifier, also the kid header of the tokens it signs
+	ID string
+
+	// Method the signing method the key is used with
+	Method jwt.SigningMethod
+
+	// PrivateKey the key used to sign tokens: []byte, ed25519.PrivateKey or *rsa.PrivateKey
+	PrivateKey interface{}
+
+	// PublicKey the key used to verify tokens: []byte, ed25519.PublicKey or *rsa.PublicKey
+	PublicKey interface{}
+
+	// CreatedAt the moment the key was generated
+	CreatedAt time.Time
+}
+
+// KeyManager loads signing keys from a directory, signs tokens with the most recent one,
+// verifies tokens with any key that may still have signed unexpired tokens, and rotates keys.
+type KeyManager struct {
+	// Dir the directory holding one PEM file per key, named after the key ID
+	Dir string
+
+	// Method the signing method of newly generated keys
+	Method jwt.SigningMethod
+
+	// RotationPeriod the age after which the signing key is replaced
+	RotationPeriod time.Duration
+
+	// TokenLifetime the lifetime of signed tokens, for which retired keys are kept
+	TokenLifetime time.Duration
+
+	mu   sync.RWMutex
+	keys []*SigningKey // most recent first
+}
+
+// NewKeyManager loads the keys in the directory, generating a first key if there is none
+func NewKeyManager(dir, algorithm string, rotationPeriod, tokenLifetime time.Duration) (*KeyManager, error) {
+	method := jwt.GetSigningMethod(algorithm)
+	switch method {
+	case jwt.SigningMethodHS384, jwt.SigningMethodEdDSA, jwt.SigningMethodRS256:
+	default:
+		return nil, fmt.Errorf("unsupported signing algorithm %q", algorithm)
+	}
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+
+	km := &KeyManager{
+		Dir:            dir,
+		Method:         method,
+		RotationPeriod: rotationPeriod,
+		TokenLifetime:  tokenLifetime,
+	}
+	if err := km.Load(); err != nil {
+		return nil, err
+	}
+
+	if err := km.RotateIfNeeded(); err != nil {
+		return nil, err
+	}
+
+	return km, nil
+}
+
+// Load reads all keys from the directory, replacing the keys in memory
+func (km *KeyManager) Load() error {
+	paths, err := filepath.Glob(filepath.Join(km.Dir, "*.pem"))
+	if err != nil {
+		return err
+	}
+
+	keys := []*SigningKey{}
+	for _, path := range paths {
+		key, err := readSigningKey(path)
+		if err != nil {
+			return fmt.Errorf("could not read signing key %q: %v", path, err)
+		}
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].CreatedAt.After(keys[j].CreatedAt) })
+
+	km.mu.Lock()
+	km.keys = keys
+	km.mu.Unlock()
+	return nil
+}
+
+// RotateIfNeeded generates a new signing key if there is none with the configured method
+// or if the current one is older than the rotation period, then deletes keys no longer needed.
+func (km *KeyManager) RotateIfNeeded() error {
+	current, err := km.SigningKey()
+	if err != nil || current.Method != km.Method || time.Since(current.CreatedAt) >= km.RotationPeriod {
+		if err := km.Rotate(); err != nil {
+			return err
+		}
+	}
+
+	return km.Prune()
+}
+
+// Rotate generates a new key, saves it in the directory and uses it to sign tokens from now on
+func (km *KeyManager) Rotate() error {
+	key, err := generateSigningKey(km.Method)
+	if err != nil {
+		return err
+	}
+
+	if err := writeSigningKey(filepath.Join(km.Dir, key.ID+".pem"), key); err != nil {
+		return err
+	}
+
+	km.mu.Lock()
+	km.keys = append([]*SigningKey{key}, km.keys...)
+	km.mu.Unlock()
+
+	log.Printf("rotated token signing key, new key %q", key.ID)
+	return nil
+}
+
+// Prune deletes the keys that were replaced long enough ago for all the tokens they signed to have expired
+func (km *KeyManager) Prune() error {
+	km.mu.Lock()
+	defer km.mu.Unlock()
+
+	for i := 1; i < len(km.keys); i++ {
+		// keys[i] stopped signing when keys[i-1] was created
+		if time.Since(km.keys[i-1].CreatedAt) > km.TokenLifetime {
+			for _, key := range km.keys[i:] {
+				if err := os.Remove(filepath.Join(km.Dir, key.ID+".pem")); err != nil && !os.IsNotExist(err) {
+					return err
+				}
+			}
+			km.keys = km.keys[:i]
+			break
+		}
+	}
+
+	return nil
+}
+
+// RotateEvery reloads keys from the directory and rotates them if needed every interval.
+// Meant to be run in its own goroutine.
+func (km *KeyManager) RotateEvery(interval time.Duration) {
+	for range time.Tick(interval) {
+		if err := km.Load(); err != nil {
+			log.Printf("could not reload token signing keys: %v", err)
+			continue
+		}
+		if err := km.RotateIfNeeded(); err != nil {
+			log.Printf("could not rotate token signing keys: %v", err)
+		}
+	}
+}
+
+// SigningKey returns the key currently used to sign tokens
+func (km *KeyManager) SigningKey() (*SigningKey, error) {
+	km.mu.RLock()
+	defer km.mu.RUnlock()
+
+	if len(km.keys) == 0 {
+		return nil, errors.New("no signing key")
+	}
+	return km.keys[0], nil
+}
+
+// Sign signs the claims with the current key and returns the token as a string
+func (km *KeyManager) Sign(claims jwt.Claims) (string, error) {
+	key, err := km.SigningKey()
+	if err != nil {
+		return "", err
+	}
+
+	token := jwt.NewWithClaims(key.Method, claims)
+	token.Header["kid"] = key.ID
+	return token.SignedString(key.PrivateKey)
+}
+
+// Keyfunc returns the key to verify a token with, according to its kid header.
+// The token must have been signed with the method of that key.
+func (km *KeyManager) Keyfunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+
+	km.mu.RLock()
+	defer km.mu.RUnlock()
+
+	for _, key := range km.keys {
+		if key.ID == kid {
+			if token.Method.Alg() != key.Method.Alg() {
+				return nil, errors.New("invalid signing method")
+			}
+			return key.PublicKey, nil
+		}
+	}
+	return nil, errors.New("unknown signing key")
+}
+
+// JWK is a public key in the JSON Web Key format
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Algorithm string `json:"alg"`
+	Use       string `json:"use"`
+	Curve     string `json:"crv,omitempty"`
+	X         string `json:"x,omitempty"`
+	N         string `json:"n,omitempty"`
+	E         string `json:"e,omitempty"`
+}
+
+// JWKS returns the public keys that may verify unexpired tokens.
+// HMAC keys are secret and never published.
+func (km *KeyManager) JWKS() []JWK {
+	km.mu.RLock()
+	defer km.mu.RUnlock()
+
+	jwks := []JWK{}
+	for _, key := range km.keys {
+		jwk := JWK{KeyID: key.ID, Algorithm: key.Method.Alg(), Use: "sig"}
+		switch pub := key.PublicKey.(type) {
+		case ed25519.PublicKey:
+			jwk.KeyType = "OKP"
+			jwk.Curve = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+		case *rsa.PublicKey:
+			jwk.KeyType = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+		default:
+			continue
+		}
+		jwks = append(jwks, jwk)
+	}
+	return jwks
+}
+
+// generateSigningKey generates a key for the given method, identified by its creation time
+func generateSigningKey(method jwt.SigningMethod) (*SigningKey, error) {
+	now := time.Now().UTC()
+	key := &SigningKey{
+		ID:        fmt.Sprintf("%s-%x", strings.ToLower(method.Alg()), now.UnixNano()),
+		Method:    method,
+		CreatedAt: now,
+	}
+
+	switch method {
+	case jwt.SigningMethodHS384:
+		secret := make([]byte, 48)
+		if _, err := rand.Read(secret); err != nil {
+			return nil, err
+		}
+		key.PrivateKey, key.PublicKey = secret, secret
+	case jwt.SigningMethodEdDSA:
+		pub, priv, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		key.PrivateKey, key.PublicKey = priv, pub
+	case jwt.SigningMethodRS256:
+		priv, err := rsa.GenerateKey(rand.Reader, 3072)
+		if err != nil {
+			return nil, err
+		}
+		key.PrivateKey, key.PublicKey = priv, &priv.PublicKey
+	default:
+		return nil, fmt.Errorf("unsupported signing method %q", method.Alg())
+	}
+
+	return key, nil
+}
+
+// writeSigningKey saves a key as PEM: raw secret for HMAC, PKCS #8 otherwise
+func writeSigningKey(path string, key *SigningKey) error {
+	block := &pem.Block{Headers: map[string]string{
+		"Algorithm":  key.Method.Alg(),
+		"Created-At": key.CreatedAt.Format(time.RFC3339Nano),
+	}}
+
+	if secret, ok := key.PrivateKey.([]byte); ok {
+		block.Type = "HMAC SECRET"
+		block.Bytes = secret
+	} else {
+		der, err := x509.MarshalPKCS8PrivateKey(key.PrivateKey)
+		if err != nil {
+			return err
+		}
+		block.Type = "PRIVATE KEY"
+		block.Bytes = der
+	}
+
+	return os.WriteFile(path, pem.EncodeToMemory(block), 0600)
+}
+
+// readSigningKey reads a key saved by writeSigningKey
+func readSigningKey(path string) (*SigningKey, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(b)
+	if block == nil {
+		return nil, errors.New("no PEM data")
+	}
+
+	key := &SigningKey{
+		ID:     strings.TrimSuffix(filepath.Base(path), ".pem"),
+		Method: jwt.GetSigningMethod(block.Headers["Algorithm"]),
+	}
+	if key.Method == nil {
+		return nil, fmt.Errorf("unsupported signing algorithm %q", block.Headers["Algorithm"])
+	}
+	if key.CreatedAt, err = time.Parse(time.RFC3339Nano, block.Headers["Created-At"]); err != nil {
+		return nil, errors.New("invalid creation date")
+	}
+
+	switch block.Type {
+	case "HMAC SECRET":
+		key.PrivateKey, key.PublicKey = block.Bytes, block.Bytes
+	case "PRIVATE KEY":
+		priv, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		switch priv := priv.(type) {
+		case ed25519.PrivateKey:
+			key.PrivateKey, key.PublicKey = priv, priv.Public()
+		case *rsa.PrivateKey:
+			key.PrivateKey, key.PublicKey = priv, &priv.PublicKey
+		default:
+			return nil, errors.New("unsupported private key type")
+		}
+	default:
+		return nil, fmt.Errorf("unsupported PEM block type %q", block.Type)
+	}
+
+	return key, nil
+}
@@ -0,0 +1,12 @@
+package main
+
+import (
+	"github.com/gin-gonic/gin"
+
+	"net/http"
+)
+
+// JWKSGET responds with the public keys verifying tokens as a JSON Web Key Set
+func JWKSGET(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"keys": signingKeys.JWKS()})
+}
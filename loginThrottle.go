@@ -0,0 +1,142 @@
+package main
+
+import (
+	"github.com/lib/pq"
+
+	"context"
+	"database/sql"
+	"time"
+)
+
+// LoginThrottlePolicy determines how consecutive authentication failures lock a key out
+type LoginThrottlePolicy struct {
+	// FreeAttempts the number of consecutive failures allowed before the key is locked out
+	FreeAttempts int `yaml:"free_attempts"`
+
+	// BaseLockout the lockout duration after the first failure past FreeAttempts, doubled with each further failure
+	BaseLockout time.Duration `yaml:"base_lockout"`
+
+	// MaxLockout the longest lockout duration
+	MaxLockout time.Duration `yaml:"max_lockout"`
+
+	// ResetAfter the time without failure after which the failure count starts over
+	ResetAfter time.Duration `yaml:"reset_after"`
+}
+
+// Lockout returns how long a key is locked out after the given number of consecutive failures
+func (p LoginThrottlePolicy) Lockout(failures int) time.Duration {
+	if failures <= p.FreeAttempts {
+		return 0
+	}
+
+	lockout := p.BaseLockout
+	for i := p.FreeAttempts + 1; i < failures && lockout < p.MaxLockout; i++ {
+		lockout *= 2
+	}
+	if lockout > p.MaxLockout {
+		return p.MaxLockout
+	}
+	return lockout
+}
+
+// LoginThrottle rate limits authentication attempts per client IP and per username.
+// Failures and lockouts are recorded in the database so that they are shared between instances.
+type LoginThrottle struct {
+	// IPPolicy the policy for client addresses, usually more lenient as addresses may be shared
+	IPPolicy LoginThrottlePolicy
+
+	// UsernamePolicy the policy for usernames, whether they exist or not
+	UsernamePolicy LoginThrottlePolicy
+
+	// Now returns the current time
+	Now func() time.Time
+}
+
+// loginThrottle throttles authentication on /auth/, set up in main from the configuration
+var loginThrottle = NewLoginThrottle(config.LoginThrottle)
+
+// NewLoginThrottle returns a throttle applying the configured policies
+func NewLoginThrottle(cfg LoginThrottleConfig) *LoginThrottle {
+	return &LoginThrottle{IPPolicy: cfg.IP, UsernamePolicy: cfg.Username, Now: time.Now}
+}
+
+// ipKey and usernameKey return the keys of login_attempts rows
+func ipKey(ip string) string             { return "ip:" + ip }
+func usernameKey(username string) string { return "username:" + username }
+
+// Check returns how long the client must wait before trying to authenticate as username again, 0 if it may now
+func (lt *LoginThrottle) Check(ctx context.Context, store Store, ip, username string) (time.Duration, error) {
+	lockedUntil, err := store.GetLoginLockout(ctx, ipKey(ip), usernameKey(username))
+	if err != nil {
+		return 0, err
+	}
+
+	now := lt.Now().UTC()
+	if !lockedUntil.After(now) {
+		return 0, nil
+	}
+	return lockedUntil.Sub(now), nil
+}
+
+// Fail records an authentication failure for the client and username, locking them out if needed
+func (lt *LoginThrottle) Fail(ctx context.Context, store Store, ip, username string) error {
+	if err := lt.fail(ctx, store, ipKey(ip), lt.IPPolicy); err != nil {
+		return err
+	}
+	return lt.fail(ctx, store, usernameKey(username), lt.UsernamePolicy)
+}
+
+// fail records an authentication failure for a key
+func (lt *LoginThrottle) fail(ctx context.Context, store Store, key string, policy LoginThrottlePolicy) error {
+	now := lt.Now().UTC()
+	failures, err := store.RecordLoginFailure(ctx, key, now, now.Add(-policy.ResetAfter))
+	if err != nil {
+		return err
+	}
+
+	if lockout := policy.Lockout(failures); lockout > 0 {
+		return store.LockLogin(ctx, key, now.Add(lockout))
+	}
+	return nil
+}
+
+// Succeed forgets the failures for the username after a successful authentication.
+// Client failures are kept, so that one valid account cannot be used to reset them.
+func (lt *LoginThrottle) Succeed(ctx context.Context, store Store, username string) error {
+	return store.DeleteLoginAttempts(ctx, usernameKey(username))
+}
+
+// GetLoginLockout returns the latest time until which one of the keys is locked out, the zero time if none is
+func (store *PostgresStore) GetLoginLockout(ctx context.Context, keys ...string) (time.Time, error) {
+	var lockedUntil sql.NullTime
+	if err := store.db.GetContext(ctx, &lockedUntil, "select max(locked_until) from autochrone.login_attempts where key = any($1)", pq.Array(keys)); err != nil {
+		return time.Time{}, err
+	}
+
+	return lockedUntil.Time, nil
+}
+
+// RecordLoginFailure records a failure for the key at the given time and returns the number of consecutive failures.
+// The count starts over if the previous failure happened before resetBefore.
+func (store *PostgresStore) RecordLoginFailure(ctx context.Context, key string, at, resetBefore time.Time) (int, error) {
+	var failures int
+	err := store.db.GetContext(ctx, &failures, `insert into autochrone.login_attempts (key, failures, last_failure_at)
+		values ($1, 1, $2)
+		on conflict (key) do update set
+			failures = case when login_attempts.last_failure_at < $3 then 1 else login_attempts.failures + 1 end,
+			last_failure_at = $2
+		returning failures`, key, at, resetBefore)
+	return failures, err
+}
+
+// LockLogin locks the key out until the given time
+func (store *PostgresStore) LockLogin(ctx context.Context, key string, until time.Time) error {
+	_, err := store.db.ExecContext(ctx, "update autochrone.login_attempts set locked_until = $1 where key = $2", until, key)
+	return err
+}
+
+// DeleteLoginAttempts forgets the failures recorded for the key
+func (store *PostgresStore) DeleteLoginAttempts(ctx context.Context, key string) error {
+	_, err := store.db.ExecContext(ctx, "delete from autochrone.login_attempts where key = $1", key)
+	return err
+}
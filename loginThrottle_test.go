@@ -0,0 +1,160 @@
+package main
+
+import (
+	"github.com/gin-gonic/gin"
+
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// testLoginThrottle returns a throttle whose clock is moved by the returned function
+func testLoginThrottle() (*LoginThrottle, func(time.Duration)) {
+	now := time.Date(2027, 1, 1, 12, 0, 0, 0, time.UTC)
+	lt := &LoginThrottle{
+		IPPolicy:       LoginThrottlePolicy{FreeAttempts: 4, BaseLockout: time.Minute, MaxLockout: 10 * time.Minute, ResetAfter: time.Hour},
+		UsernamePolicy: LoginThrottlePolicy{FreeAttempts: 2, BaseLockout: time.Minute, MaxLockout: 3 * time.Minute, ResetAfter: time.Hour},
+		Now:            func() time.Time { return now },
+	}
+	return lt, func(d time.Duration) { now = now.Add(d) }
+}
+
+func TestLoginThrottlePolicyLockout(t *testing.T) {
+	policy := LoginThrottlePolicy{FreeAttempts: 2, BaseLockout: time.Second, MaxLockout: 5 * time.Second}
+	for failures, want := range []time.Duration{0, 0, 0, time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second} {
+		if got := policy.Lockout(failures); got != want {
+			t.Errorf("Lockout(%d) = %v, want %v", failures, got, want)
+		}
+	}
+}
+
+func TestLoginThrottleLockout(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	lt, advance := testLoginThrottle()
+
+	check := func(ip, username string, want time.Duration) {
+		t.Helper()
+		got, err := lt.Check(ctx, store, ip, username)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("Check(%q, %q) = %v, want %v", ip, username, got, want)
+		}
+	}
+
+	for i := 0; i < 3; i++ {
+		if err := lt.Fail(ctx, store, "192.0.2.1", "alice"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	check("192.0.2.1", "alice", time.Minute)
+	check("192.0.2.2", "alice", time.Minute)
+	check("192.0.2.1", "bob", 0)
+
+	advance(40 * time.Second)
+	check("192.0.2.2", "alice", 20*time.Second)
+
+	// the lockout doubles with each further failure, up to the maximum
+	advance(20 * time.Second)
+	check("192.0.2.2", "alice", 0)
+	if err := lt.Fail(ctx, store, "192.0.2.2", "alice"); err != nil {
+		t.Fatal(err)
+	}
+	check("192.0.2.2", "alice", 2*time.Minute)
+	if err := lt.Fail(ctx, store, "192.0.2.2", "alice"); err != nil {
+		t.Fatal(err)
+	}
+	check("192.0.2.2", "alice", 3*time.Minute)
+
+	// the client address is locked out by its own failures, on any username
+	for _, username := range []string{"bob", "carol", "dave", "erin"} {
+		check("192.0.2.3", username, 0)
+		if err := lt.Fail(ctx, store, "192.0.2.3", username); err != nil {
+			t.Fatal(err)
+		}
+	}
+	check("192.0.2.3", "frank", 0)
+	if err := lt.Fail(ctx, store, "192.0.2.3", "frank"); err != nil {
+		t.Fatal(err)
+	}
+	check("192.0.2.3", "grace", time.Minute)
+}
+
+func TestLoginThrottleExpiry(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	lt, advance := testLoginThrottle()
+
+	for i := 0; i < 3; i++ {
+		if err := lt.Fail(ctx, store, "192.0.2.1", "alice"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// after ResetAfter without failure, the count starts over
+	advance(time.Hour + time.Second)
+	if wait, err := lt.Check(ctx, store, "192.0.2.1", "alice"); err != nil || wait != 0 {
+		t.Fatalf("Check = %v, %v, want 0 once the lockout expired", wait, err)
+	}
+	if err := lt.Fail(ctx, store, "192.0.2.1", "alice"); err != nil {
+		t.Fatal(err)
+	}
+	if wait, err := lt.Check(ctx, store, "192.0.2.1", "alice"); err != nil || wait != 0 {
+		t.Errorf("Check = %v, %v, want 0 for the first failure after the reset", wait, err)
+	}
+
+	// a success forgets the username failures only
+	if err := lt.Fail(ctx, store, "192.0.2.1", "alice"); err != nil {
+		t.Fatal(err)
+	}
+	if err := lt.Fail(ctx, store, "192.0.2.1", "alice"); err != nil {
+		t.Fatal(err)
+	}
+	if err := lt.Succeed(ctx, store, "alice"); err != nil {
+		t.Fatal(err)
+	}
+	if wait, err := lt.Check(ctx, store, "192.0.2.9", "alice"); err != nil || wait != 0 {
+		t.Errorf("Check = %v, %v, want 0 after a success", wait, err)
+	}
+	if failures, err := store.RecordLoginFailure(ctx, ipKey("192.0.2.1"), lt.Now(), lt.Now().Add(-time.Hour)); err != nil || failures != 4 {
+		t.Errorf("client failures = %d, %v, want 4 kept after a success", failures, err)
+	}
+}
+
+func TestLoginThrottleClientIP(t *testing.T) {
+	throttle, trustedProxies := loginThrottle, config.TrustedProxies
+	t.Cleanup(func() { loginThrottle, config.TrustedProxies = throttle, trustedProxies })
+	loginThrottle, _ = testLoginThrottle()
+	loginThrottle.IPPolicy.FreeAttempts = 1
+
+	authenticate := func(r http.Handler, forwardedFor, username string) int {
+		req := newTestRequest(http.MethodPost, "/auth/", "", gin.H{"username": username, "password": "wrong password"})
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+		return serve(r, req).Code
+	}
+
+	// X-Forwarded-For is ignored from untrusted clients
+	config.TrustedProxies = nil
+	r := NewRouter(NewMemoryStore(), NewRoomHub())
+	for i, username := range []string{"alice", "bob"} {
+		if code := authenticate(r, fmt.Sprintf("198.51.100.%d", i), username); code != http.StatusUnauthorized {
+			t.Fatalf("failure %d: status %d, want %d", i+1, code, http.StatusUnauthorized)
+		}
+	}
+	if code := authenticate(r, "198.51.100.2", "carol"); code != http.StatusTooManyRequests {
+		t.Errorf("spoofed X-Forwarded-For: status %d, want %d", code, http.StatusTooManyRequests)
+	}
+
+	// and gives the client address behind a trusted proxy, the remote address of test requests
+	config.TrustedProxies = []string{"192.0.2.1"}
+	r = NewRouter(NewMemoryStore(), NewRoomHub())
+	for i, username := range []string{"alice", "bob", "carol"} {
+		if code := authenticate(r, fmt.Sprintf("198.51.100.%d", i), username); code != http.StatusUnauthorized {
+			t.Errorf("client %d behind a trusted proxy: status %d, want %d", i+1, code, http.StatusUnauthorized)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// mailer sends the emails of the API, set up in main
+var mailer Mailer = &MemoryMailer{}
+
+// Message is a plain text email
+type Message struct {
+	// To the recipient address
+	To string
+
+	// Subject the email subject
+	Subject string
+
+	// Body the plain text body
+	Body string
+}
+
+// Bytes formats the message as an RFC 5322 email from the given sender
+func (msg Message) Bytes(from string) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", msg.Subject)
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&b, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&b, "Content-Type: text/plain; charset=utf-8\r\n")
+	fmt.Fprintf(&b, "\r\n%s\r\n", msg.Body)
+	return b.Bytes()
+}
+
+// Mailer sends emails
+type Mailer interface {
+	// Send sends the message or returns an error
+	Send(msg Message) error
+}
+
+// SMTPMailer sends emails through an SMTP server
+type SMTPMailer struct {
+	// Addr the server address, host:port
+	Addr string
+
+	// From the sender address
+	From string
+
+	// Username and Password authenticate to the server, no authentication if Username is empty
+	Username string
+	Password string
+}
+
+// Send sends the message through the SMTP server
+func (m *SMTPMailer) Send(msg Message) error {
+	var auth smtp.Auth
+	if m.Username != "" {
+		host, _, err := net.SplitHostPort(m.Addr)
+		if err != nil {
+			return err
+		}
+		auth = smtp.PlainAuth("", m.Username, m.Password, host)
+	}
+
+	return smtp.SendMail(m.Addr, auth, m.From, []string{msg.To}, msg.Bytes(m.From))
+}
+
+// FileMailer writes emails as .eml files in a directory instead of sending them, for development
+type FileMailer struct {
+	// Dir the directory to write emails to
+	Dir string
+
+	// From the sender address
+	From string
+}
+
+// Send writes the message in the mailer directory
+func (m *FileMailer) Send(msg Message) error {
+	if err := os.MkdirAll(m.Dir, 0700); err != nil {
+		return err
+	}
+
+	b := make([]byte, 4)
+	if _, err := rand.Read(b); err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%s-%s.eml", time.Now().UTC().Format("20060102T150405.000000000"), hex.EncodeToString(b))
+
+	return os.WriteFile(filepath.Join(m.Dir, name), msg.Bytes(m.From), 0600)
+}
+
+// MemoryMailer keeps emails in memory instead of sending them, for testing
+type MemoryMailer struct {
+	mu       sync.Mutex
+	messages []Message
+}
+
+// Send keeps the message in memory
+func (m *MemoryMailer) Send(msg Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.messages = append(m.messages, msg)
+	return nil
+}
+
+// Messages returns the messages sent so far
+func (m *MemoryMailer) Messages() []Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return append([]Message{}, m.messages...)
+}
+
+// ValidEmail returns true if the string is a bare email address
+func ValidEmail(email string) bool {
+	addr, err := mail.ParseAddress(email)
+	return err == nil && addr.Address == email && len(email) <= 254
+}
@@ -4,23 +4,145 @@ package main
 import (
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
+
+	"log"
+	"os"
+	"time"
+	_ "time/tzdata" // time zones of calendars, whether or not the system has them
 )
 
 func main() {
+	// configuration
+	cfg, args, err := LoadConfig(os.Args[1:])
+	if err != nil {
+		log.Fatalf("could not load configuration: %v", err)
+	}
+	config = cfg
+	loginThrottle = NewLoginThrottle(config.LoginThrottle)
+
+	// logging
+	gin.SetMode(config.Log.Mode)
+	if config.Log.File != "" {
+		logFile, err := os.OpenFile(config.Log.File, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0640)
+		if err != nil {
+			log.Fatalf("could not open log file: %v", err)
+		}
+		defer logFile.Close()
+		log.SetOutput(logFile)
+		gin.DefaultWriter = logFile
+		gin.DefaultErrorWriter = logFile
+	}
+
+	// database connection pool
+	store, err := NewPostgresStore(config.DB.URL, config.DB.PoolConfig)
+	if err != nil {
+		log.Fatalf("could not connect to the database: %v", err)
+	}
+	defer store.Close()
+
+	// autochrone-api migrate up|down|status
+	if len(args) > 0 && args[0] == "migrate" {
+		if err := RunMigrateCommand(store, args[1:]); err != nil {
+			log.Fatalf("migrate: %v", err)
+		}
+		return
+	} else if len(args) > 0 {
+		log.Fatalf("unknown command %q", args[0])
+	}
+
+	// database schema
+	migrator, err := NewMigrator(store)
+	if err != nil {
+		log.Fatalf("could not load migrations: %v", err)
+	}
+	if pending, err := migrator.Pending(); err != nil {
+		log.Fatalf("could not check migrations: %v", err)
+	} else if len(pending) > 0 {
+		log.Fatalf("%d pending migrations, run autochrone-api migrate up", len(pending))
+	}
+
+	// token signing keys
+	signingKeys, err = NewKeyManager(config.Tokens.SigningKeysDir, config.Tokens.SigningAlgorithm, config.Tokens.KeyRotationPeriod, config.Tokens.SignedTokenLifetime())
+	if err != nil {
+		log.Fatalf("could not load token signing keys: %v", err)
+	}
+	go signingKeys.RotateEvery(time.Minute)
+
+	// mailer
+	if config.Mail.SMTPAddr != "" {
+		mailer = &SMTPMailer{Addr: config.Mail.SMTPAddr, From: config.Mail.From, Username: config.Mail.SMTPUsername, Password: config.Mail.SMTPPassword}
+	} else {
+		mailer = &FileMailer{Dir: config.Mail.DropDir, From: config.Mail.From}
+	}
+
+	r := NewRouter(store, NewRoomHub())
+	if config.TLS.CertFile != "" {
+		err = r.RunTLS(config.Listen, config.TLS.CertFile, config.TLS.KeyFile)
+	} else {
+		err = r.Run(config.Listen)
+	}
+	if err != nil {
+		log.Fatalf("could not serve the API: %v", err)
+	}
+}
+
+// NewRouter returns the API router, serving the models of the given store and the sprint rooms of the given hub
+func NewRouter(store Store, rooms *RoomHub) *gin.Engine {
 	// gin router
-	r := gin.Default()
+	r := gin.New()
+	r.Use(gin.LoggerWithFormatter(AccessLogFormatter), gin.Recovery())
+	if err := r.SetTrustedProxies(config.TrustedProxies); err != nil {
+		log.Fatalf("could not configure trusted proxies: %v", err)
+	}
 
 	// CORS settings
 	corsConfig := cors.DefaultConfig()
-	corsConfig.AllowOrigins = []string{"http://192.168.43.126:4200", "http://localhost:4200", "http://192.168.43.1:4200"}
+	for _, origin := range config.CORS.AllowOrigins {
+		if origin == "*" {
+			corsConfig.AllowAllOrigins = true
+		} else {
+			corsConfig.AllowOrigins = append(corsConfig.AllowOrigins, origin)
+		}
+	}
+	if corsConfig.AllowAllOrigins {
+		corsConfig.AllowOrigins = nil
+	}
 	corsConfig.AllowMethods = []string{"GET", "POST", "PUT", "PATCH", "DELETE"}
 	corsConfig.AllowHeaders = []string{"Content-Type", "Authorization", "Origin"}
 	corsConfig.ExposeHeaders = []string{"Location", "Access-Control-Allow-Origin"}
 	r.Use(cors.New(corsConfig))
 
+	// database access
+	routeQueryTimeouts, err := config.DB.ParseRouteQueryTimeouts()
+	if err != nil {
+		log.Fatalf("could not configure query timeouts: %v", err)
+	}
+	// the events stream and sprint rooms last as long as the client listens, they bound each of their queries instead
+	// unless a timeout is configured for them
+	for _, route := range []string{"GET /users/:username/events", "GET /users/:username/projects/:pslug/sprints/:sslug/room"} {
+		if _, ok := routeQueryTimeouts[route]; !ok {
+			routeQueryTimeouts[route] = 0
+		}
+	}
+	r.Use(StoreProvider(store))
+	r.Use(RoomHubProvider(rooms))
+	r.Use(QueryTimeout(config.DB.QueryTimeout, routeQueryTimeouts))
+
+	// /.well-known/
+	r.GET("/.well-known/jwks.json", JWKSGET)
+
+	// /invites/:islug
+	r.GET("/invites/:islug", InvitesSlugGET)
+
 	// /auth/
 	rAuth := r.Group("/auth/")
 	rAuth.POST("", AuthPOST)
+	rAuth.POST("mfa", AuthMFAPOST)
+	rAuth.POST("forgot-password", AuthForgotPasswordPOST)
+	rAuth.POST("reset-password", AuthResetPasswordPOST)
+	rAuth.POST("verify-email", AuthVerifyEmailPOST)
+	rAuth.POST("refresh", AuthRefreshPOST)
+	rAuth.POST("logout", TokenScopeChecker("basic", "read", "admin"), AuthLogoutPOST)
 
 	// /users/
 	rUsers := r.Group("/users/")
@@ -31,40 +153,86 @@ func main() {
 	rUsersUsername := rUsers.Group("/:username")
 	rUsersUsername.Use(UserLoader)
 	rUsersUsername.GET("", UsersUsernameGET)
-	rUsersUsername.PATCH("", TokenScopeChecker("basic"), UsersUsernamePATCH)
-	rUsersUsername.DELETE("", TokenScopeChecker("basic"), UsersUsernameDELETE)
+	rUsersUsername.PATCH("", TokenScopeChecker("basic", "admin"), UsersUsernamePATCH)
+	rUsersUsername.DELETE("", TokenScopeChecker("basic", "admin"), UsersUsernameDELETE)
+	rUsersUsername.GET("/events", QueryTokenAuthorization, TokenScopeChecker("basic", "read", "admin"), EventsGET)
+
+	// /users/:username/email
+	rEmail := rUsersUsername.Group("/email")
+	rEmail.GET("", TokenScopeChecker("basic", "read", "admin"), EmailGET)
+	rEmail.POST("/verification", TokenScopeChecker("basic", "admin"), EmailVerificationPOST)
+
+	// /users/:username/sessions/
+	rSessions := rUsersUsername.Group("/sessions/")
+	rSessions.GET("", TokenScopeChecker("basic", "read", "admin"), SessionsGET)
+	rSessions.DELETE("/:id", TokenScopeChecker("basic", "admin"), SessionsIDDELETE)
+
+	// /users/:username/totp
+	rTOTP := rUsersUsername.Group("/totp")
+	rTOTP.POST("", TokenScopeChecker("basic", "admin"), TOTPPOST)
+	rTOTP.DELETE("", TokenScopeChecker("basic", "admin"), TOTPDELETE)
+	rTOTP.POST("/confirm", TokenScopeChecker("basic", "admin"), TOTPConfirmPOST)
+	rTOTP.POST("/recovery-codes", TokenScopeChecker("basic", "admin"), TOTPRecoveryCodesPOST)
+
+	// /users/:username/roles/
+	rRoles := rUsersUsername.Group("/roles/")
+	rRoles.GET("", TokenScopeChecker("basic", "read", "admin"), RolesGET)
+	rRoles.PUT("/:role", TokenScopeChecker("admin"), RolesNamePUT)
+	rRoles.DELETE("/:role", TokenScopeChecker("admin"), RolesNameDELETE)
+
+	// /users/:username/tokens/
+	rTokens := rUsersUsername.Group("/tokens/")
+	rTokens.GET("", TokenScopeChecker("basic", "read", "admin"), TokensGET)
+	rTokens.POST("", TokenScopeChecker("basic", "admin"), TokensPOST)
+	rTokens.DELETE("/:id", TokenScopeChecker("basic", "admin"), TokensIDDELETE)
+
+	// /users/:username/streaks
+	rUsersUsername.GET("/streaks", StreaksGET)
+
+	// /users/:username/rest-days/
+	rRestDays := rUsersUsername.Group("/rest-days/")
+	rRestDays.GET("", RestDaysGET)
+	rRestDays.PUT("/:date", TokenScopeChecker("basic", "admin"), RestDaysDatePUT)
+	rRestDays.DELETE("/:date", TokenScopeChecker("basic", "admin"), RestDaysDateDELETE)
 
 	// /users/:username/projects/
 	rProjects := rUsersUsername.Group("/projects/")
 	rProjects.GET("", ProjectsGET)
-	rProjects.POST("", TokenScopeChecker("basic"), ProjectsPOST)
+	rProjects.POST("", TokenScopeChecker("basic", "admin"), ProjectsPOST)
 
 	// /users/:username/projects/:pslug
 	rProjectsSlug := rProjects.Group("/:pslug")
 	rProjectsSlug.Use(ProjectLoader)
 	rProjectsSlug.GET("", ProjectsSlugGET)
-	rProjectsSlug.PUT("", TokenScopeChecker("basic"), ProjectsSlugPUT)
+	rProjectsSlug.GET("/stats", ProjectsSlugStatsGET)
+	rProjectsSlug.GET("/milestones", ProjectsSlugMilestonesGET)
+	rProjectsSlug.GET("/calendar", ProjectsSlugCalendarGET)
+	rProjectsSlug.PUT("", TokenScopeChecker("basic", "admin"), ProjectsSlugPUT)
 	//rProjectsSlug.PATCH("", ProjectsSlugPATCH)
-	rProjectsSlug.DELETE("", TokenScopeChecker("basic"), ProjectsSlugDELETE)
+	rProjectsSlug.DELETE("", TokenScopeChecker("basic", "admin"), ProjectsSlugDELETE)
 
 	// /users/:username/projects/:pslug/sprints/
 	rSprints := rProjectsSlug.Group("/sprints/")
 	rSprints.GET("", SprintsGET)
-	rSprints.POST("", TokenScopeChecker("basic"), SprintsPOST)
+	rSprints.POST("", TokenScopeChecker("basic", "sprints:write", "admin"), SprintsPOST)
 
 	// /users/:username/projects/:pslug/sprints/:sslug
 	rSprintsSlug := rSprints.Group("/:sslug")
 	rSprintsSlug.Use(SprintLoader)
 	rSprintsSlug.GET("", SprintsSlugGET)
-	rSprintsSlug.PUT("", TokenScopeChecker("basic"), SprintsSlugPUT)
-	rSprintsSlug.DELETE("", TokenScopeChecker("basic"), SprintsSlugDELETE)
-	rSprintsSlug.POST("/next-sprint", TokenScopeChecker("basic"), SprintsSlugNextSprintPOST)
-	rSprintsSlug.POST("/open", TokenScopeChecker("basic"), SprintsSlugOpenPOST)
+	rSprintsSlug.PUT("", TokenScopeChecker("basic", "sprints:write", "admin"), SprintsSlugPUT)
+	rSprintsSlug.DELETE("", TokenScopeChecker("basic", "sprints:write", "admin"), SprintsSlugDELETE)
+	rSprintsSlug.POST("/next-sprint", TokenScopeChecker("basic", "sprints:write", "admin"), SprintsSlugNextSprintPOST)
+	rSprintsSlug.POST("/open", TokenScopeChecker("basic", "sprints:write", "admin"), SprintsSlugOpenPOST)
+	rSprintsSlug.DELETE("/open", TokenScopeChecker("basic", "sprints:write", "admin"), SprintsSlugOpenDELETE)
+	rSprintsSlug.POST("/open/regenerate", TokenScopeChecker("basic", "sprints:write", "admin"), SprintsSlugOpenRegeneratePOST)
 	rSprintsSlug.GET("/guests", SprintsSlugGuestsGET)
+	rSprintsSlug.GET("/host", SprintsSlugHostGET)
+	rSprintsSlug.GET("/room", QueryTokenAuthorization, SprintsSlugRoomGET)
 
 	// /users/:username/projects/:pslug/join-invite/:islug
 	rJoinInviteSlug := rProjectsSlug.Group("/join-invite/:islug")
-	rJoinInviteSlug.GET("", TokenScopeChecker("basic"), JoinInviteSlugGET)
+	rJoinInviteSlug.GET("", TokenScopeChecker("basic", "sprints:write", "admin"), JoinInviteSlugGET)
 
-	r.Run(":8080")
+	return r
 }
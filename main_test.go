@@ -0,0 +1,114 @@
+package main
+
+import (
+	"github.com/gin-gonic/gin"
+
+	"bytes"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+// TestMain signs tokens with keys in a temporary directory
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+
+	dir, err := os.MkdirTemp("", "autochrone-test-keys")
+	if err != nil {
+		log.Fatal(err)
+	}
+	signingKeys, err = NewKeyManager(dir, "EdDSA", time.Hour, time.Hour)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// newTestRequest returns a request with the value as JSON body if not nil, authenticated with the token if not empty
+func newTestRequest(method, path, token string, body interface{}) *http.Request {
+	var b []byte
+	if body != nil {
+		b, _ = json.Marshal(body)
+	}
+	req := httptest.NewRequest(method, path, bytes.NewReader(b))
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return req
+}
+
+// serve records the response of the router to the request
+func serve(r http.Handler, req *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+// testRequest records the response of the router to a request built by newTestRequest
+func testRequest(r http.Handler, method, path, token string, body interface{}) *httptest.ResponseRecorder {
+	return serve(r, newTestRequest(method, path, token, body))
+}
+
+// decodeJSON decodes the body of the response into v
+func decodeJSON(t *testing.T, w *httptest.ResponseRecorder, v interface{}) {
+	t.Helper()
+	if err := json.Unmarshal(w.Body.Bytes(), v); err != nil {
+		t.Fatalf("invalid JSON response %q: %v", w.Body.String(), err)
+	}
+}
+
+// testPassword the password of the users registered by tests
+const testPassword = "password123"
+
+// testSignUp registers a user through the API
+func testSignUp(t *testing.T, r http.Handler, username string) {
+	t.Helper()
+	w := testRequest(r, http.MethodPost, "/users/", "", gin.H{"username": username, "password": testPassword, "confirm": testPassword})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("sign up %q: status %d", username, w.Code)
+	}
+}
+
+// testLogIn authenticates a user through the API and returns their tokens in the given scope
+func testLogIn(t *testing.T, r http.Handler, username, scope string) *TokenPair {
+	t.Helper()
+	w := testRequest(r, http.MethodPost, "/auth/", "", gin.H{"username": username, "password": testPassword, "scope": scope})
+	if w.Code != http.StatusOK {
+		t.Fatalf("log in %q: status %d %s", username, w.Code, w.Body.String())
+	}
+	pair := &TokenPair{}
+	decodeJSON(t, w, pair)
+	return pair
+}
+
+// testProject creates a project starting today through the API and returns its path
+func testProject(t *testing.T, r http.Handler, token, username, slug string) string {
+	t.Helper()
+	today := LocalDate(time.Now(), time.UTC)
+	w := testRequest(r, http.MethodPost, "/users/"+username+"/projects/", token, gin.H{
+		"name": slug, "slug": slug, "dateStart": today.Format("2006-01-02"), "dateEnd": today.AddDate(0, 0, 29).Format("2006-01-02"),
+		"wordCountStart": 0, "wordCountGoal": 30000,
+	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("create project %q: status %d %s", slug, w.Code, w.Body.String())
+	}
+	return w.Header().Get("Location")
+}
+
+// testSprint creates a sprint on the project through the API and returns its path
+func testSprint(t *testing.T, r http.Handler, token, projectPath string, timeStart time.Time, duration int) string {
+	t.Helper()
+	w := testRequest(r, http.MethodPost, projectPath+"/sprints/", token, gin.H{"timeStart": timeStart.Format(time.RFC3339), "duration": duration, "break": 0})
+	if w.Code != http.StatusOK {
+		t.Fatalf("create sprint: status %d %s", w.Code, w.Body.String())
+	}
+	return w.Header().Get("Location")
+}
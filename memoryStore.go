@@ -0,0 +1,1518 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemoryStore is a Store keeping everything in memory, to run the API and its tests without a database.
+// It enforces the same constraints as the database schema, and is seeded with the same roles.
+// Its methods never block, so they ignore their context.
+type MemoryStore struct {
+	mu sync.Mutex
+
+	// inTx whether the store is the view of a transaction, whose parent store is locked
+	inTx bool
+
+	memoryTables
+}
+
+// memoryTables holds the rows of a MemoryStore
+type memoryTables struct {
+	// ids the last ID used in each table
+	ids map[string]int
+
+	users                map[int]*memoryUser
+	roles                map[int]*memoryRole
+	userRoles            map[int]map[int]bool
+	recoveryCodes        map[int]map[string]bool // user ID, code hash: used
+	accessTokens         map[string]AccessToken
+	refreshTokens        map[string]RefreshToken
+	personalAccessTokens map[int]PersonalAccessToken
+	emailTokens          map[string]EmailToken
+	loginAttempts        map[string]*memoryLoginAttempt
+	projects             map[int]Project
+	sprints              map[int]Sprint
+	invites              map[int]Invite             // host sprint ID: invite
+	guests               map[int]memoryGuest        // guest sprint ID: link to the host
+	restDays             map[int]map[time.Time]bool // user ID, date
+}
+
+// MemoryStore must implement every method of Store
+var _ Store = &MemoryStore{}
+
+// memoryUser is a user row
+type memoryUser struct {
+	user         User
+	passwordHash string
+	passwordSalt string
+	totp         TOTPSettings
+}
+
+// memoryRole is a role and the scopes it grants
+type memoryRole struct {
+	role   Role
+	scopes Scopes
+}
+
+// memoryLoginAttempt is a login_attempts row
+type memoryLoginAttempt struct {
+	failures      int
+	lastFailureAt time.Time
+	lockedUntil   time.Time
+}
+
+// memoryGuest is a guest_sprints row
+type memoryGuest struct {
+	hostSprintID int
+	userID       int
+}
+
+// NewMemoryStore returns an empty store with the writer and admin roles
+func NewMemoryStore() *MemoryStore {
+	store := &MemoryStore{memoryTables: memoryTables{
+		ids:                  map[string]int{},
+		users:                map[int]*memoryUser{},
+		roles:                map[int]*memoryRole{},
+		userRoles:            map[int]map[int]bool{},
+		recoveryCodes:        map[int]map[string]bool{},
+		accessTokens:         map[string]AccessToken{},
+		refreshTokens:        map[string]RefreshToken{},
+		personalAccessTokens: map[int]PersonalAccessToken{},
+		emailTokens:          map[string]EmailToken{},
+		loginAttempts:        map[string]*memoryLoginAttempt{},
+		projects:             map[int]Project{},
+		sprints:              map[int]Sprint{},
+		invites:              map[int]Invite{},
+		guests:               map[int]memoryGuest{},
+		restDays:             map[int]map[time.Time]bool{},
+	}}
+
+	store.addRole("writer", Scopes{"basic", "read", "sprints:write"})
+	store.addRole("admin", Scopes{"basic", "read", "sprints:write", "admin"})
+
+	return store
+}
+
+// errMemoryConstraint is returned when a write would violate a constraint of the database schema
+var errMemoryConstraint = errors.New("MemoryStore: constraint violation")
+
+// nextID returns a new ID for the table
+func (store *MemoryStore) nextID(table string) int {
+	store.ids[table]++
+	return store.ids[table]
+}
+
+// addRole adds a role granting the given scopes
+func (store *MemoryStore) addRole(name string, scopes Scopes) {
+	id := store.nextID("roles")
+	store.roles[id] = &memoryRole{role: Role{ID: id, Name: name}, scopes: scopes}
+}
+
+// Close does nothing
+func (store *MemoryStore) Close() error {
+	return nil
+}
+
+// Transaction runs fn with a view of the store whose writes are undone if it returns an error.
+// The store is locked until fn returns, so fn must only use the view. Within a transaction, fn joins it.
+func (store *MemoryStore) Transaction(ctx context.Context, fn func(tx Store) error) error {
+	if store.inTx {
+		return fn(store)
+	}
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	snapshot := store.memoryTables.clone()
+	if err := fn(&MemoryStore{inTx: true, memoryTables: store.memoryTables}); err != nil {
+		store.memoryTables = snapshot
+		return err
+	}
+	return nil
+}
+
+// clone returns a deep copy of the tables
+func (tables memoryTables) clone() memoryTables {
+	c := memoryTables{
+		ids:                  map[string]int{},
+		users:                map[int]*memoryUser{},
+		roles:                map[int]*memoryRole{},
+		userRoles:            map[int]map[int]bool{},
+		recoveryCodes:        map[int]map[string]bool{},
+		accessTokens:         map[string]AccessToken{},
+		refreshTokens:        map[string]RefreshToken{},
+		personalAccessTokens: map[int]PersonalAccessToken{},
+		emailTokens:          map[string]EmailToken{},
+		loginAttempts:        map[string]*memoryLoginAttempt{},
+		projects:             map[int]Project{},
+		sprints:              map[int]Sprint{},
+		invites:              map[int]Invite{},
+		guests:               map[int]memoryGuest{},
+		restDays:             map[int]map[time.Time]bool{},
+	}
+
+	for table, id := range tables.ids {
+		c.ids[table] = id
+	}
+	for id, mu := range tables.users {
+		user := *mu
+		c.users[id] = &user
+	}
+	for id, mr := range tables.roles {
+		role := *mr
+		role.scopes = append(Scopes{}, mr.scopes...)
+		c.roles[id] = &role
+	}
+	for userID, roleIDs := range tables.userRoles {
+		c.userRoles[userID] = map[int]bool{}
+		for roleID, ok := range roleIDs {
+			c.userRoles[userID][roleID] = ok
+		}
+	}
+	for userID, codes := range tables.recoveryCodes {
+		c.recoveryCodes[userID] = map[string]bool{}
+		for hash, used := range codes {
+			c.recoveryCodes[userID][hash] = used
+		}
+	}
+	for id, t := range tables.accessTokens {
+		c.accessTokens[id] = t
+	}
+	for id, rt := range tables.refreshTokens {
+		c.refreshTokens[id] = rt
+	}
+	for id, t := range tables.personalAccessTokens {
+		c.personalAccessTokens[id] = t
+	}
+	for id, t := range tables.emailTokens {
+		c.emailTokens[id] = t
+	}
+	for key, attempt := range tables.loginAttempts {
+		a := *attempt
+		c.loginAttempts[key] = &a
+	}
+	for id, p := range tables.projects {
+		c.projects[id] = p
+	}
+	for id, sp := range tables.sprints {
+		c.sprints[id] = sp
+	}
+	for id, invite := range tables.invites {
+		c.invites[id] = invite
+	}
+	for id, guest := range tables.guests {
+		c.guests[id] = guest
+	}
+	for userID, dates := range tables.restDays {
+		c.restDays[userID] = map[time.Time]bool{}
+		for date := range dates {
+			c.restDays[userID][date] = true
+		}
+	}
+
+	return c
+}
+
+// InsertUser inserts a new user with the given password hash and returns it
+func (store *MemoryStore) InsertUser(ctx context.Context, username, passwordHash string) (*User, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	for _, mu := range store.users {
+		if mu.user.Username == username {
+			return nil, errMemoryConstraint
+		}
+	}
+
+	u := User{ID: store.nextID("users"), Username: username, Timezone: defaultTimezone, Locale: defaultLocale}
+	store.users[u.ID] = &memoryUser{user: u, passwordHash: passwordHash}
+	return &u, nil
+}
+
+// GetPasswordHash returns the password hash of the user, and its salt for legacy hashes
+func (store *MemoryStore) GetPasswordHash(ctx context.Context, u *User) (passwordHash, passwordSalt string, err error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	mu, ok := store.users[u.ID]
+	if !ok {
+		return "", "", sql.ErrNoRows
+	}
+	return mu.passwordHash, mu.passwordSalt, nil
+}
+
+// UpdatePasswordHash replaces the password hash of the user, dropping any legacy salt
+func (store *MemoryStore) UpdatePasswordHash(ctx context.Context, u *User, passwordHash string) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	if mu, ok := store.users[u.ID]; ok {
+		mu.passwordHash = passwordHash
+		mu.passwordSalt = ""
+	}
+	return nil
+}
+
+// UserExistsWithUsername returns true if a user could be found with such username
+func (store *MemoryStore) UserExistsWithUsername(ctx context.Context, username string) bool {
+	_, err := store.GetUserByUsername(ctx, username)
+	return err == nil
+}
+
+// UserExistsWithID returns true if a user could be found with such ID
+func (store *MemoryStore) UserExistsWithID(ctx context.Context, id int) bool {
+	_, err := store.GetUserByID(ctx, id)
+	return err == nil
+}
+
+// GetUserByUsername returns the user with the given username
+func (store *MemoryStore) GetUserByUsername(ctx context.Context, username string) (*User, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	for _, mu := range store.users {
+		if mu.user.Username == username {
+			u := mu.user
+			return &u, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+// GetUserByID returns the user with the given ID
+func (store *MemoryStore) GetUserByID(ctx context.Context, id int) (*User, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	mu, ok := store.users[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	u := mu.user
+	return &u, nil
+}
+
+// GetUserByEmail returns the user with the given verified email address, case insensitive
+func (store *MemoryStore) GetUserByEmail(ctx context.Context, email string) (*User, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	for _, mu := range store.users {
+		if mu.user.EmailVerified && strings.EqualFold(mu.user.Email, email) {
+			u := mu.user
+			return &u, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+// GetUsers returns all users by ID
+func (store *MemoryStore) GetUsers(ctx context.Context) ([]*User, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	users := []*User{}
+	for _, mu := range store.users {
+		u := mu.user
+		users = append(users, &u)
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].ID < users[j].ID })
+	return users, nil
+}
+
+// DeleteUser deletes a user along with their credentials and tokens.
+// Fails if the user still has projects.
+func (store *MemoryStore) DeleteUser(ctx context.Context, user *User) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	for _, p := range store.projects {
+		if p.UserID == user.ID {
+			return errMemoryConstraint
+		}
+	}
+
+	delete(store.users, user.ID)
+	delete(store.userRoles, user.ID)
+	delete(store.recoveryCodes, user.ID)
+	delete(store.restDays, user.ID)
+	for id, t := range store.accessTokens {
+		if t.UserID == user.ID {
+			delete(store.accessTokens, id)
+		}
+	}
+	for id, rt := range store.refreshTokens {
+		if rt.UserID == user.ID {
+			delete(store.refreshTokens, id)
+		}
+	}
+	for id, t := range store.personalAccessTokens {
+		if t.UserID == user.ID {
+			delete(store.personalAccessTokens, id)
+		}
+	}
+	for id, t := range store.emailTokens {
+		if t.UserID == user.ID {
+			delete(store.emailTokens, id)
+		}
+	}
+	return nil
+}
+
+// UpdateUserEmail sets the email address of the user, unverified.
+// Fails if another user has the same address.
+func (store *MemoryStore) UpdateUserEmail(ctx context.Context, u *User, email string) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	if mu, ok := store.users[u.ID]; ok {
+		mu.user.Email = email
+		mu.user.EmailVerified = false
+	}
+	return nil
+}
+
+// UpdateUserEmailVerified sets whether the user’s email address is verified, ErrEmailTaken if another user verified it
+func (store *MemoryStore) UpdateUserEmailVerified(ctx context.Context, u *User, verified bool) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	mu, ok := store.users[u.ID]
+	if !ok {
+		return nil
+	}
+	if verified && mu.user.Email != "" {
+		for id, other := range store.users {
+			if id != u.ID && other.user.EmailVerified && strings.EqualFold(other.user.Email, mu.user.Email) {
+				return ErrEmailTaken
+			}
+		}
+	}
+	mu.user.EmailVerified = verified
+	return nil
+}
+
+// DeleteUnverifiedEmails removes the user’s email address from the other users who did not verify it
+func (store *MemoryStore) DeleteUnverifiedEmails(ctx context.Context, u *User) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	for id, mu := range store.users {
+		if id != u.ID && !mu.user.EmailVerified && strings.EqualFold(mu.user.Email, u.Email) {
+			mu.user.Email = ""
+		}
+	}
+	return nil
+}
+
+// UpdateUserTimezone sets the IANA name of the user’s time zone
+func (store *MemoryStore) UpdateUserTimezone(ctx context.Context, u *User, timezone string) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	if mu, ok := store.users[u.ID]; ok {
+		mu.user.Timezone = timezone
+	}
+	return nil
+}
+
+// UpdateUserLocale sets the BCP 47 tag of the user’s locale
+func (store *MemoryStore) UpdateUserLocale(ctx context.Context, u *User, locale string) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	if mu, ok := store.users[u.ID]; ok {
+		mu.user.Locale = locale
+	}
+	return nil
+}
+
+// GetTOTPSettings returns the second factor settings of the user
+func (store *MemoryStore) GetTOTPSettings(ctx context.Context, u *User) (*TOTPSettings, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	mu, ok := store.users[u.ID]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	settings := mu.totp
+	return &settings, nil
+}
+
+// UpdateTOTPSecret sets a new pending TOTP secret for the user, returns false if TOTP is already enabled
+func (store *MemoryStore) UpdateTOTPSecret(ctx context.Context, u *User, secret string) (bool, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	mu, ok := store.users[u.ID]
+	if !ok || mu.totp.Enabled {
+		return false, nil
+	}
+	mu.totp.Secret = secret
+	mu.totp.LastStep = 0
+	return true, nil
+}
+
+// EnableTOTP enables the pending TOTP secret of the user, the given step being the first one used
+func (store *MemoryStore) EnableTOTP(ctx context.Context, u *User, step int64) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	if mu, ok := store.users[u.ID]; ok {
+		mu.totp.Enabled = true
+		mu.totp.LastStep = step
+	}
+	return nil
+}
+
+// DisableTOTP removes the user’s TOTP secret and recovery codes
+func (store *MemoryStore) DisableTOTP(ctx context.Context, u *User) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	if mu, ok := store.users[u.ID]; ok {
+		mu.totp = TOTPSettings{}
+	}
+	delete(store.recoveryCodes, u.ID)
+	return nil
+}
+
+// UpdateTOTPLastStep records the step of an accepted code, returns false if this or a later step was already used
+func (store *MemoryStore) UpdateTOTPLastStep(ctx context.Context, u *User, step int64) (bool, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	mu, ok := store.users[u.ID]
+	if !ok || mu.totp.LastStep >= step {
+		return false, nil
+	}
+	mu.totp.LastStep = step
+	return true, nil
+}
+
+// ReplaceRecoveryCodes replaces the user’s recovery codes with the given hashes
+func (store *MemoryStore) ReplaceRecoveryCodes(ctx context.Context, u *User, hashes []string) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	if _, ok := store.users[u.ID]; !ok {
+		return errMemoryConstraint
+	}
+
+	codes := map[string]bool{}
+	for _, hash := range hashes {
+		codes[hash] = false
+	}
+	store.recoveryCodes[u.ID] = codes
+	return nil
+}
+
+// UseRecoveryCode marks the user’s recovery code with the given hash as used, returns false if there is no such unused code
+func (store *MemoryStore) UseRecoveryCode(ctx context.Context, u *User, hash string) (bool, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	used, ok := store.recoveryCodes[u.ID][hash]
+	if !ok || used {
+		return false, nil
+	}
+	store.recoveryCodes[u.ID][hash] = true
+	return true, nil
+}
+
+// GetRoleByName returns the role with the given name
+func (store *MemoryStore) GetRoleByName(ctx context.Context, name string) (*Role, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	for _, mr := range store.roles {
+		if mr.role.Name == name {
+			r := mr.role
+			return &r, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+// GetUserRoles returns the roles granted to the user, by name
+func (store *MemoryStore) GetUserRoles(ctx context.Context, u *User) ([]*Role, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	roles := []*Role{}
+	for id := range store.userRoles[u.ID] {
+		r := store.roles[id].role
+		roles = append(roles, &r)
+	}
+	sort.Slice(roles, func(i, j int) bool { return roles[i].Name < roles[j].Name })
+	return roles, nil
+}
+
+// GetUserScopes returns the scopes granted to the user by all of their roles, sorted
+func (store *MemoryStore) GetUserScopes(ctx context.Context, u *User) (Scopes, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	scopes := Scopes{}
+	for id := range store.userRoles[u.ID] {
+		for _, scope := range store.roles[id].scopes {
+			if !scopes.Has(scope) {
+				scopes = append(scopes, scope)
+			}
+		}
+	}
+	sort.Strings(scopes)
+	return scopes, nil
+}
+
+// AddUserRole grants a role to the user, does nothing if it already was
+func (store *MemoryStore) AddUserRole(ctx context.Context, u *User, role *Role) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	if _, ok := store.users[u.ID]; !ok {
+		return errMemoryConstraint
+	}
+	if _, ok := store.roles[role.ID]; !ok {
+		return errMemoryConstraint
+	}
+
+	if store.userRoles[u.ID] == nil {
+		store.userRoles[u.ID] = map[int]bool{}
+	}
+	store.userRoles[u.ID][role.ID] = true
+	return nil
+}
+
+// RemoveUserRole revokes a role from the user
+func (store *MemoryStore) RemoveUserRole(ctx context.Context, u *User, role *Role) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	delete(store.userRoles[u.ID], role.ID)
+	return nil
+}
+
+// InsertAccessToken records an access token
+func (store *MemoryStore) InsertAccessToken(ctx context.Context, t *AccessToken) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	if _, ok := store.users[t.UserID]; !ok {
+		return errMemoryConstraint
+	}
+	if _, ok := store.accessTokens[t.ID]; ok {
+		return errMemoryConstraint
+	}
+
+	stored := *t
+	stored.Current = false
+	store.accessTokens[t.ID] = stored
+	return nil
+}
+
+// DeleteExpiredAccessTokens deletes the user’s access tokens expired before the given time
+func (store *MemoryStore) DeleteExpiredAccessTokens(ctx context.Context, u *User, before time.Time) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	for id, t := range store.accessTokens {
+		if t.UserID == u.ID && t.ExpiresAt.Before(before) {
+			delete(store.accessTokens, id)
+		}
+	}
+	return nil
+}
+
+// GetAccessTokenByID returns the unexpired access token with the given ID
+func (store *MemoryStore) GetAccessTokenByID(ctx context.Context, id string) (*AccessToken, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	t, ok := store.accessTokens[id]
+	if !ok || t.ExpiresAt.Before(time.Now()) {
+		return nil, sql.ErrNoRows
+	}
+	return &t, nil
+}
+
+// GetUserAccessTokens returns the unexpired access tokens of the user, most recent first
+func (store *MemoryStore) GetUserAccessTokens(ctx context.Context, u *User) ([]*AccessToken, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	now := time.Now()
+	tokens := []*AccessToken{}
+	for _, t := range store.accessTokens {
+		if t.UserID == u.ID && !t.ExpiresAt.Before(now) {
+			t := t
+			tokens = append(tokens, &t)
+		}
+	}
+	sort.Slice(tokens, func(i, j int) bool { return tokens[i].IssuedAt.After(tokens[j].IssuedAt) })
+	return tokens, nil
+}
+
+// DeleteAccessToken deletes the access token
+func (store *MemoryStore) DeleteAccessToken(ctx context.Context, t *AccessToken) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	delete(store.accessTokens, t.ID)
+	return nil
+}
+
+// DeleteUserTokens deletes all access and refresh tokens of the user
+func (store *MemoryStore) DeleteUserTokens(ctx context.Context, u *User) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	for id, t := range store.accessTokens {
+		if t.UserID == u.ID {
+			delete(store.accessTokens, id)
+		}
+	}
+	for id, rt := range store.refreshTokens {
+		if rt.UserID == u.ID {
+			delete(store.refreshTokens, id)
+		}
+	}
+	return nil
+}
+
+// InsertRefreshToken records a refresh token
+func (store *MemoryStore) InsertRefreshToken(ctx context.Context, rt *RefreshToken) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	if _, ok := store.users[rt.UserID]; !ok {
+		return errMemoryConstraint
+	}
+	if _, ok := store.refreshTokens[rt.ID]; ok {
+		return errMemoryConstraint
+	}
+
+	store.refreshTokens[rt.ID] = *rt
+	return nil
+}
+
+// GetRefreshTokenByID returns the unexpired refresh token with the given ID
+func (store *MemoryStore) GetRefreshTokenByID(ctx context.Context, id string) (*RefreshToken, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	rt, ok := store.refreshTokens[id]
+	if !ok || rt.ExpiresAt.Before(time.Now()) {
+		return nil, sql.ErrNoRows
+	}
+	return &rt, nil
+}
+
+// UseRefreshToken marks the refresh token as exchanged, returns ErrRefreshTokenReused if it already was
+func (store *MemoryStore) UseRefreshToken(ctx context.Context, rt *RefreshToken) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	stored, ok := store.refreshTokens[rt.ID]
+	if !ok || stored.Used {
+		return ErrRefreshTokenReused
+	}
+	stored.Used = true
+	store.refreshTokens[rt.ID] = stored
+
+	rt.Used = true
+	return nil
+}
+
+// DeleteTokenFamily deletes all refresh and access tokens in the given family
+func (store *MemoryStore) DeleteTokenFamily(ctx context.Context, familyID string) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	for id, rt := range store.refreshTokens {
+		if rt.FamilyID == familyID {
+			delete(store.refreshTokens, id)
+		}
+	}
+	for id, t := range store.accessTokens {
+		if t.FamilyID == familyID {
+			delete(store.accessTokens, id)
+		}
+	}
+	return nil
+}
+
+// InsertPersonalAccessToken records a personal access token and sets its ID
+func (store *MemoryStore) InsertPersonalAccessToken(ctx context.Context, t *PersonalAccessToken) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	if _, ok := store.users[t.UserID]; !ok {
+		return errMemoryConstraint
+	}
+	for _, other := range store.personalAccessTokens {
+		if other.TokenHash == t.TokenHash {
+			return errMemoryConstraint
+		} else if other.UserID == t.UserID && other.Name == t.Name {
+			return ErrTokenNameTaken
+		}
+	}
+
+	t.ID = store.nextID("personal_access_tokens")
+	store.personalAccessTokens[t.ID] = *t
+	return nil
+}
+
+// UsePersonalAccessToken returns the unexpired personal access token with the given hash and records its use
+func (store *MemoryStore) UsePersonalAccessToken(ctx context.Context, tokenHash string) (*PersonalAccessToken, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	now := time.Now().UTC()
+	for id, t := range store.personalAccessTokens {
+		if t.TokenHash == tokenHash && (t.ExpiresAt == nil || !t.ExpiresAt.Before(now)) {
+			t.LastUsedAt = &now
+			store.personalAccessTokens[id] = t
+			return &t, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+// GetPersonalAccessTokenByID returns the personal access token with the given ID
+func (store *MemoryStore) GetPersonalAccessTokenByID(ctx context.Context, id int) (*PersonalAccessToken, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	t, ok := store.personalAccessTokens[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return &t, nil
+}
+
+// GetUserPersonalAccessTokens returns the personal access tokens of the user, by name
+func (store *MemoryStore) GetUserPersonalAccessTokens(ctx context.Context, u *User) ([]*PersonalAccessToken, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	tokens := []*PersonalAccessToken{}
+	for _, t := range store.personalAccessTokens {
+		if t.UserID == u.ID {
+			t := t
+			tokens = append(tokens, &t)
+		}
+	}
+	sort.Slice(tokens, func(i, j int) bool { return tokens[i].Name < tokens[j].Name })
+	return tokens, nil
+}
+
+// DeletePersonalAccessToken revokes the personal access token
+func (store *MemoryStore) DeletePersonalAccessToken(ctx context.Context, t *PersonalAccessToken) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	delete(store.personalAccessTokens, t.ID)
+	return nil
+}
+
+// DeleteUserPersonalAccessTokens revokes all personal access tokens of the user
+func (store *MemoryStore) DeleteUserPersonalAccessTokens(ctx context.Context, u *User) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	for id, t := range store.personalAccessTokens {
+		if t.UserID == u.ID {
+			delete(store.personalAccessTokens, id)
+		}
+	}
+	return nil
+}
+
+// InsertEmailToken records an email token
+func (store *MemoryStore) InsertEmailToken(ctx context.Context, t *EmailToken) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	if _, ok := store.users[t.UserID]; !ok {
+		return errMemoryConstraint
+	}
+	if _, ok := store.emailTokens[t.ID]; ok {
+		return errMemoryConstraint
+	}
+
+	store.emailTokens[t.ID] = *t
+	return nil
+}
+
+// UseEmailToken deletes the unexpired email token with the given ID and purpose and returns it
+func (store *MemoryStore) UseEmailToken(ctx context.Context, id, purpose string) (*EmailToken, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	t, ok := store.emailTokens[id]
+	if !ok || t.Purpose != purpose || t.ExpiresAt.Before(time.Now()) {
+		return nil, sql.ErrNoRows
+	}
+	delete(store.emailTokens, id)
+	return &t, nil
+}
+
+// DeleteUserEmailTokens deletes the user’s email tokens for the given purpose
+func (store *MemoryStore) DeleteUserEmailTokens(ctx context.Context, u *User, purpose string) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	for id, t := range store.emailTokens {
+		if t.UserID == u.ID && t.Purpose == purpose {
+			delete(store.emailTokens, id)
+		}
+	}
+	return nil
+}
+
+// GetLoginLockout returns the latest time until which one of the keys is locked out, the zero time if none is
+func (store *MemoryStore) GetLoginLockout(ctx context.Context, keys ...string) (time.Time, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	var lockedUntil time.Time
+	for _, key := range keys {
+		if a, ok := store.loginAttempts[key]; ok && a.lockedUntil.After(lockedUntil) {
+			lockedUntil = a.lockedUntil
+		}
+	}
+	return lockedUntil, nil
+}
+
+// RecordLoginFailure records a failure for the key and returns the number of consecutive failures,
+// starting over if the previous failure happened before resetBefore
+func (store *MemoryStore) RecordLoginFailure(ctx context.Context, key string, at, resetBefore time.Time) (int, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	a, ok := store.loginAttempts[key]
+	if !ok {
+		a = &memoryLoginAttempt{}
+		store.loginAttempts[key] = a
+	}
+	if a.lastFailureAt.Before(resetBefore) {
+		a.failures = 1
+	} else {
+		a.failures++
+	}
+	a.lastFailureAt = at
+	return a.failures, nil
+}
+
+// LockLogin locks the key out until the given time
+func (store *MemoryStore) LockLogin(ctx context.Context, key string, until time.Time) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	if a, ok := store.loginAttempts[key]; ok {
+		a.lockedUntil = until
+	}
+	return nil
+}
+
+// DeleteLoginAttempts forgets the failures recorded for the key
+func (store *MemoryStore) DeleteLoginAttempts(ctx context.Context, key string) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	delete(store.loginAttempts, key)
+	return nil
+}
+
+// GetUserProjects returns a user’s projects ordered by name
+func (store *MemoryStore) GetUserProjects(ctx context.Context, u *User) ([]*Project, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	projects := []*Project{}
+	for _, p := range store.projects {
+		if p.UserID == u.ID {
+			p := p
+			projects = append(projects, &p)
+		}
+	}
+	sort.Slice(projects, func(i, j int) bool { return projects[i].Name < projects[j].Name })
+	return projects, nil
+}
+
+// GetProjectByID returns the project with the given ID
+func (store *MemoryStore) GetProjectByID(ctx context.Context, id int) (*Project, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	p, ok := store.projects[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return &p, nil
+}
+
+// GetProjectBySlug returns the project with the given slug belonging to the given user
+func (store *MemoryStore) GetProjectBySlug(ctx context.Context, u *User, slug string) (*Project, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	for _, p := range store.projects {
+		if p.UserID == u.ID && p.Slug == slug {
+			return &p, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+// InsertProject inserts a new project and sets its ID
+func (store *MemoryStore) InsertProject(ctx context.Context, p *Project) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	if _, ok := store.users[p.UserID]; !ok {
+		return errMemoryConstraint
+	}
+	for _, other := range store.projects {
+		if other.UserID == p.UserID && other.Slug == p.Slug {
+			return errMemoryConstraint
+		}
+	}
+
+	p.ID = store.nextID("projects")
+	stored := *p
+	stored.Sprints = nil
+	store.projects[p.ID] = stored
+	return nil
+}
+
+// UpdateProject saves an existing project
+func (store *MemoryStore) UpdateProject(ctx context.Context, p *Project) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	if _, ok := store.projects[p.ID]; !ok {
+		return nil
+	}
+	for _, other := range store.projects {
+		if other.ID != p.ID && other.UserID == p.UserID && other.Slug == p.Slug {
+			return errMemoryConstraint
+		}
+	}
+
+	stored := *p
+	stored.Sprints = nil
+	store.projects[p.ID] = stored
+	return nil
+}
+
+// DeleteProject deletes a project along with all of the sprints on it.
+// Fails if one of them is open to guests.
+func (store *MemoryStore) DeleteProject(ctx context.Context, p *Project) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	for id, s := range store.sprints {
+		if s.ProjectID == p.ID {
+			store.deleteSprint(id)
+		}
+	}
+	delete(store.projects, p.ID)
+	return nil
+}
+
+// sprintWithDetails returns a copy of the stored sprint with the fields of the sprints_with_details view
+func (store *MemoryStore) sprintWithDetails(s Sprint) *Sprint {
+	p := store.projects[s.ProjectID]
+	s.ProjectSlug = p.Slug
+	if mu, ok := store.users[p.UserID]; ok {
+		s.Username = mu.user.Username
+	}
+	if invite, ok := store.invites[s.ID]; ok && invite.IsOpen() {
+		s.InviteSlug = invite.Slug
+		s.InviteComment = invite.Comment
+	}
+	return &s
+}
+
+// projectSprints returns the sprints on the project matching the filter, earliest first
+func (store *MemoryStore) projectSprints(projectID int, filter func(Sprint) bool) []Sprint {
+	sprints := []Sprint{}
+	for _, s := range store.sprints {
+		if s.ProjectID == projectID && filter(s) {
+			sprints = append(sprints, s)
+		}
+	}
+	sort.Slice(sprints, func(i, j int) bool { return sprints[i].TimeStart.Before(sprints[j].TimeStart) })
+	return sprints
+}
+
+// GetProjectSprints returns the sprints on a given project, latest first
+func (store *MemoryStore) GetProjectSprints(ctx context.Context, p *Project) ([]*Sprint, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	sprints := []*Sprint{}
+	all := store.projectSprints(p.ID, func(Sprint) bool { return true })
+	for i := len(all) - 1; i >= 0; i-- {
+		sprints = append(sprints, store.sprintWithDetails(all[i]))
+	}
+	return sprints, nil
+}
+
+// GetProjectSprintsBetween returns the sprints on the project starting in [from, to), earliest first
+func (store *MemoryStore) GetProjectSprintsBetween(ctx context.Context, p *Project, from, to time.Time) ([]*Sprint, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	sprints := []*Sprint{}
+	for _, s := range store.projectSprints(p.ID, func(s Sprint) bool { return !s.TimeStart.Before(from) && s.TimeStart.Before(to) }) {
+		sprints = append(sprints, store.sprintWithDetails(s))
+	}
+	return sprints, nil
+}
+
+// SumProjectWordCount returns the words written during the sprints on the project starting before the given time
+func (store *MemoryStore) SumProjectWordCount(ctx context.Context, p *Project, before time.Time) (int, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	wordCount := 0
+	for _, s := range store.projectSprints(p.ID, func(s Sprint) bool { return s.TimeStart.Before(before) }) {
+		wordCount += s.WordCount
+	}
+	return wordCount, nil
+}
+
+// GetSprintByID returns the sprint with the given ID
+func (store *MemoryStore) GetSprintByID(ctx context.Context, id int) (*Sprint, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	s, ok := store.sprints[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return store.sprintWithDetails(s), nil
+}
+
+// GetSprintBySlug returns the sprint with the given slug
+func (store *MemoryStore) GetSprintBySlug(ctx context.Context, slug string) (*Sprint, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	for _, s := range store.sprints {
+		if s.Slug == slug {
+			return store.sprintWithDetails(s), nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+// GetSprintByInviteSlug returns the sprint open to guests with the given invite slug
+func (store *MemoryStore) GetSprintByInviteSlug(ctx context.Context, inviteSlug string) (*Sprint, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	for id, invite := range store.invites {
+		if invite.Slug == inviteSlug && invite.IsOpen() {
+			return store.sprintWithDetails(store.sprints[id]), nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+// storedSprint returns the columns of the sprints table, times being stored to the second like in the database
+func storedSprint(s *Sprint) Sprint {
+	return Sprint{
+		ID:          s.ID,
+		Slug:        s.Slug,
+		ProjectID:   s.ProjectID,
+		TimeStart:   s.TimeStart.UTC().Truncate(time.Second),
+		Duration:    s.Duration,
+		WordCount:   s.WordCount,
+		Break:       s.Break,
+		IsMilestone: s.IsMilestone,
+		Comment:     s.Comment,
+		CreatedAt:   s.CreatedAt.UTC().Truncate(time.Microsecond),
+		UpdatedAt:   s.UpdatedAt.UTC().Truncate(time.Microsecond),
+	}
+}
+
+// InsertSprint inserts a new sprint and sets its ID and creation time
+func (store *MemoryStore) InsertSprint(ctx context.Context, s *Sprint) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	if _, ok := store.projects[s.ProjectID]; !ok {
+		return errMemoryConstraint
+	}
+	for _, other := range store.sprints {
+		if other.Slug == s.Slug {
+			return errMemoryConstraint
+		}
+	}
+
+	s.ID = store.nextID("sprints")
+	s.CreatedAt = time.Now().UTC().Truncate(time.Microsecond)
+	s.UpdatedAt = s.CreatedAt
+	store.sprints[s.ID] = storedSprint(s)
+	return nil
+}
+
+// UpdateSprint saves an existing sprint, except for its slug, project and creation time, and sets its update time
+func (store *MemoryStore) UpdateSprint(ctx context.Context, s *Sprint) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	stored, ok := store.sprints[s.ID]
+	if !ok {
+		return nil
+	}
+
+	s.UpdatedAt = time.Now().UTC().Truncate(time.Microsecond)
+	updated := storedSprint(s)
+	updated.Slug = stored.Slug
+	updated.ProjectID = stored.ProjectID
+	updated.CreatedAt = stored.CreatedAt
+	store.sprints[s.ID] = updated
+	return nil
+}
+
+// DeleteSprint removes a sprint.
+// Fails if it is open to guests.
+func (store *MemoryStore) DeleteSprint(ctx context.Context, s *Sprint) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	store.deleteSprint(s.ID)
+	return nil
+}
+
+// deleteSprint deletes the sprint with its invite and guest links, the sprints of its guests remain.
+// Must be called with the store locked.
+func (store *MemoryStore) deleteSprint(id int) {
+	delete(store.sprints, id)
+	delete(store.guests, id)
+	delete(store.invites, id)
+	for guestID, g := range store.guests {
+		if g.hostSprintID == id {
+			delete(store.guests, guestID)
+		}
+	}
+}
+
+// GetNextSprint returns the first sprint on the same project starting after the end of the given one
+func (store *MemoryStore) GetNextSprint(ctx context.Context, s *Sprint) (*Sprint, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	timeEnd := s.TimeEnd()
+	next := store.projectSprints(s.ProjectID, func(other Sprint) bool { return other.TimeStart.After(timeEnd) })
+	if len(next) == 0 {
+		return nil, sql.ErrNoRows
+	}
+	return store.sprintWithDetails(next[0]), nil
+}
+
+// CountMilestones returns the number of milestones on the sprint’s project up to and including the sprint
+func (store *MemoryStore) CountMilestones(ctx context.Context, s *Sprint) (int, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	milestones := store.projectSprints(s.ProjectID, func(other Sprint) bool {
+		return other.IsMilestone && !other.TimeStart.After(s.TimeStart)
+	})
+	return len(milestones), nil
+}
+
+// GetPreviousMilestone returns the last milestone before the sprint on its project, or nil if there is none
+func (store *MemoryStore) GetPreviousMilestone(ctx context.Context, s *Sprint) (*Sprint, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	if len(store.projectSprints(s.ProjectID, func(Sprint) bool { return true })) == 0 {
+		return nil, sql.ErrNoRows
+	}
+
+	milestones := store.projectSprints(s.ProjectID, func(other Sprint) bool {
+		return other.IsMilestone && other.TimeStart.Before(s.TimeStart)
+	})
+	if len(milestones) == 0 {
+		return nil, nil
+	}
+	return store.sprintWithDetails(milestones[len(milestones)-1]), nil
+}
+
+// SumSprints returns the word count and the duration in minutes of the sprints on the project of s
+// up to and including s, and after since if not nil, or -1 for both if there are no such sprints
+func (store *MemoryStore) SumSprints(ctx context.Context, s *Sprint, since *Sprint) (wordCount, duration int, err error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	sprints := store.projectSprints(s.ProjectID, func(other Sprint) bool {
+		return !other.TimeStart.After(s.TimeStart) && (since == nil || other.TimeStart.After(since.TimeStart))
+	})
+	if len(sprints) == 0 {
+		return -1, -1, nil
+	}
+
+	for _, other := range sprints {
+		wordCount += other.WordCount
+		duration += other.Duration
+	}
+	return wordCount, duration, nil
+}
+
+// GetProjectMilestones returns the milestones on the project with the words written and time spent since the previous one,
+// earliest first
+func (store *MemoryStore) GetProjectMilestones(ctx context.Context, p *Project) ([]*Milestone, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	sprints := store.projectSprints(p.ID, func(Sprint) bool { return true })
+	sort.Slice(sprints, func(i, j int) bool {
+		if !sprints[i].TimeStart.Equal(sprints[j].TimeStart) {
+			return sprints[i].TimeStart.Before(sprints[j].TimeStart)
+		}
+		return sprints[i].ID < sprints[j].ID
+	})
+
+	milestones := []*Milestone{}
+	wordCount, duration := 0, 0
+	for _, s := range sprints {
+		wordCount += s.WordCount
+		duration += s.Duration
+		if !s.IsMilestone {
+			continue
+		}
+
+		milestones = append(milestones, &Milestone{
+			Index:      len(milestones) + 1,
+			SprintSlug: s.Slug,
+			TimeStart:  s.TimeStart,
+			WordCount:  wordCount,
+			Duration:   duration,
+		})
+		wordCount, duration = 0, 0
+	}
+	return milestones, nil
+}
+
+// GetUserSprintsChangedSince returns the user’s sprints created, saved or whose break ends at or after the given time,
+// earliest first
+func (store *MemoryStore) GetUserSprintsChangedSince(ctx context.Context, u *User, since time.Time) ([]*Sprint, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	changed := []Sprint{}
+	for _, s := range store.sprints {
+		if store.projects[s.ProjectID].UserID == u.ID && (!s.UpdatedAt.Before(since) || !s.TimeBreakEnd().Before(since)) {
+			changed = append(changed, s)
+		}
+	}
+	sort.Slice(changed, func(i, j int) bool { return changed[i].TimeStart.Before(changed[j].TimeStart) })
+
+	sprints := make([]*Sprint, len(changed))
+	for i, s := range changed {
+		sprints[i] = store.sprintWithDetails(s)
+	}
+	return sprints, nil
+}
+
+// InsertGuestSprint links a guest sprint to the host sprint it joined, on behalf of the guest project’s user
+func (store *MemoryStore) InsertGuestSprint(ctx context.Context, guest, host *Sprint) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	stored, ok := store.sprints[guest.ID]
+	if !ok || stored.ID == host.ID {
+		return errMemoryConstraint
+	}
+	if _, ok := store.invites[host.ID]; !ok {
+		return errMemoryConstraint
+	}
+	if _, ok := store.guests[guest.ID]; ok {
+		return errMemoryConstraint
+	}
+	userID := store.projects[stored.ProjectID].UserID
+	for _, g := range store.guests {
+		if g.hostSprintID == host.ID && g.userID == userID {
+			return ErrSprintAlreadyJoined
+		}
+	}
+
+	store.guests[guest.ID] = memoryGuest{hostSprintID: host.ID, userID: userID}
+	return nil
+}
+
+// UserJoinedSprint returns true if one of the user’s sprints already joined the host sprint
+func (store *MemoryStore) UserJoinedSprint(ctx context.Context, userID int, host *Sprint) (bool, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	for _, g := range store.guests {
+		if g.hostSprintID == host.ID && g.userID == userID {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// GetGuestSprints returns the guest sprints of a host sprint, by username
+func (store *MemoryStore) GetGuestSprints(ctx context.Context, s *Sprint) ([]*Sprint, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	guestSprints := []*Sprint{}
+	for id, g := range store.guests {
+		if g.hostSprintID == s.ID {
+			guestSprints = append(guestSprints, store.sprintWithDetails(store.sprints[id]))
+		}
+	}
+	sort.Slice(guestSprints, func(i, j int) bool { return guestSprints[i].Username < guestSprints[j].Username })
+	return guestSprints, nil
+}
+
+// GetHostSprint returns the host sprint a guest sprint joined
+func (store *MemoryStore) GetHostSprint(ctx context.Context, guest *Sprint) (*Sprint, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	g, ok := store.guests[guest.ID]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return store.sprintWithDetails(store.sprints[g.hostSprintID]), nil
+}
+
+// InsertInvite opens a sprint to guests
+func (store *MemoryStore) InsertInvite(ctx context.Context, i *Invite) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	if _, ok := store.sprints[i.HostSprintID]; !ok {
+		return errMemoryConstraint
+	}
+	if _, ok := store.invites[i.HostSprintID]; ok {
+		return errMemoryConstraint
+	}
+	if !store.inviteSlugAvailable(i) {
+		return errMemoryConstraint
+	}
+
+	store.invites[i.HostSprintID] = *i
+	return nil
+}
+
+// inviteSlugAvailable returns true if no other invite, open or closed, uses the slug of i
+func (store *MemoryStore) inviteSlugAvailable(i *Invite) bool {
+	for id, other := range store.invites {
+		if id != i.HostSprintID && other.Slug == i.Slug {
+			return false
+		}
+	}
+	return true
+}
+
+// GetInvite returns the invite of the host sprint with the given ID, open or closed
+func (store *MemoryStore) GetInvite(ctx context.Context, hostSprintID int) (*Invite, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	i, ok := store.invites[hostSprintID]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return &i, nil
+}
+
+// GetInviteBySlug returns the open invite with the given slug
+func (store *MemoryStore) GetInviteBySlug(ctx context.Context, slug string) (*Invite, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	for _, i := range store.invites {
+		if i.Slug == slug && i.IsOpen() {
+			return &i, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+// UpdateInvite saves an existing invite
+func (store *MemoryStore) UpdateInvite(ctx context.Context, i *Invite) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	if _, ok := store.invites[i.HostSprintID]; !ok {
+		return nil
+	}
+	if !store.inviteSlugAvailable(i) {
+		return errMemoryConstraint
+	}
+
+	store.invites[i.HostSprintID] = *i
+	return nil
+}
+
+// CountGuestSprints returns the number of guest sprints of the host sprint with the given ID
+func (store *MemoryStore) CountGuestSprints(ctx context.Context, hostSprintID int) (int, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	n := 0
+	for _, g := range store.guests {
+		if g.hostSprintID == hostSprintID {
+			n++
+		}
+	}
+	return n, nil
+}
+
+// GetUserRestDays returns the user’s rest days from one date to another, both included, earliest first
+func (store *MemoryStore) GetUserRestDays(ctx context.Context, u *User, from, to time.Time) ([]time.Time, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	dates := []time.Time{}
+	for date := range store.restDays[u.ID] {
+		if !date.Before(from) && !date.After(to) {
+			dates = append(dates, date)
+		}
+	}
+	sort.Slice(dates, func(i, j int) bool { return dates[i].Before(dates[j]) })
+	return dates, nil
+}
+
+// InsertRestDay declares a rest day for the user, does nothing if it already was
+func (store *MemoryStore) InsertRestDay(ctx context.Context, u *User, date time.Time) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	if _, ok := store.users[u.ID]; !ok {
+		return errMemoryConstraint
+	}
+	if store.restDays[u.ID] == nil {
+		store.restDays[u.ID] = map[time.Time]bool{}
+	}
+	store.restDays[u.ID][LocalDate(date, time.UTC)] = true
+	return nil
+}
+
+// DeleteRestDay removes a rest day of the user, does nothing if there is none
+func (store *MemoryStore) DeleteRestDay(ctx context.Context, u *User, date time.Time) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	delete(store.restDays[u.ID], LocalDate(date, time.UTC))
+	return nil
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// recoveryCodesCount the number of recovery codes generated when enabling TOTP
+const recoveryCodesCount = 10
+
+// TOTPSettings holds a user’s second factor settings
+type TOTPSettings struct {
+	// Secret the base32 TOTP secret, empty if the user never enrolled
+	Secret string `db:"totp_secret"`
+
+	// Enabled whether the enrollment was confirmed and codes are required to authenticate
+	Enabled bool `db:"totp_enabled"`
+
+	// LastStep the last time step a code was accepted for, codes cannot be used twice
+	LastStep int64 `db:"totp_last_step"`
+}
+
+// hashRecoveryCode returns the hash under which a recovery code is stored
+func hashRecoveryCode(code string) string {
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(NormalizeRecoveryCode(code))))
+}
+
+// HasTOTP returns true if the user must provide a TOTP code to authenticate
+func (u *User) HasTOTP(ctx context.Context, store Store) (bool, error) {
+	settings, err := store.GetTOTPSettings(ctx, u)
+	if err != nil {
+		return false, err
+	}
+	return settings.Enabled, nil
+}
+
+// ErrTOTPEnabled is returned when enrolling a user who already has TOTP enabled
+var ErrTOTPEnabled = errors.New("TOTP already enabled")
+
+// ErrNoTOTPEnrollment is returned when confirming TOTP without a pending enrollment
+var ErrNoTOTPEnrollment = errors.New("no pending TOTP enrollment")
+
+// ErrInvalidTOTPCode is returned when confirming TOTP with a wrong code
+var ErrInvalidTOTPCode = errors.New("invalid TOTP code")
+
+// EnrollTOTP generates and stores a new TOTP secret for the user, to be confirmed with EnableTOTP.
+// Returns ErrTOTPEnabled if TOTP is already enabled.
+func (u *User) EnrollTOTP(ctx context.Context, store Store) (string, error) {
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		return "", err
+	}
+
+	if ok, err := store.UpdateTOTPSecret(ctx, u, secret); err != nil {
+		return "", err
+	} else if !ok {
+		return "", ErrTOTPEnabled
+	}
+
+	return secret, nil
+}
+
+// EnableTOTP confirms the enrollment with a code from the authenticator app
+// and returns freshly generated recovery codes, or ErrNoTOTPEnrollment or ErrInvalidTOTPCode
+func (u *User) EnableTOTP(ctx context.Context, store Store, code string) ([]string, error) {
+	settings, err := store.GetTOTPSettings(ctx, u)
+	if err != nil {
+		return nil, err
+	}
+	if settings.Enabled || settings.Secret == "" {
+		return nil, ErrNoTOTPEnrollment
+	}
+
+	step, ok := ValidateTOTP(settings.Secret, code, time.Now())
+	if !ok {
+		return nil, ErrInvalidTOTPCode
+	}
+
+	var codes []string
+	err = store.Transaction(ctx, func(tx Store) error {
+		if err := tx.EnableTOTP(ctx, u, step); err != nil {
+			return err
+		}
+
+		codes, err = u.RegenerateRecoveryCodes(ctx, tx)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+// CheckTOTP returns true if the code is valid for the user and was not used before
+func (u *User) CheckTOTP(ctx context.Context, store Store, code string) bool {
+	settings, err := store.GetTOTPSettings(ctx, u)
+	if err != nil || !settings.Enabled {
+		return false
+	}
+
+	step, ok := ValidateTOTP(settings.Secret, code, time.Now())
+	if !ok || step <= settings.LastStep {
+		return false
+	}
+
+	ok, err = store.UpdateTOTPLastStep(ctx, u, step)
+	return err == nil && ok
+}
+
+// RegenerateRecoveryCodes replaces the user’s recovery codes and returns the new ones.
+// Only their hashes are stored.
+func (u *User) RegenerateRecoveryCodes(ctx context.Context, store Store) ([]string, error) {
+	codes, err := GenerateRecoveryCodes(recoveryCodesCount)
+	if err != nil {
+		return nil, err
+	}
+
+	hashes := make([]string, len(codes))
+	for i, code := range codes {
+		hashes[i] = hashRecoveryCode(code)
+	}
+	if err := store.ReplaceRecoveryCodes(ctx, u, hashes); err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+// UseRecoveryCode returns true if the code is one of the user’s unused recovery codes, and marks it used
+func (u *User) UseRecoveryCode(ctx context.Context, store Store, code string) bool {
+	ok, err := store.UseRecoveryCode(ctx, u, hashRecoveryCode(code))
+	return err == nil && ok
+}
+
+// GetTOTPSettings returns the second factor settings of the user
+func (store *PostgresStore) GetTOTPSettings(ctx context.Context, u *User) (*TOTPSettings, error) {
+	settings := &TOTPSettings{}
+	if err := store.db.GetContext(ctx, settings, "select totp_secret, totp_enabled, totp_last_step from autochrone.users where id = $1", u.ID); err != nil {
+		return nil, err
+	}
+
+	return settings, nil
+}
+
+// UpdateTOTPSecret sets a new pending TOTP secret for the user.
+// Returns false if TOTP is already enabled.
+func (store *PostgresStore) UpdateTOTPSecret(ctx context.Context, u *User, secret string) (bool, error) {
+	res, err := store.db.ExecContext(ctx, "update autochrone.users set (totp_secret, totp_last_step) = ($1, 0) where id = $2 and not totp_enabled", secret, u.ID)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
+
+// EnableTOTP enables the pending TOTP secret of the user, the given step being the first one used
+func (store *PostgresStore) EnableTOTP(ctx context.Context, u *User, step int64) error {
+	_, err := store.db.ExecContext(ctx, "update autochrone.users set (totp_enabled, totp_last_step) = (true, $1) where id = $2", step, u.ID)
+	return err
+}
+
+// DisableTOTP removes the user’s TOTP secret and recovery codes
+func (store *PostgresStore) DisableTOTP(ctx context.Context, u *User) error {
+	return store.inTx(ctx, func(tx *PostgresStore) error {
+		if _, err := tx.db.ExecContext(ctx, "update autochrone.users set (totp_secret, totp_enabled, totp_last_step) = ('', false, 0) where id = $1", u.ID); err != nil {
+			return err
+		}
+
+		_, err := tx.db.ExecContext(ctx, "delete from autochrone.recovery_codes where user_id = $1", u.ID)
+		return err
+	})
+}
+
+// UpdateTOTPLastStep records the step of an accepted code.
+// Returns false if this or a later step was already used, so that only one concurrent request may use the step.
+func (store *PostgresStore) UpdateTOTPLastStep(ctx context.Context, u *User, step int64) (bool, error) {
+	res, err := store.db.ExecContext(ctx, "update autochrone.users set totp_last_step = $1 where id = $2 and totp_last_step < $1", step, u.ID)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
+
+// ReplaceRecoveryCodes replaces the user’s recovery codes with the given hashes
+func (store *PostgresStore) ReplaceRecoveryCodes(ctx context.Context, u *User, hashes []string) error {
+	return store.inTx(ctx, func(tx *PostgresStore) error {
+		if _, err := tx.db.ExecContext(ctx, "delete from autochrone.recovery_codes where user_id = $1", u.ID); err != nil {
+			return err
+		}
+		for _, hash := range hashes {
+			if _, err := tx.db.ExecContext(ctx, "insert into autochrone.recovery_codes (user_id, code_hash) values ($1, $2)", u.ID, hash); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// UseRecoveryCode marks the user’s recovery code with the given hash as used.
+// Returns false if there is no such unused code.
+func (store *PostgresStore) UseRecoveryCode(ctx context.Context, u *User, hash string) (bool, error) {
+	res, err := store.db.ExecContext(ctx, "update autochrone.recovery_codes set used_at = $1 where user_id = $2 and code_hash = $3 and used_at is null", time.Now().UTC(), u.ID, hash)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
@@ -3,14 +3,61 @@ package main
 import (
 	"github.com/gin-gonic/gin"
 
+	"context"
 	"fmt"
 	"net/http"
+	"net/url"
 	"strings"
+	"time"
 )
 
+// StoreProvider: returns a middleware that sets context store, shared by all requests
+func StoreProvider(store Store) func(*gin.Context) {
+	return func(c *gin.Context) {
+		c.Set("store", store)
+	}
+}
+
+// RoomHubProvider: returns a middleware that sets context rooms, the sprint rooms shared by all requests
+func RoomHubProvider(rooms *RoomHub) func(*gin.Context) {
+	return func(c *gin.Context) {
+		c.Set("rooms", rooms)
+	}
+}
+
+// QueryTimeout: returns a middleware that cancels the database queries of a request after a timeout,
+// given by routeTimeouts for the "METHOD /route/:param" of the request or timeout otherwise, 0 for no limit.
+// Queries are also cancelled as soon as the client disconnects.
+func QueryTimeout(timeout time.Duration, routeTimeouts map[string]time.Duration) func(*gin.Context) {
+	return func(c *gin.Context) {
+		d, ok := routeTimeouts[c.Request.Method+" "+c.FullPath()]
+		if !ok {
+			d = timeout
+		}
+		if d > 0 {
+			ctx, cancel := context.WithTimeout(c.Request.Context(), d)
+			defer cancel()
+			c.Request = c.Request.WithContext(ctx)
+		}
+		c.Next()
+	}
+}
+
+// withQueryTimeout returns a context cancelling the queries made with it after the configured query timeout,
+// for requests bounding each of their queries rather than the whole request
+func withQueryTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if config.DB.QueryTimeout > 0 {
+		return context.WithTimeout(ctx, config.DB.QueryTimeout)
+	}
+	return context.WithCancel(ctx)
+}
+
 // UserLoader: middleware that sets context user using request param :username
+// Must be used after StoreProvider
 func UserLoader(c *gin.Context) {
-	user, err := GetUserByUsername(c.Param("username"))
+	store := c.MustGet("store").(Store)
+	ctx := c.Request.Context()
+	user, err := store.GetUserByUsername(ctx, c.Param("username"))
 	if err != nil {
 		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("user not found %q", c.Param("username"))})
 		return
@@ -22,8 +69,10 @@ func UserLoader(c *gin.Context) {
 // ProjectLoader: middleware that sets context project using request param :pslug
 // Must be used after UserLoader
 func ProjectLoader(c *gin.Context) {
+	store := c.MustGet("store").(Store)
+	ctx := c.Request.Context()
 	user := c.MustGet("user").(*User)
-	project, err := user.GetProjectBySlug(c.Param("pslug"))
+	project, err := store.GetProjectBySlug(ctx, user, c.Param("pslug"))
 	if err != nil {
 		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("project not found %q for user %q", c.Param("pslug"), user.Username)})
 		return
@@ -33,9 +82,13 @@ func ProjectLoader(c *gin.Context) {
 }
 
 // SprintLoader: middleware that sets context sprint using request param :sslug
+// Must be used after ProjectLoader
 func SprintLoader(c *gin.Context) {
-	sprint, err := GetSprintBySlug(c.Param("sslug"))
-	if err != nil {
+	store := c.MustGet("store").(Store)
+	ctx := c.Request.Context()
+	project := c.MustGet("project").(*Project)
+	sprint, err := store.GetSprintBySlug(ctx, c.Param("sslug"))
+	if err != nil || sprint.ProjectID != project.ID {
 		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("sprint not found %q", c.Param("sslug"))})
 		return
 	}
@@ -43,20 +96,104 @@ func SprintLoader(c *gin.Context) {
 	c.Set("sprint", sprint)
 }
 
-// TokenScopeChecker: returns a middleware that checks for a given scope.
-// Requires UserLoader middleware to have been called first.
-func TokenScopeChecker(scope string) func(*gin.Context) {
-	return func(c *gin.Context) {
-		user := c.MustGet("user").(*User)
+// AccessLogFormatter formats access log lines like the default gin logger, with the access_token query parameter redacted
+func AccessLogFormatter(param gin.LogFormatterParams) string {
+	var statusColor, methodColor, resetColor string
+	if param.IsOutputColor() {
+		statusColor = param.StatusCodeColor()
+		methodColor = param.MethodColor()
+		resetColor = param.ResetColor()
+	}
+	if param.Latency > time.Minute {
+		param.Latency = param.Latency.Truncate(time.Second)
+	}
+
+	return fmt.Sprintf("[GIN] %v |%s %3d %s| %13v | %15s |%s %-7s %s %#v\n%s",
+		param.TimeStamp.Format("2006/01/02 - 15:04:05"),
+		statusColor, param.StatusCode, resetColor,
+		param.Latency,
+		param.ClientIP,
+		methodColor, param.Method, resetColor,
+		redactAccessToken(param.Path),
+		param.ErrorMessage,
+	)
+}
 
-		tokenString := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
-		ok, err := user.TokenValidInScope(tokenString, scope)
-		if err != nil {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": fmt.Sprintf("invalid token error: %v", err)})
+// redactAccessToken replaces the value of the access_token query parameter of the path, if any
+func redactAccessToken(path string) string {
+	i := strings.Index(path, "?")
+	if i < 0 {
+		return path
+	}
+	query, err := url.ParseQuery(path[i+1:])
+	if err != nil {
+		// do not risk logging the token
+		return path[:i]
+	}
+	if _, ok := query["access_token"]; !ok {
+		return path
+	}
+	query.Set("access_token", "REDACTED")
+	return path[:i] + "?" + query.Encode()
+}
+
+// QueryTokenAuthorization: middleware that uses the access_token query parameter as bearer token if there is no Authorization header,
+// for browser WebSocket and EventSource clients which cannot set headers.
+// Must be used before TokenScopeChecker
+func QueryTokenAuthorization(c *gin.Context) {
+	if token := c.Query("access_token"); token != "" && c.GetHeader("Authorization") == "" {
+		c.Request.Header.Set("Authorization", "Bearer "+token)
+	}
+}
+
+// TokenScopeChecker: returns a middleware that checks for at least one of the given scopes and sets context principal.
+// The principal must own the user, project and sprint already loaded in the context, if any, unless they are an admin.
+func TokenScopeChecker(scopes ...string) func(*gin.Context) {
+	return func(c *gin.Context) {
+		principal := principalFromRequest(c, scopes...)
+		if principal == nil {
 			return
-		} else if !ok {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": fmt.Sprintf("invalid token for scope %q", scope)})
+		}
+
+		if !PrincipalOwnsContext(c, principal) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": fmt.Sprintf("forbidden for user %q", principal.Username)})
 			return
 		}
+
+		c.Set("principal", principal)
+	}
+}
+
+// principalFromRequest returns the principal of the request bearer token if it grants at least one of the given scopes,
+// otherwise aborts with 401 or 403 and returns nil
+func principalFromRequest(c *gin.Context, scopes ...string) *Principal {
+	store := c.MustGet("store").(Store)
+	ctx := c.Request.Context()
+	tokenString := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+	principal, err := PrincipalFromToken(ctx, store, tokenString, scopes...)
+	if err == ErrInsufficientScope {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": fmt.Sprintf("invalid token for scope %q", Scopes(scopes).String())})
+		return nil
+	} else if err != nil {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": fmt.Sprintf("invalid token error: %v", err)})
+		return nil
+	}
+	return principal
+}
+
+// PrincipalOwnsContext returns true if the principal owns every resource loaded in the context
+func PrincipalOwnsContext(c *gin.Context, principal *Principal) bool {
+	if principal.IsAdmin() {
+		return true
+	}
+	if user, ok := c.Get("user"); ok && !principal.OwnsUser(user.(*User)) {
+		return false
+	}
+	if project, ok := c.Get("project"); ok && !principal.OwnsProject(project.(*Project)) {
+		return false
+	}
+	if sprint, ok := c.Get("sprint"); ok && !principal.OwnsSprint(sprint.(*Sprint)) {
+		return false
 	}
+	return true
 }
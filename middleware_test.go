@@ -0,0 +1,143 @@
+package main
+
+import (
+	"github.com/gin-gonic/gin"
+
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAccessLogFormatter(t *testing.T) {
+	for path, want := range map[string]string{
+		"/users/alice/events":                      "/users/alice/events",
+		"/users/alice/events?access_token=secret":  "/users/alice/events?access_token=REDACTED",
+		"/users/alice/events?a=1&access_token=abc": "/users/alice/events?a=1&access_token=REDACTED",
+		"/users/alice/events?access_token=%zz":     "/users/alice/events",
+	} {
+		line := AccessLogFormatter(gin.LogFormatterParams{TimeStamp: time.Now(), StatusCode: 200, Method: "GET", Path: path})
+		if !strings.Contains(line, `"`+want+`"`) {
+			t.Errorf("log line %q, want path %q", line, want)
+		}
+	}
+}
+
+func TestPrincipalOwnsContext(t *testing.T) {
+	alice := &User{ID: 1, Username: "alice"}
+	project := &Project{ID: 1, UserID: 1}
+	sprint := &Sprint{ID: 1, Username: "alice"}
+
+	for _, tc := range []struct {
+		name      string
+		principal *Principal
+		resources map[string]interface{}
+		want      bool
+	}{
+		{"no resource", &Principal{UserID: 2, Username: "bob"}, nil, true},
+		{"own user", &Principal{UserID: 1, Username: "alice"}, map[string]interface{}{"user": alice}, true},
+		{"other user", &Principal{UserID: 2, Username: "bob"}, map[string]interface{}{"user": alice}, false},
+		{"renamed user", &Principal{UserID: 1, Username: "bob"}, map[string]interface{}{"user": alice}, false},
+		{"own sprint", &Principal{UserID: 1, Username: "alice"}, map[string]interface{}{"user": alice, "project": project, "sprint": sprint}, true},
+		{"other project", &Principal{UserID: 2, Username: "bob"}, map[string]interface{}{"project": project}, false},
+		{"other sprint", &Principal{UserID: 2, Username: "bob"}, map[string]interface{}{"sprint": sprint}, false},
+		{"admin", &Principal{UserID: 2, Username: "bob", Scopes: Scopes{"admin"}}, map[string]interface{}{"user": alice, "project": project, "sprint": sprint}, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			for key, value := range tc.resources {
+				c.Set(key, value)
+			}
+			if got := PrincipalOwnsContext(c, tc.principal); got != tc.want {
+				t.Errorf("owns %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestTokenScopeCheckerUserRoutes(t *testing.T) {
+	r := NewRouter(NewMemoryStore(), NewRoomHub())
+	testSignUp(t, r, "alice")
+	testSignUp(t, r, "bob")
+	alice := testLogIn(t, r, "alice", "basic").AccessToken
+	bob := testLogIn(t, r, "bob", "basic").AccessToken
+
+	for _, tc := range []struct {
+		name   string
+		method string
+		path   string
+		body   interface{}
+	}{
+		{"update user", http.MethodPatch, "/users/alice", gin.H{"operator": "set", "path": "timezone", "value": "Europe/Paris"}},
+		{"delete user", http.MethodDelete, "/users/alice", nil},
+		{"list sessions", http.MethodGet, "/users/alice/sessions/", nil},
+		{"list tokens", http.MethodGet, "/users/alice/tokens/", nil},
+		{"create token", http.MethodPost, "/users/alice/tokens/", gin.H{"name": "script", "scope": "read"}},
+		{"create project", http.MethodPost, "/users/alice/projects/", gin.H{}},
+		{"set rest day", http.MethodPut, "/users/alice/rest-days/2030-01-01", nil},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if w := testRequest(r, tc.method, tc.path, bob, tc.body); w.Code != http.StatusForbidden {
+				t.Errorf("another user: status %d, want %d", w.Code, http.StatusForbidden)
+			}
+		})
+	}
+
+	// alice is untouched
+	if w := testRequest(r, http.MethodGet, "/users/alice/sessions/", alice, nil); w.Code != http.StatusOK {
+		t.Errorf("owner: status %d, want %d", w.Code, http.StatusOK)
+	}
+}
+
+func TestQueryTimeout(t *testing.T) {
+	cfg := &DBConfig{RouteQueryTimeouts: []string{"get /users/:username/stats = 50ms", "GET /events=0s"}}
+	routeTimeouts, err := cfg.ParseRouteQueryTimeouts()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// each route responds with the time left before its queries are cancelled, 0 without a deadline
+	r := gin.New()
+	r.Use(QueryTimeout(time.Hour, routeTimeouts))
+	timeLeft := func(c *gin.Context) {
+		if c.Request.Context().Err() != nil {
+			c.AbortWithStatus(http.StatusRequestTimeout)
+			return
+		}
+		var left time.Duration
+		if deadline, ok := c.Request.Context().Deadline(); ok {
+			left = time.Until(deadline)
+		}
+		c.String(http.StatusOK, left.String())
+	}
+	r.GET("/users/:username/stats", timeLeft)
+	r.GET("/users/:username", timeLeft)
+	r.GET("/events", timeLeft)
+
+	for path, want := range map[string]time.Duration{"/users/alice/stats": 50 * time.Millisecond, "/users/alice": time.Hour, "/events": 0} {
+		w := serve(r, newTestRequest(http.MethodGet, path, "", nil))
+		left, err := time.ParseDuration(w.Body.String())
+		if err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+		if left > want || (want > 0 && left < want-time.Second/10) {
+			t.Errorf("%s: %v left, want %v", path, left, want)
+		}
+	}
+
+	// queries are cancelled when the client goes away
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if w := serve(r, newTestRequest(http.MethodGet, "/events", "", nil).WithContext(ctx)); w.Code != http.StatusRequestTimeout {
+		t.Errorf("disconnected client: status %d, want %d", w.Code, http.StatusRequestTimeout)
+	}
+
+	for _, entry := range []string{"/users/:username", "GET users=1s", "GET /users=-1s", "GET /users=soon"} {
+		cfg := &DBConfig{RouteQueryTimeouts: []string{entry}}
+		if _, err := cfg.ParseRouteQueryTimeouts(); err == nil {
+			t.Errorf("ParseRouteQueryTimeouts accepted %q", entry)
+		}
+	}
+}
@@ -0,0 +1,366 @@
+package main
+
+import (
+	"github.com/jmoiron/sqlx"
+
+	"crypto/sha256"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// migrationFiles the migration scripts, named <version>_<name>.up.sql and <version>_<name>.down.sql
+//
+//go:embed sql/migrations/*.sql
+var migrationFiles embed.FS
+
+// migrationsLockID the advisory lock taken while migrating, so that concurrent migrations wait for each other
+const migrationsLockID = 0x6175746f // "auto"
+
+// Migration is a versioned change to the database schema
+type Migration struct {
+	// Version the position of the migration, starting at 1
+	Version int
+
+	// Name a short description of the migration
+	Name string
+
+	// Up the script applying the migration
+	Up string
+
+	// Down the script reverting the migration
+	Down string
+}
+
+// Checksum returns the sha256 hash of the up script, recorded when the migration is applied
+func (m *Migration) Checksum() string {
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(m.Up)))
+}
+
+// String returns the migration file prefix, <version>_<name>
+func (m *Migration) String() string {
+	return fmt.Sprintf("%04d_%s", m.Version, m.Name)
+}
+
+// LoadMigrations reads the migrations in the given directory, ordered by version.
+// Versions must follow each other from 1 and every migration must have both scripts.
+func LoadMigrations(fsys fs.FS, dir string) ([]*Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int]*Migration{}
+	for _, entry := range entries {
+		fileName := entry.Name()
+		var direction string
+		switch {
+		case strings.HasSuffix(fileName, ".up.sql"):
+			direction = "up"
+		case strings.HasSuffix(fileName, ".down.sql"):
+			direction = "down"
+		default:
+			continue
+		}
+
+		prefix := strings.TrimSuffix(fileName, "."+direction+".sql")
+		versionStr, name, ok := strings.Cut(prefix, "_")
+		version, err := strconv.Atoi(versionStr)
+		if !ok || err != nil || version < 1 || name == "" {
+			return nil, fmt.Errorf("LoadMigrations: invalid file name %s", fileName)
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: name}
+			byVersion[version] = m
+		} else if m.Name != name {
+			return nil, fmt.Errorf("LoadMigrations: conflicting names for version %d", version)
+		}
+
+		script, err := fs.ReadFile(fsys, path.Join(dir, fileName))
+		if err != nil {
+			return nil, err
+		}
+		if direction == "up" {
+			m.Up = string(script)
+		} else {
+			m.Down = string(script)
+		}
+	}
+
+	migrations := make([]*Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		migrations = append(migrations, m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+
+	for i, m := range migrations {
+		if m.Version != i+1 {
+			return nil, fmt.Errorf("LoadMigrations: missing version %d", i+1)
+		}
+		if strings.TrimSpace(m.Up) == "" || strings.TrimSpace(m.Down) == "" {
+			return nil, fmt.Errorf("LoadMigrations: %s needs both an up and a down script", m)
+		}
+	}
+
+	return migrations, nil
+}
+
+// AppliedMigration is a migration recorded in the schema_migrations table
+type AppliedMigration struct {
+	// Version the version of the migration
+	Version int `db:"version"`
+
+	// Name the name of the migration when it was applied
+	Name string `db:"name"`
+
+	// Checksum the checksum of the up script when it was applied
+	Checksum string `db:"checksum"`
+
+	// AppliedAt the moment the migration was applied
+	AppliedAt time.Time `db:"applied_at"`
+}
+
+// MigrationStatus tells whether a known migration is applied
+type MigrationStatus struct {
+	*Migration
+
+	// Applied the record of the migration, nil if it is pending
+	Applied *AppliedMigration
+}
+
+// Migrator applies migrations to the database and records them in schema_migrations
+type Migrator struct {
+	db         *sqlx.DB
+	migrations []*Migration
+}
+
+// NewMigrator returns a migrator for the given store, using the embedded migrations
+func NewMigrator(store *PostgresStore) (*Migrator, error) {
+	migrations, err := LoadMigrations(migrationFiles, "sql/migrations")
+	if err != nil {
+		return nil, err
+	}
+
+	return &Migrator{db: store.pool, migrations: migrations}, nil
+}
+
+// init creates the schema and the schema_migrations table if needed
+func (m *Migrator) init() error {
+	_, err := m.db.Exec(`create schema if not exists autochrone;
+		create table if not exists autochrone.schema_migrations (
+			version int primary key,
+			name varchar not null,
+			checksum varchar(64) not null,
+			applied_at timestamp not null
+		)`)
+	return err
+}
+
+// applied returns the applied migrations by version
+func (m *Migrator) applied(q sqlx.Queryer) (map[int]*AppliedMigration, error) {
+	rows := []*AppliedMigration{}
+	if err := sqlx.Select(q, &rows, "select * from autochrone.schema_migrations order by version"); err != nil {
+		return nil, err
+	}
+
+	applied := map[int]*AppliedMigration{}
+	for _, am := range rows {
+		applied[am.Version] = am
+	}
+	return applied, nil
+}
+
+// verify checks that every applied migration is known and unchanged since it was applied
+func (m *Migrator) verify(applied map[int]*AppliedMigration) error {
+	for version, am := range applied {
+		if version > len(m.migrations) {
+			return fmt.Errorf("Migrator: unknown migration %04d_%s is applied", am.Version, am.Name)
+		}
+		if mig := m.migrations[version-1]; mig.Checksum() != am.Checksum {
+			return fmt.Errorf("Migrator: %s was modified after being applied", mig)
+		}
+	}
+	return nil
+}
+
+// Status returns all known migrations along with whether they are applied
+func (m *Migrator) Status() ([]*MigrationStatus, error) {
+	if err := m.init(); err != nil {
+		return nil, err
+	}
+
+	applied, err := m.applied(m.db)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]*MigrationStatus, len(m.migrations))
+	for i, mig := range m.migrations {
+		statuses[i] = &MigrationStatus{Migration: mig, Applied: applied[mig.Version]}
+	}
+	return statuses, m.verify(applied)
+}
+
+// Pending returns the migrations not applied yet, and an error if applied ones do not match the known ones
+func (m *Migrator) Pending() ([]*Migration, error) {
+	statuses, err := m.Status()
+	if err != nil {
+		return nil, err
+	}
+
+	pending := []*Migration{}
+	for _, s := range statuses {
+		if s.Applied == nil {
+			pending = append(pending, s.Migration)
+		}
+	}
+	return pending, nil
+}
+
+// step runs fn in a transaction holding the migrations lock, with the autochrone schema as search path
+func (m *Migrator) step(fn func(tx *sqlx.Tx, applied map[int]*AppliedMigration) error) error {
+	tx, err := m.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("select pg_advisory_xact_lock($1)", migrationsLockID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("set local search_path to autochrone"); err != nil {
+		return err
+	}
+
+	applied, err := m.applied(tx)
+	if err != nil {
+		return err
+	}
+	if err := m.verify(applied); err != nil {
+		return err
+	}
+
+	if err := fn(tx, applied); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Up applies all pending migrations in order, each in its own transaction, and returns them
+func (m *Migrator) Up() ([]*Migration, error) {
+	if err := m.init(); err != nil {
+		return nil, err
+	}
+
+	done := []*Migration{}
+	for _, mig := range m.migrations {
+		ran := false
+		err := m.step(func(tx *sqlx.Tx, applied map[int]*AppliedMigration) error {
+			if applied[mig.Version] != nil {
+				return nil
+			}
+			if _, err := tx.Exec(mig.Up); err != nil {
+				return fmt.Errorf("%s: %w", mig, err)
+			}
+			_, err := tx.Exec("insert into autochrone.schema_migrations (version, name, checksum, applied_at) values ($1, $2, $3, $4)",
+				mig.Version, mig.Name, mig.Checksum(), time.Now().UTC())
+			ran = err == nil
+			return err
+		})
+		if err != nil {
+			return done, err
+		}
+		if ran {
+			done = append(done, mig)
+		}
+	}
+
+	return done, nil
+}
+
+// Down reverts the latest applied migration and returns it, nil if none is applied
+func (m *Migrator) Down() (*Migration, error) {
+	if err := m.init(); err != nil {
+		return nil, err
+	}
+
+	var reverted *Migration
+	err := m.step(func(tx *sqlx.Tx, applied map[int]*AppliedMigration) error {
+		for i := len(m.migrations) - 1; i >= 0; i-- {
+			mig := m.migrations[i]
+			if applied[mig.Version] == nil {
+				continue
+			}
+
+			if _, err := tx.Exec(mig.Down); err != nil {
+				return fmt.Errorf("%s: %w", mig, err)
+			}
+			if _, err := tx.Exec("delete from autochrone.schema_migrations where version = $1", mig.Version); err != nil {
+				return err
+			}
+			reverted = mig
+			return nil
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return reverted, nil
+}
+
+// RunMigrateCommand runs the migrate subcommand with the given arguments: up, down or status
+func RunMigrateCommand(store *PostgresStore, args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: autochrone-api migrate up|down|status")
+	}
+
+	migrator, err := NewMigrator(store)
+	if err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "up":
+		done, err := migrator.Up()
+		for _, mig := range done {
+			fmt.Printf("applied %s\n", mig)
+		}
+		if err == nil && len(done) == 0 {
+			fmt.Println("already up to date")
+		}
+		return err
+	case "down":
+		mig, err := migrator.Down()
+		if err != nil {
+			return err
+		}
+		if mig == nil {
+			fmt.Println("no migration to revert")
+		} else {
+			fmt.Printf("reverted %s\n", mig)
+		}
+		return nil
+	case "status":
+		statuses, err := migrator.Status()
+		for _, s := range statuses {
+			if s.Applied != nil {
+				fmt.Printf("%-40s applied %s\n", s.Migration, s.Applied.AppliedAt.Format(time.RFC3339))
+			} else {
+				fmt.Printf("%-40s pending\n", s.Migration)
+			}
+		}
+		return err
+	default:
+		return fmt.Errorf("unknown migrate command %q, expected up, down or status", args[0])
+	}
+}
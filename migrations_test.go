@@ -0,0 +1,17 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestLoadMigrations(t *testing.T) {
+	migrations, err := LoadMigrations(migrationFiles, "sql/migrations")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, m := range migrations {
+		if m.Version != i+1 {
+			t.Errorf("migration %s has version %d, want %d", m, m.Version, i+1)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"time"
+)
+
+// Milestone is a milestone sprint with what was done since the previous one
+type Milestone struct {
+	// Index the number of milestones on the project up to and including this one
+	Index int `db:"milestone_index" json:"index"`
+
+	// SprintSlug the slug of the milestone sprint
+	SprintSlug string `db:"slug" json:"sslug"`
+
+	// TimeStart the moment the milestone sprint starts
+	TimeStart time.Time `db:"time_start" json:"timeStart"`
+
+	// WordCount the words written since the previous milestone, excluding it and including this one
+	WordCount int `db:"word_count" json:"wordCount"`
+
+	// Duration the time spent in minutes since the previous milestone, excluding it and including this one
+	Duration int `db:"duration" json:"duration"`
+
+	// Speed the words written per minute since the previous milestone
+	Speed float64 `db:"-" json:"speed"`
+}
+
+// GetMilestones returns the milestones on the project, earliest first.
+// They match what Sprint.MilestoneIndex, MilestoneWordCount and MilestoneTimeSpent return for each milestone sprint.
+func (p *Project) GetMilestones(ctx context.Context, store Store) ([]*Milestone, error) {
+	milestones, err := store.GetProjectMilestones(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, m := range milestones {
+		if m.Duration > 0 {
+			m.Speed = float64(m.WordCount) / float64(m.Duration)
+		}
+	}
+	return milestones, nil
+}
+
+// GetProjectMilestones returns the milestones on the project with the words written and time spent since the previous one,
+// earliest first.
+// Each sprint belongs to the stretch of the milestones counted before it, summed up to the milestone ending the stretch.
+func (store *PostgresStore) GetProjectMilestones(ctx context.Context, p *Project) ([]*Milestone, error) {
+	milestones := []*Milestone{}
+	err := store.db.SelectContext(ctx, &milestones, `with stretches as (
+			select *, count(*) filter (where is_milestone) over (order by time_start, id rows between unbounded preceding and 1 preceding) milestones_before
+			from autochrone.sprints where project_id = $1
+		), totals as (
+			select slug, time_start, is_milestone, milestones_before,
+				sum(word_count) over stretch word_count,
+				sum(duration) over stretch duration
+			from stretches
+			window stretch as (partition by milestones_before order by time_start, id rows between unbounded preceding and current row)
+		)
+		select milestones_before + 1 milestone_index, slug, time_start, word_count, duration
+		from totals where is_milestone order by time_start, milestone_index`, p.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return milestones, nil
+}
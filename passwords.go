@@ -0,0 +1,211 @@
+package main
+
+import (
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// PasswordHasher hashes passwords into encoded strings holding the hash parameters
+type PasswordHasher interface {
+	// Hash returns the encoded hash of the password
+	Hash(password string) (string, error)
+
+	// Verify returns true if the password matches the encoded hash
+	Verify(password, encoded string) (bool, error)
+
+	// Handles returns true if the encoded hash is in this hasher’s format
+	Handles(encoded string) bool
+
+	// NeedsRehash returns true if the encoded hash was produced with other parameters than this hasher’s
+	NeedsRehash(encoded string) bool
+}
+
+// passwordHasher is used to hash new passwords
+var passwordHasher PasswordHasher = DefaultArgon2idHasher
+
+// passwordHashers are used to verify passwords, whichever hasher produced them
+var passwordHashers = []PasswordHasher{DefaultArgon2idHasher, DefaultBcryptHasher}
+
+// VerifyPassword checks a password against an encoded hash produced by any known hasher.
+// needsRehash is true if the hash should be replaced by one from the current hasher.
+func VerifyPassword(password, encoded string) (ok, needsRehash bool, err error) {
+	for _, hasher := range passwordHashers {
+		if !hasher.Handles(encoded) {
+			continue
+		}
+		ok, err := hasher.Verify(password, encoded)
+		if err != nil || !ok {
+			return false, false, err
+		}
+		return true, !passwordHasher.Handles(encoded) || passwordHasher.NeedsRehash(encoded), nil
+	}
+	return false, false, errors.New("unknown password hash format")
+}
+
+// dummyPasswordHash is verified against when authenticating unknown users
+var (
+	dummyPasswordHash     string
+	dummyPasswordHashOnce sync.Once
+)
+
+// VerifyDummyPassword takes as long as verifying the password of a user, so that unknown users cannot be told apart
+func VerifyDummyPassword(password string) {
+	dummyPasswordHashOnce.Do(func() {
+		dummyPasswordHash, _ = passwordHasher.Hash("autochrone-dummy-password")
+	})
+	VerifyPassword(password, dummyPasswordHash)
+}
+
+// HashPassword hashes the password with the salt.
+// Legacy format: only used to verify passwords set before the introduction of PasswordHasher.
+func HashPassword(password, passwordSalt string) string {
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(fmt.Sprintf("%s--autochrone--%s--autochrone--%s", password, passwordSalt, password))))
+}
+
+// VerifyLegacyPassword checks a password against a legacy hash and salt
+func VerifyLegacyPassword(password, passwordHash, passwordSalt string) bool {
+	return subtle.ConstantTimeCompare([]byte(passwordHash), []byte(HashPassword(password, passwordSalt))) == 1
+}
+
+// Argon2idHasher hashes passwords with argon2id, encoded in the PHC string format
+type Argon2idHasher struct {
+	// Time the number of passes over the memory
+	Time uint32
+
+	// Memory the memory size in KiB
+	Memory uint32
+
+	// Threads the degree of parallelism
+	Threads uint8
+
+	// SaltLength the salt length in bytes
+	SaltLength uint32
+
+	// KeyLength the hash length in bytes
+	KeyLength uint32
+}
+
+// DefaultArgon2idHasher uses the parameters recommended by RFC 9106 for memory-constrained environments
+var DefaultArgon2idHasher = &Argon2idHasher{
+	Time:       3,
+	Memory:     64 * 1024,
+	Threads:    4,
+	SaltLength: 16,
+	KeyLength:  32,
+}
+
+// Hash returns the encoded argon2id hash of the password with a random salt
+func (h *Argon2idHasher) Hash(password string) (string, error) {
+	salt := make([]byte, h.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	key := argon2.IDKey([]byte(password), salt, h.Time, h.Memory, h.Threads, h.KeyLength)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, h.Memory, h.Time, h.Threads,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// Verify returns true if the password matches the encoded argon2id hash
+func (h *Argon2idHasher) Verify(password, encoded string) (bool, error) {
+	params, salt, key, err := decodeArgon2id(encoded)
+	if err != nil {
+		return false, err
+	}
+
+	other := argon2.IDKey([]byte(password), salt, params.Time, params.Memory, params.Threads, uint32(len(key)))
+	return subtle.ConstantTimeCompare(key, other) == 1, nil
+}
+
+// Handles returns true if the encoded hash is an argon2id hash
+func (h *Argon2idHasher) Handles(encoded string) bool {
+	return strings.HasPrefix(encoded, "$argon2id$")
+}
+
+// NeedsRehash returns true if the encoded hash parameters differ from the hasher’s
+func (h *Argon2idHasher) NeedsRehash(encoded string) bool {
+	params, salt, key, err := decodeArgon2id(encoded)
+	if err != nil {
+		return true
+	}
+	return params.Time != h.Time || params.Memory != h.Memory || params.Threads != h.Threads ||
+		uint32(len(salt)) != h.SaltLength || uint32(len(key)) != h.KeyLength
+}
+
+// decodeArgon2id parses a PHC argon2id string into its parameters, salt and key
+func decodeArgon2id(encoded string) (params *Argon2idHasher, salt, key []byte, err error) {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return nil, nil, nil, errors.New("invalid argon2id hash")
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return nil, nil, nil, errors.New("unsupported argon2id version")
+	}
+
+	params = &Argon2idHasher{}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Time, &params.Threads); err != nil {
+		return nil, nil, nil, errors.New("invalid argon2id parameters")
+	}
+
+	if salt, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil {
+		return nil, nil, nil, errors.New("invalid argon2id salt")
+	}
+	if key, err = base64.RawStdEncoding.DecodeString(parts[5]); err != nil || len(key) == 0 {
+		return nil, nil, nil, errors.New("invalid argon2id key")
+	}
+	params.SaltLength = uint32(len(salt))
+	params.KeyLength = uint32(len(key))
+
+	return params, salt, key, nil
+}
+
+// BcryptHasher hashes passwords with bcrypt
+type BcryptHasher struct {
+	// Cost the bcrypt cost
+	Cost int
+}
+
+// DefaultBcryptHasher uses bcrypt default cost
+var DefaultBcryptHasher = &BcryptHasher{Cost: bcrypt.DefaultCost}
+
+// Hash returns the bcrypt hash of the password
+func (h *BcryptHasher) Hash(password string) (string, error) {
+	b, err := bcrypt.GenerateFromPassword([]byte(password), h.Cost)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// Verify returns true if the password matches the bcrypt hash
+func (h *BcryptHasher) Verify(password, encoded string) (bool, error) {
+	err := bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password))
+	if err == bcrypt.ErrMismatchedHashAndPassword {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Handles returns true if the encoded hash is a bcrypt hash
+func (h *BcryptHasher) Handles(encoded string) bool {
+	return strings.HasPrefix(encoded, "$2a$") || strings.HasPrefix(encoded, "$2b$") || strings.HasPrefix(encoded, "$2y$")
+}
+
+// NeedsRehash returns true if the bcrypt hash cost differs from the hasher’s
+func (h *BcryptHasher) NeedsRehash(encoded string) bool {
+	cost, err := bcrypt.Cost([]byte(encoded))
+	return err != nil || cost != h.Cost
+}
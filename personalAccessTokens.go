@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// personalAccessTokenPrefix starts every personal access token, telling them apart from JWTs
+const personalAccessTokenPrefix = "acpat_"
+
+// PersonalAccessToken is a named long-lived token created by a user for scripts and plugins.
+// Only its hash is stored.
+type PersonalAccessToken struct {
+	// ID the token identifier
+	ID int `db:"id" json:"id"`
+
+	// UserID the ID of the token owner
+	UserID int `db:"user_id" json:"userId"`
+
+	// Name the token name, unique user-wide
+	Name string `db:"name" json:"name"`
+
+	// TokenHash the sha256 hash of the token
+	TokenHash string `db:"token_hash" json:"-"`
+
+	// Scope the space separated scopes granted by the token
+	Scope string `db:"scope" json:"scope"`
+
+	// CreatedAt the moment the token was created
+	CreatedAt time.Time `db:"created_at" json:"createdAt"`
+
+	// ExpiresAt the moment the token expires, nil if it never does
+	ExpiresAt *time.Time `db:"expires_at" json:"expiresAt"`
+
+	// LastUsedAt the moment the token was last used, nil if it never was
+	LastUsedAt *time.Time `db:"last_used_at" json:"lastUsedAt"`
+}
+
+// ErrTokenNameTaken is returned when the user already has a personal access token with the same name
+var ErrTokenNameTaken = errors.New("token name already in use")
+
+// IsPersonalAccessToken returns true if the token string looks like a personal access token
+func IsPersonalAccessToken(token string) bool {
+	return strings.HasPrefix(token, personalAccessTokenPrefix)
+}
+
+// hashPersonalAccessToken returns the hash under which a personal access token is stored
+func hashPersonalAccessToken(token string) string {
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(token)))
+}
+
+// NewPersonalAccessToken creates a token for the user with the given scopes.
+// Returns the token record and the token itself, which cannot be retrieved later, or ErrTokenNameTaken.
+func (u *User) NewPersonalAccessToken(ctx context.Context, store Store, name string, scopes Scopes, expiresAt *time.Time) (*PersonalAccessToken, string, error) {
+	if name == "" || len(name) > 64 || len(scopes) == 0 {
+		return nil, "", errors.New("NewPersonalAccessToken: invalid data")
+	}
+	if !u.CanUseScopes(ctx, store, scopes) {
+		return nil, "", errors.New("NewPersonalAccessToken: invalid scope")
+	}
+
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return nil, "", err
+	}
+	token := personalAccessTokenPrefix + hex.EncodeToString(b)
+
+	t := &PersonalAccessToken{
+		UserID:    u.ID,
+		Name:      name,
+		TokenHash: hashPersonalAccessToken(token),
+		Scope:     scopes.String(),
+		CreatedAt: time.Now().UTC(),
+	}
+	if expiresAt != nil {
+		utc := expiresAt.UTC()
+		t.ExpiresAt = &utc
+	}
+
+	if err := store.InsertPersonalAccessToken(ctx, t); err != nil {
+		return nil, "", err
+	}
+
+	return t, token, nil
+}
+
+// GetPersonalAccessToken returns the unexpired personal access token record matching the given token
+// and records its use
+func GetPersonalAccessToken(ctx context.Context, store Store, token string) (*PersonalAccessToken, error) {
+	return store.UsePersonalAccessToken(ctx, hashPersonalAccessToken(token))
+}
+
+// InsertPersonalAccessToken records a personal access token and sets its ID
+func (store *PostgresStore) InsertPersonalAccessToken(ctx context.Context, t *PersonalAccessToken) error {
+	row := store.db.QueryRowxContext(ctx, `insert into autochrone.personal_access_tokens
+		(user_id, name, token_hash, scope, created_at, expires_at)
+		values ($1, $2, $3, $4, $5, $6) returning id`, t.UserID, t.Name, t.TokenHash, t.Scope, t.CreatedAt, t.ExpiresAt)
+	err := row.Scan(&t.ID)
+	if isUniqueViolation(err, "personal_access_tokens_user_id_name_key") {
+		return ErrTokenNameTaken
+	}
+	return err
+}
+
+// UsePersonalAccessToken returns the unexpired personal access token with the given hash and records its use
+func (store *PostgresStore) UsePersonalAccessToken(ctx context.Context, tokenHash string) (*PersonalAccessToken, error) {
+	now := time.Now().UTC()
+	t := &PersonalAccessToken{}
+	err := store.db.GetContext(ctx, t, `update autochrone.personal_access_tokens
+		set last_used_at = $1
+		where token_hash = $2 and (expires_at is null or expires_at >= $1)
+		returning *`, now, tokenHash)
+	if err != nil {
+		return nil, err
+	}
+
+	return t, nil
+}
+
+// GetPersonalAccessTokenByID returns the personal access token with the given ID and a potential error
+func (store *PostgresStore) GetPersonalAccessTokenByID(ctx context.Context, id int) (*PersonalAccessToken, error) {
+	t := &PersonalAccessToken{}
+	if err := store.db.GetContext(ctx, t, "select * from autochrone.personal_access_tokens where id = $1", id); err != nil {
+		return nil, err
+	}
+
+	return t, nil
+}
+
+// GetUserPersonalAccessTokens returns the personal access tokens of the user, by name
+func (store *PostgresStore) GetUserPersonalAccessTokens(ctx context.Context, u *User) ([]*PersonalAccessToken, error) {
+	tokens := []*PersonalAccessToken{}
+	if err := store.db.SelectContext(ctx, &tokens, "select * from autochrone.personal_access_tokens where user_id = $1 order by name", u.ID); err != nil {
+		return nil, err
+	}
+
+	return tokens, nil
+}
+
+// DeletePersonalAccessToken revokes the personal access token
+func (store *PostgresStore) DeletePersonalAccessToken(ctx context.Context, t *PersonalAccessToken) error {
+	_, err := store.db.ExecContext(ctx, "delete from autochrone.personal_access_tokens where id = $1", t.ID)
+	return err
+}
+
+// DeleteUserPersonalAccessTokens revokes all personal access tokens of the user
+func (store *PostgresStore) DeleteUserPersonalAccessTokens(ctx context.Context, u *User) error {
+	_, err := store.db.ExecContext(ctx, "delete from autochrone.personal_access_tokens where user_id = $1", u.ID)
+	return err
+}
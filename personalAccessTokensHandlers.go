@@ -0,0 +1,113 @@
+package main
+
+import (
+	"github.com/gin-gonic/gin"
+
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// TokensGET responds with the personal access tokens of a user
+func TokensGET(c *gin.Context) {
+	store := c.MustGet("store").(Store)
+	ctx := c.Request.Context()
+	user := c.MustGet("user").(*User)
+
+	tokens, err := store.GetUserPersonalAccessTokens(ctx, user)
+	if err != nil {
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	c.JSON(http.StatusOK, tokens)
+}
+
+// TokensPOSTRequest determines fields for a new personal access token
+type TokensPOSTRequest struct {
+	Name string `json:"name"`
+	// Scope space separated scopes
+	Scope string `json:"scope"`
+	// ExpiresAt RFC 3339 expiration time, empty for a token that never expires
+	ExpiresAt string `json:"expiresAt"`
+}
+
+// TokensPOST creates a personal access token and responds with it.
+// The token cannot be retrieved afterwards. Only a logged in user may create one, not another personal access token.
+func TokensPOST(c *gin.Context) {
+	store := c.MustGet("store").(Store)
+	ctx := c.Request.Context()
+	user := c.MustGet("user").(*User)
+	principal := c.MustGet("principal").(*Principal)
+
+	if principal.PersonalAccessTokenID != 0 {
+		c.JSON(http.StatusForbidden, gin.H{"error": "personal access tokens cannot create tokens"})
+		return
+	}
+
+	req := &TokensPOSTRequest{}
+	if err := c.BindJSON(req); err != nil {
+		return
+	}
+
+	var expiresAt *time.Time
+	if req.ExpiresAt != "" {
+		t, err := ParseTime(req.ExpiresAt)
+		if err != nil || t.Before(time.Now()) {
+			c.AbortWithStatus(http.StatusBadRequest)
+			return
+		}
+		expiresAt = &t
+	}
+
+	scopes := ParseScopes(req.Scope)
+	if req.Name == "" || len(scopes) == 0 || !user.CanUseScopes(ctx, store, scopes) {
+		c.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+
+	// a token cannot grant more than the one used to create it
+	if !principal.Scopes.Covers(scopes) {
+		c.JSON(http.StatusForbidden, gin.H{"error": fmt.Sprintf("invalid token for scope %q", scopes.String())})
+		return
+	}
+
+	t, token, err := user.NewPersonalAccessToken(ctx, store, req.Name, scopes, expiresAt)
+	if err == ErrTokenNameTaken {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	} else if err != nil {
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	c.Header("Location", fmt.Sprintf("/users/%s/tokens/%d", user.Username, t.ID))
+	c.JSON(http.StatusCreated, gin.H{"token": token, "personalAccessToken": t})
+}
+
+// TokensIDDELETE revokes a personal access token
+func TokensIDDELETE(c *gin.Context) {
+	store := c.MustGet("store").(Store)
+	ctx := c.Request.Context()
+	user := c.MustGet("user").(*User)
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+
+	t, err := store.GetPersonalAccessTokenByID(ctx, id)
+	if err != nil || t.UserID != user.ID {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+
+	if err := store.DeletePersonalAccessToken(ctx, t); err != nil {
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	c.Status(http.StatusOK)
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"github.com/gin-gonic/gin"
+
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestTokensPOST(t *testing.T) {
+	r := NewRouter(NewMemoryStore(), NewRoomHub())
+	testSignUp(t, r, "alice")
+	alice := testLogIn(t, r, "alice", "basic").AccessToken
+	project := testProject(t, r, alice, "alice", "novel")
+
+	// newToken creates a personal access token with the given token and returns its status and the new token
+	newToken := func(token, name, scope string) (int, string) {
+		w := testRequest(r, http.MethodPost, "/users/alice/tokens/", token, gin.H{"name": name, "scope": scope})
+		resp := struct {
+			Token string `json:"token"`
+		}{}
+		if w.Code == http.StatusCreated {
+			decodeJSON(t, w, &resp)
+		}
+		return w.Code, resp.Token
+	}
+
+	code, sprints := newToken(alice, "sprints", "sprints:write")
+	if code != http.StatusCreated {
+		t.Fatalf("create token: status %d", code)
+	}
+	if code, _ := newToken(alice, "sprints", "read"); code != http.StatusConflict {
+		t.Errorf("create token with a taken name: status %d, want %d", code, http.StatusConflict)
+	}
+	if code, _ := newToken(alice, "admin", "admin"); code != http.StatusBadRequest {
+		t.Errorf("create token with a scope of no role: status %d, want %d", code, http.StatusBadRequest)
+	}
+	if code, _ := newToken(testLogIn(t, r, "alice", "read").AccessToken, "read", "read"); code != http.StatusForbidden {
+		t.Errorf("create token with a read token: status %d, want %d", code, http.StatusForbidden)
+	}
+
+	// a personal access token cannot create more, even with the basic scope
+	code, basic := newToken(alice, "basic", "basic")
+	if code != http.StatusCreated {
+		t.Fatalf("create basic token: status %d", code)
+	}
+	if code, _ := newToken(basic, "more", "basic"); code != http.StatusForbidden {
+		t.Errorf("create token with a personal access token: status %d, want %d", code, http.StatusForbidden)
+	}
+
+	// a personal access token is limited to its scopes
+	sprint := gin.H{"timeStart": time.Now().Add(time.Hour).Format(time.RFC3339), "duration": 20, "break": 0}
+	if w := testRequest(r, http.MethodPost, project+"/sprints/", sprints, sprint); w.Code != http.StatusOK {
+		t.Errorf("create sprint with a sprints:write token: status %d, want %d", w.Code, http.StatusOK)
+	}
+	if w := testRequest(r, http.MethodPut, project, sprints, gin.H{"name": "novel"}); w.Code != http.StatusForbidden {
+		t.Errorf("update project with a sprints:write token: status %d, want %d", w.Code, http.StatusForbidden)
+	}
+}
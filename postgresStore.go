@@ -0,0 +1,102 @@
+package main
+
+import (
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// PoolConfig sizes the database connection pool
+type PoolConfig struct {
+	// MaxOpenConns the maximum number of open connections, 0 for unlimited
+	MaxOpenConns int `yaml:"max_open_conns"`
+
+	// MaxIdleConns the maximum number of connections kept open while idle
+	MaxIdleConns int `yaml:"max_idle_conns"`
+
+	// ConnMaxLifetime the maximum time a connection may be reused
+	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime"`
+
+	// ConnMaxIdleTime the maximum time a connection may stay idle
+	ConnMaxIdleTime time.Duration `yaml:"conn_max_idle_time"`
+}
+
+// postgresQueryer runs queries, on the connection pool or in a transaction
+type postgresQueryer interface {
+	GetContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error
+	SelectContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryRowxContext(ctx context.Context, query string, args ...interface{}) *sqlx.Row
+	QueryxContext(ctx context.Context, query string, args ...interface{}) (*sqlx.Rows, error)
+}
+
+// PostgresStore is the Store backed by the PostgreSQL database, through a connection pool shared by all requests
+type PostgresStore struct {
+	// pool the connection pool
+	pool *sqlx.DB
+
+	// db runs the queries of the store: the pool, or tx within a transaction
+	db postgresQueryer
+
+	// tx the transaction of the store, nil outside of one
+	tx *sqlx.Tx
+}
+
+// PostgresStore must implement every method of Store
+var _ Store = &PostgresStore{}
+
+// NewPostgresStore connects to the database and sizes the connection pool
+func NewPostgresStore(connStr string, pool PoolConfig) (*PostgresStore, error) {
+	db, err := sqlx.Connect("postgres", connStr)
+	if err != nil {
+		return nil, err
+	}
+
+	db.SetMaxOpenConns(pool.MaxOpenConns)
+	db.SetMaxIdleConns(pool.MaxIdleConns)
+	db.SetConnMaxLifetime(pool.ConnMaxLifetime)
+	db.SetConnMaxIdleTime(pool.ConnMaxIdleTime)
+
+	return &PostgresStore{pool: db, db: db}, nil
+}
+
+// Close closes the connections of the pool
+func (store *PostgresStore) Close() error {
+	return store.pool.Close()
+}
+
+// Transaction runs fn with a store whose writes are committed if it returns nil and rolled back otherwise.
+// Within a transaction, fn joins it.
+func (store *PostgresStore) Transaction(ctx context.Context, fn func(tx Store) error) error {
+	return store.inTx(ctx, func(tx *PostgresStore) error {
+		return fn(tx)
+	})
+}
+
+// inTx runs fn with a store bound to a transaction, committed if fn returns nil and rolled back otherwise
+func (store *PostgresStore) inTx(ctx context.Context, fn func(tx *PostgresStore) error) error {
+	if store.tx != nil {
+		return fn(store)
+	}
+
+	tx, err := store.pool.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := fn(&PostgresStore{pool: store.pool, db: tx, tx: tx}); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// isUniqueViolation returns true if err is the violation of the given unique constraint
+func isUniqueViolation(err error, constraint string) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505" && pqErr.Constraint == constraint
+}
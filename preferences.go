@@ -0,0 +1,122 @@
+package main
+
+import (
+	"golang.org/x/text/language"
+
+	"context"
+	"errors"
+	"time"
+)
+
+// Preferences of new users
+const (
+	defaultTimezone = "UTC"
+	defaultLocale   = "en"
+)
+
+// legacyTimeLayout the layout of timestamps before RFC 3339 was accepted, still accepted as input
+const legacyTimeLayout = "2006-01-02T15:04:05-0700"
+
+// renderedTimeLayout the layout of times rendered for users, in their time zone
+const renderedTimeLayout = "Mon, 02 Jan 2006 15:04 MST"
+
+// Preferences errors
+var (
+	// ErrInvalidTimezone is returned when setting a time zone that is not an IANA name
+	ErrInvalidTimezone = errors.New("invalid time zone")
+
+	// ErrInvalidLocale is returned when setting a locale that is not a BCP 47 tag
+	ErrInvalidLocale = errors.New("invalid locale")
+)
+
+// LoadTimezone returns the location with the given IANA name. The server’s local time zone is not accepted.
+func LoadTimezone(name string) (*time.Location, error) {
+	if name == "" || name == "Local" {
+		return nil, ErrInvalidTimezone
+	}
+
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, ErrInvalidTimezone
+	}
+	return loc, nil
+}
+
+// Location returns the user’s time zone, UTC if it cannot be loaded
+func (u *User) Location() *time.Location {
+	loc, err := LoadTimezone(u.Timezone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// FormatTime renders the time in the user’s time zone
+func (u *User) FormatTime(t time.Time) string {
+	return t.In(u.Location()).Format(renderedTimeLayout)
+}
+
+// SetTimezone sets the user’s time zone from its IANA name, such as Europe/Paris
+func (u *User) SetTimezone(ctx context.Context, store Store, name string) error {
+	loc, err := LoadTimezone(name)
+	if err != nil {
+		return err
+	}
+
+	if err := store.UpdateUserTimezone(ctx, u, loc.String()); err != nil {
+		return err
+	}
+
+	u.Timezone = loc.String()
+	return nil
+}
+
+// SetLocale sets the user’s locale from a BCP 47 tag, such as fr-FR, stored in its canonical form
+func (u *User) SetLocale(ctx context.Context, store Store, tag string) error {
+	t, err := language.Parse(tag)
+	if err != nil || t == language.Und {
+		return ErrInvalidLocale
+	}
+
+	if err := store.UpdateUserLocale(ctx, u, t.String()); err != nil {
+		return err
+	}
+
+	u.Locale = t.String()
+	return nil
+}
+
+// ParseTime parses an RFC 3339 timestamp, or one in the legacy layout 2006-01-02T15:04:05-0700
+func ParseTime(s string) (time.Time, error) {
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		t, err = time.Parse(legacyTimeLayout, s)
+	}
+	return t, err
+}
+
+// ParseDate parses a date, 2006-01-02, or an RFC 3339 timestamp whose date is taken in its own offset.
+// Dates are midnight UTC like project dates.
+func ParseDate(s string) (time.Time, error) {
+	if d, err := time.Parse("2006-01-02", s); err == nil {
+		return d, nil
+	}
+
+	t, err := ParseTime(s)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return LocalDate(t, t.Location()), nil
+}
+
+// UpdateUserTimezone sets the IANA name of the user’s time zone
+func (store *PostgresStore) UpdateUserTimezone(ctx context.Context, u *User, timezone string) error {
+	_, err := store.db.ExecContext(ctx, "update autochrone.users set timezone = $1 where id = $2", timezone, u.ID)
+	return err
+}
+
+// UpdateUserLocale sets the BCP 47 tag of the user’s locale
+func (store *PostgresStore) UpdateUserLocale(ctx context.Context, u *User, locale string) error {
+	_, err := store.db.ExecContext(ctx, "update autochrone.users set locale = $1 where id = $2", locale, u.ID)
+	return err
+}
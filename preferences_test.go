@@ -0,0 +1,59 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseTime(t *testing.T) {
+	want := time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)
+	for _, s := range []string{"2030-01-02T03:04:05Z", "2030-01-02T04:04:05+01:00", "2030-01-01T22:04:05.000-05:00", "2030-01-02T04:04:05+0100"} {
+		got, err := ParseTime(s)
+		if err != nil {
+			t.Errorf("ParseTime(%q): %v", s, err)
+		} else if !got.Equal(want) {
+			t.Errorf("ParseTime(%q) = %v, want %v", s, got, want)
+		}
+	}
+	for _, s := range []string{"", "2030-01-02", "2030-01-02 03:04:05", "02/01/2030 03:04"} {
+		if _, err := ParseTime(s); err == nil {
+			t.Errorf("ParseTime(%q) accepted", s)
+		}
+	}
+}
+
+func TestParseDate(t *testing.T) {
+	for s, want := range map[string]string{
+		"2030-01-02": "2030-01-02",
+		// the date is the one of the timestamp’s own offset
+		"2030-01-02T23:30:00-05:00": "2030-01-02",
+		"2030-01-02T00:30:00+09:00": "2030-01-02",
+	} {
+		got, err := ParseDate(s)
+		if err != nil {
+			t.Errorf("ParseDate(%q): %v", s, err)
+		} else if got.Format(time.RFC3339) != want+"T00:00:00Z" {
+			t.Errorf("ParseDate(%q) = %v, want %s at midnight UTC", s, got, want)
+		}
+	}
+	if _, err := ParseDate("2030-13-01"); err == nil {
+		t.Error("ParseDate accepted an invalid month")
+	}
+}
+
+func TestLoadTimezone(t *testing.T) {
+	if loc, err := LoadTimezone("Europe/Paris"); err != nil || loc.String() != "Europe/Paris" {
+		t.Errorf("LoadTimezone(Europe/Paris) = %v, %v", loc, err)
+	}
+	for _, name := range []string{"", "Local", "Mars/Olympus_Mons", "../etc/passwd"} {
+		if _, err := LoadTimezone(name); err != ErrInvalidTimezone {
+			t.Errorf("LoadTimezone(%q) error %v, want %v", name, err, ErrInvalidTimezone)
+		}
+	}
+
+	// users with a time zone that cannot be loaded anymore count their days in UTC
+	u := &User{Timezone: "Mars/Olympus_Mons"}
+	if loc := u.Location(); loc != time.UTC {
+		t.Errorf("location %v, want UTC", loc)
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+)
+
+// Principal is the authenticated user on behalf of whom a request is made
+type Principal struct {
+	// UserID the ID of the token bearer
+	UserID int
+
+	// Username the username of the token bearer
+	Username string
+
+	// Scopes the scopes the token was issued for
+	Scopes Scopes
+
+	// TokenID the ID of the access token used to authenticate, empty for a personal access token
+	TokenID string
+
+	// PersonalAccessTokenID the ID of the personal access token used to authenticate, 0 for an access token
+	PersonalAccessTokenID int
+
+	// ExpiresAt the moment the token expires, zero if it never does
+	ExpiresAt time.Time
+}
+
+var (
+	// ErrInsufficientScope is returned when a valid token does not grant any of the requested scopes
+	ErrInsufficientScope = errors.New("insufficient scope")
+
+	// ErrTokenExpired is returned when the token of a principal expired since it was checked
+	ErrTokenExpired = errors.New("token expired")
+)
+
+// PrincipalFromToken parses a JWT or personal access token string and returns the principal it was issued to
+// if it grants at least one of the given scopes
+func PrincipalFromToken(ctx context.Context, store Store, tokenString string, scopes ...string) (*Principal, error) {
+	var principal *Principal
+	var err error
+	if IsPersonalAccessToken(tokenString) {
+		principal, err = principalFromPersonalAccessToken(ctx, store, tokenString)
+	} else {
+		principal, err = principalFromJWT(ctx, store, tokenString)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if !principal.Scopes.HasAny(scopes...) {
+		return nil, ErrInsufficientScope
+	}
+
+	return principal, nil
+}
+
+// principalFromJWT returns the principal a JWT was issued to
+func principalFromJWT(ctx context.Context, store Store, tokenString string) (*Principal, error) {
+	claims, err := ParseToken(ctx, store, tokenString)
+	if err != nil {
+		return nil, err
+	}
+
+	userID, err := strconv.Atoi(claims.Subject)
+	if err != nil {
+		return nil, errors.New("invalid token subject")
+	}
+
+	return &Principal{
+		UserID:    userID,
+		Username:  claims.Username,
+		Scopes:    claims.Scopes(),
+		TokenID:   claims.Id,
+		ExpiresAt: time.Unix(claims.ExpiresAt, 0),
+	}, nil
+}
+
+// principalFromPersonalAccessToken returns the owner of a personal access token,
+// as long as they are still granted the token scopes
+func principalFromPersonalAccessToken(ctx context.Context, store Store, tokenString string) (*Principal, error) {
+	t, err := GetPersonalAccessToken(ctx, store, tokenString)
+	if err != nil {
+		return nil, errors.New("invalid personal access token")
+	}
+
+	user, err := store.GetUserByID(ctx, t.UserID)
+	if err != nil {
+		return nil, errors.New("invalid personal access token")
+	}
+
+	scopes := ParseScopes(t.Scope)
+	if !user.CanUseScopes(ctx, store, scopes) {
+		return nil, errors.New("invalid personal access token scope")
+	}
+
+	principal := &Principal{
+		UserID:                user.ID,
+		Username:              user.Username,
+		Scopes:                scopes,
+		PersonalAccessTokenID: t.ID,
+	}
+	if t.ExpiresAt != nil {
+		principal.ExpiresAt = *t.ExpiresAt
+	}
+	return principal, nil
+}
+
+// CheckToken returns an error if the token the principal authenticated with expired or was revoked since,
+// for connections outliving the request that opened them
+func (p *Principal) CheckToken(ctx context.Context, store Store, now time.Time) error {
+	if !p.ExpiresAt.IsZero() && !now.Before(p.ExpiresAt) {
+		return ErrTokenExpired
+	}
+	if p.PersonalAccessTokenID != 0 {
+		_, err := store.GetPersonalAccessTokenByID(ctx, p.PersonalAccessTokenID)
+		return err
+	}
+	_, err := store.GetAccessTokenByID(ctx, p.TokenID)
+	return err
+}
+
+// IsAdmin returns true if the principal was granted the admin scope, which gives access to any resource
+func (p *Principal) IsAdmin() bool {
+	return p.Scopes.Has("admin")
+}
+
+// OwnsUser returns true if the principal is the given user
+func (p *Principal) OwnsUser(user *User) bool {
+	return p.UserID == user.ID && p.Username == user.Username
+}
+
+// OwnsProject returns true if the given project belongs to the principal
+func (p *Principal) OwnsProject(project *Project) bool {
+	return p.UserID == project.UserID
+}
+
+// OwnsSprint returns true if the given sprint is on one of the principal’s projects
+func (p *Principal) OwnsSprint(sprint *Sprint) bool {
+	return p.Username == sprint.Username
+}
@@ -1,9 +1,7 @@
 package main
 
 import (
-	"github.com/jmoiron/sqlx"
-	_ "github.com/lib/pq"
-
+	"context"
 	"errors"
 	"log"
 	"time"
@@ -43,135 +41,99 @@ type Project struct {
 }
 
 // FetchProjects fetches a user’s projects and returns an error or nil on success
-func (u *User) FetchProjects() error {
-	db, err := sqlx.Open("postgres", connStr)
+func (u *User) FetchProjects(ctx context.Context, store Store) error {
+	projects, err := store.GetUserProjects(ctx, u)
 	if err != nil {
 		return err
 	}
-	defer db.Close()
 
-	rows, err := db.Queryx("select * from autochrone.projects where user_id = $1 order by name", u.ID)
-	if err != nil {
-		return err
-	}
-	u.Projects = []*Project{}
-	for rows.Next() {
-		p := &Project{}
-		if err := rows.StructScan(p); err != nil {
-			return err
-		}
+	u.Projects = projects
+	return nil
+}
 
-		u.Projects = append(u.Projects, p)
+// NewProject creates a projects for the given user, inserts it in the database and returns it alongside a potential error.
+func (u *User) NewProject(ctx context.Context, store Store, name, slug string, dateStart, dateEnd time.Time, wordCountStart, wordCountGoal int) (*Project, error) {
+	p := &Project{
+		UserID:         u.ID,
+		Name:           name,
+		Slug:           slug,
+		DateStart:      dateStart,
+		DateEnd:        dateEnd,
+		WordCountStart: wordCountStart,
+		WordCountGoal:  wordCountGoal,
 	}
 
-	return nil
-}
+	log.Print(p)
 
-// GetProjectByID returns the project with the given ID and nil or nil and an error
-func GetProjectByID(id int) (*Project, error) {
-	db, err := sqlx.Open("postgres", connStr)
-	if err != nil {
-		return nil, err
+	if p.Name == "" || p.Slug == "" || p.DateStart.Before(LocalDate(time.Now(), u.Location())) || p.DateEnd.Before(p.DateStart) || p.WordCountStart < 0 || p.WordCountGoal < p.WordCountStart {
+		return nil, errors.New("NewProject: invalid data")
 	}
-	defer db.Close()
 
-	row := db.QueryRowx("select * from autochrone.projects where id = $1", id)
-	p := &Project{}
-	if err := row.StructScan(p); err != nil {
+	if err := store.InsertProject(ctx, p); err != nil {
 		return nil, err
 	}
 
 	return p, nil
 }
 
-// GetProjectBySlug retrieves the project with the given slug belonging to the current user, and a potential error value
-func (u *User) GetProjectBySlug(slug string) (*Project, error) {
-	db, err := sqlx.Open("postgres", connStr)
-	if err != nil {
+// GetUserProjects returns a user’s projects ordered by name
+func (store *PostgresStore) GetUserProjects(ctx context.Context, u *User) ([]*Project, error) {
+	projects := []*Project{}
+	if err := store.db.SelectContext(ctx, &projects, "select * from autochrone.projects where user_id = $1 order by name", u.ID); err != nil {
 		return nil, err
 	}
-	defer db.Close()
 
+	return projects, nil
+}
+
+// GetProjectByID returns the project with the given ID and nil or nil and an error
+func (store *PostgresStore) GetProjectByID(ctx context.Context, id int) (*Project, error) {
 	p := &Project{}
-	if err := db.Get(p, "select * from autochrone.projects where user_id = $1 and slug = $2", u.ID, slug); err != nil {
+	if err := store.db.GetContext(ctx, p, "select * from autochrone.projects where id = $1", id); err != nil {
 		return nil, err
 	}
 
 	return p, nil
 }
 
-// NewProject creates a projects for the given user, inserts it in the database and returns it alongside a potential error.
-func (u *User) NewProject(name, slug string, dateStart, dateEnd time.Time, wordCountStart, wordCountGoal int) (*Project, error) {
-	p := &Project{
-		UserID:         u.ID,
-		Name:           name,
-		Slug:           slug,
-		DateStart:      dateStart,
-		DateEnd:        dateEnd,
-		WordCountStart: wordCountStart,
-		WordCountGoal:  wordCountGoal,
-	}
-
-	log.Print(p)
-
-	if p.Name == "" || p.Slug == "" || p.DateStart.Before(time.Now().Truncate(time.Hour*time.Duration(24))) || p.DateEnd.Before(p.DateStart) || p.WordCountStart < 0 || p.WordCountGoal < p.WordCountStart {
-		return nil, errors.New("NewProject: invalid data")
-	}
-
-	db, err := sqlx.Open("postgres", connStr)
-	if err != nil {
+// GetProjectBySlug retrieves the project with the given slug belonging to the given user, and a potential error value
+func (store *PostgresStore) GetProjectBySlug(ctx context.Context, u *User, slug string) (*Project, error) {
+	p := &Project{}
+	if err := store.db.GetContext(ctx, p, "select * from autochrone.projects where user_id = $1 and slug = $2", u.ID, slug); err != nil {
 		return nil, err
 	}
-	defer db.Close()
 
-	row := db.QueryRowx(`
+	return p, nil
+}
+
+// InsertProject inserts a new project in the database and sets its ID
+func (store *PostgresStore) InsertProject(ctx context.Context, p *Project) error {
+	row := store.db.QueryRowxContext(ctx, `
 		insert into autochrone.projects(
 			user_id, name, slug, date_start, date_end, word_count_start, word_count_goal
 		) values ($1, $2, $3, $4, $5, $6, $7)
 		returning id
 	`, p.UserID, p.Name, p.Slug, p.DateStart, p.DateEnd, p.WordCountStart, p.WordCountGoal)
-	if err := row.Scan(&(p.ID)); err != nil {
-		return nil, err
-	}
-
-	return p, nil
+	return row.Scan(&(p.ID))
 }
 
-// Update saves an existing project in the database and returns a potential error
-func (p *Project) Update() error {
-	db, err := sqlx.Open("postgres", connStr)
-	if err != nil {
-		return err
-	}
-	defer db.Close()
-
-	_, err = db.Queryx(`update autochrone.projects
+// UpdateProject saves an existing project in the database and returns a potential error
+func (store *PostgresStore) UpdateProject(ctx context.Context, p *Project) error {
+	_, err := store.db.ExecContext(ctx, `update autochrone.projects
 		set (user_id, name, slug, date_start, date_end, word_count_start, word_count_goal)
 		= ($1, $2, $3, $4, $5, $6, $7)
 		where id = $8`, p.UserID, p.Name, p.Slug, p.DateStart, p.DateEnd, p.WordCountStart, p.WordCountGoal, p.ID)
-	if err != nil {
-		return err
-	}
-
-	return nil
+	return err
 }
 
-// Delete deletes a project from the database along with all of the sprints on it
-func (p *Project) Delete() error {
-	db, err := sqlx.Open("postgres", connStr)
-	if err != nil {
-		return err
-	}
-	defer db.Close()
+// DeleteProject deletes a project from the database along with all of the sprints on it
+func (store *PostgresStore) DeleteProject(ctx context.Context, p *Project) error {
+	return store.inTx(ctx, func(tx *PostgresStore) error {
+		if _, err := tx.db.ExecContext(ctx, "delete from autochrone.sprints where project_id = $1", p.ID); err != nil {
+			return err
+		}
 
-	_, err = db.Queryx("delete from autochrone.sprints where project_id = $1", p.ID)
-	if err != nil {
+		_, err := tx.db.ExecContext(ctx, "delete from autochrone.projects where id = $1", p.ID)
 		return err
-	}
-	_, err = db.Queryx("delete from autochrone.projects where id = $1", p.ID)
-	if err != nil {
-		return err
-	}
-
-	return nil
+	})
 }
@@ -10,8 +10,10 @@ import (
 
 // ProjectsGET responds with all projects for a given user
 func ProjectsGET(c *gin.Context) {
+	store := c.MustGet("store").(Store)
+	ctx := c.Request.Context()
 	user := c.MustGet("user").(*User)
-	if err := user.FetchProjects(); err != nil {
+	if err := user.FetchProjects(ctx, store); err != nil {
 		c.JSON(http.StatusInternalServerError, nil)
 		return
 	}
@@ -31,19 +33,21 @@ type ProjectRequest struct {
 
 // ProjectsPOST adds a new project and responds with its API location in a Location header
 func ProjectsPOST(c *gin.Context) {
+	store := c.MustGet("store").(Store)
+	ctx := c.Request.Context()
 	user := c.MustGet("user").(*User)
 	req := &ProjectRequest{}
 	if err := c.BindJSON(req); err != nil {
 		return
 	}
 
-	dateStart, errDateStart := time.Parse("2006-01-02", req.DateStart)
-	dateEnd, errDateEnd := time.Parse("2006-01-02", req.DateEnd)
+	dateStart, errDateStart := ParseDate(req.DateStart)
+	dateEnd, errDateEnd := ParseDate(req.DateEnd)
 	if errDateStart != nil || errDateEnd != nil {
 		c.AbortWithStatus(http.StatusBadRequest)
 		return
 	}
-	project, err := user.NewProject(req.Name, req.Slug, dateStart, dateEnd, req.WordCountStart, req.WordCountGoal)
+	project, err := user.NewProject(ctx, store, req.Name, req.Slug, dateStart, dateEnd, req.WordCountStart, req.WordCountGoal)
 	if err != nil {
 		c.AbortWithStatus(http.StatusInternalServerError)
 		return
@@ -60,8 +64,86 @@ func ProjectsSlugGET(c *gin.Context) {
 	c.JSON(http.StatusOK, project)
 }
 
+// ProjectsSlugStatsGET responds with the statistics of a project: words written and remaining, pace and projected completion date.
+// Days are counted in the user’s time zone.
+func ProjectsSlugStatsGET(c *gin.Context) {
+	store := c.MustGet("store").(Store)
+	ctx := c.Request.Context()
+	user := c.MustGet("user").(*User)
+	project := c.MustGet("project").(*Project)
+
+	stats, err := project.GetStats(ctx, store, time.Now(), user.Location())
+	if err != nil {
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	c.JSON(http.StatusOK, stats)
+}
+
+// ProjectsSlugMilestonesGET responds with the milestones of a project, with the words, time and speed since the previous one
+func ProjectsSlugMilestonesGET(c *gin.Context) {
+	store := c.MustGet("store").(Store)
+	ctx := c.Request.Context()
+	project := c.MustGet("project").(*Project)
+
+	milestones, err := project.GetMilestones(ctx, store)
+	if err != nil {
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	c.JSON(http.StatusOK, milestones)
+}
+
+// ProjectsSlugCalendarGET responds with the days of a project with their sprints, totals and target.
+// Optional query parameters: tz the IANA time zone grouping sprints by local date (default the user’s),
+// from and to the first and last dates (default the project dates).
+func ProjectsSlugCalendarGET(c *gin.Context) {
+	store := c.MustGet("store").(Store)
+	ctx := c.Request.Context()
+	user := c.MustGet("user").(*User)
+	project := c.MustGet("project").(*Project)
+
+	var err error
+	loc := user.Location()
+	if c.Query("tz") != "" {
+		if loc, err = LoadTimezone(c.Query("tz")); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid time zone %q", c.Query("tz"))})
+			return
+		}
+	}
+
+	from, to := project.DateStart, project.DateEnd
+	if c.Query("from") != "" {
+		if from, err = ParseDate(c.Query("from")); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid date %q", c.Query("from"))})
+			return
+		}
+	}
+	if c.Query("to") != "" {
+		if to, err = ParseDate(c.Query("to")); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid date %q", c.Query("to"))})
+			return
+		}
+	}
+
+	days, err := project.GetCalendar(ctx, store, loc, from, to)
+	if err == ErrInvalidDateRange {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	} else if err != nil {
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	c.JSON(http.StatusOK, days)
+}
+
 // ProjectsSlugPUT updates a whole project
 func ProjectsSlugPUT(c *gin.Context) {
+	store := c.MustGet("store").(Store)
+	ctx := c.Request.Context()
 	project := c.MustGet("project").(*Project)
 	req := &ProjectRequest{}
 	if err := c.BindJSON(req); err != nil {
@@ -73,8 +155,8 @@ func ProjectsSlugPUT(c *gin.Context) {
 		return
 	}
 
-	dateStart, errDateStart := time.Parse("2006-01-02", req.DateStart)
-	dateEnd, errDateEnd := time.Parse("2006-01-02", req.DateEnd)
+	dateStart, errDateStart := ParseDate(req.DateStart)
+	dateEnd, errDateEnd := ParseDate(req.DateEnd)
 	if errDateStart != nil || errDateEnd != nil {
 		c.AbortWithStatus(http.StatusBadRequest)
 		return
@@ -85,7 +167,7 @@ func ProjectsSlugPUT(c *gin.Context) {
 	project.DateEnd = dateEnd
 	project.WordCountStart = req.WordCountStart
 	project.WordCountGoal = req.WordCountGoal
-	if err := project.Update(); err != nil {
+	if err := store.UpdateProject(ctx, project); err != nil {
 		c.AbortWithStatus(http.StatusInternalServerError)
 		return
 	}
@@ -95,9 +177,11 @@ func ProjectsSlugPUT(c *gin.Context) {
 
 // ProjectsSlugDELETE deletes a whole project and all its sprints
 func ProjectsSlugDELETE(c *gin.Context) {
+	store := c.MustGet("store").(Store)
+	ctx := c.Request.Context()
 	project := c.MustGet("project").(*Project)
 
-	if err := project.Delete(); err != nil {
+	if err := store.DeleteProject(ctx, project); err != nil {
 		c.Status(http.StatusInternalServerError)
 	}
 
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"github.com/gin-gonic/gin"
+
+	"context"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestOwnership(t *testing.T) {
+	store := NewMemoryStore()
+	r := NewRouter(store, NewRoomHub())
+	testSignUp(t, r, "alice")
+	testSignUp(t, r, "bob")
+	testSignUp(t, r, "carol")
+	alice := testLogIn(t, r, "alice", "basic").AccessToken
+	bob := testLogIn(t, r, "bob", "basic").AccessToken
+
+	carol, err := store.GetUserByUsername(context.Background(), "carol")
+	if err != nil {
+		t.Fatal(err)
+	}
+	admin, err := store.GetRoleByName(context.Background(), "admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.AddUserRole(context.Background(), carol, admin); err != nil {
+		t.Fatal(err)
+	}
+	carolAdmin := testLogIn(t, r, "carol", "admin").AccessToken
+
+	project := testProject(t, r, alice, "alice", "novel")
+	sprint := testSprint(t, r, alice, project, time.Now().Add(time.Hour), 20)
+
+	for _, tc := range []struct {
+		name   string
+		method string
+		path   string
+		body   interface{}
+	}{
+		{"update project", http.MethodPut, project, gin.H{"name": "Mine", "slug": "novel", "dateStart": "2030-01-01", "dateEnd": "2030-01-31", "wordCountGoal": 1}},
+		{"create sprint", http.MethodPost, project + "/sprints/", gin.H{"timeStart": time.Now().Format(time.RFC3339), "duration": 10}},
+		{"update sprint", http.MethodPut, sprint, gin.H{"wordCount": 1000}},
+		{"delete sprint", http.MethodDelete, sprint, nil},
+		{"delete project", http.MethodDelete, project, nil},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if w := testRequest(r, tc.method, tc.path, "", tc.body); w.Code != http.StatusUnauthorized {
+				t.Errorf("anonymous: status %d, want %d", w.Code, http.StatusUnauthorized)
+			}
+			if w := testRequest(r, tc.method, tc.path, bob, tc.body); w.Code != http.StatusForbidden {
+				t.Errorf("another user: status %d, want %d", w.Code, http.StatusForbidden)
+			}
+		})
+	}
+
+	// alice’s project and sprint are untouched, and an admin may change them
+	w := testRequest(r, http.MethodGet, sprint, "", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("get sprint: status %d", w.Code)
+	}
+	s := &Sprint{}
+	decodeJSON(t, w, s)
+	if s.WordCount != 0 {
+		t.Errorf("word count %d after forbidden update, want 0", s.WordCount)
+	}
+	if w := testRequest(r, http.MethodPut, sprint, carolAdmin, gin.H{"wordCount": 1000}); w.Code != http.StatusOK {
+		t.Errorf("admin: status %d, want %d", w.Code, http.StatusOK)
+	}
+	if w := testRequest(r, http.MethodPut, sprint, alice, gin.H{"wordCount": 500}); w.Code != http.StatusOK {
+		t.Errorf("owner: status %d, want %d", w.Code, http.StatusOK)
+	}
+
+	// a sprint is only found on its own project
+	other := testProject(t, r, bob, "bob", "essay")
+	if w := testRequest(r, http.MethodGet, other+"/sprints/"+s.Slug, "", nil); w.Code != http.StatusNotFound {
+		t.Errorf("sprint on another project: status %d, want %d", w.Code, http.StatusNotFound)
+	}
+}
+
+func TestProjectsSlugMilestonesGET(t *testing.T) {
+	r := NewRouter(NewMemoryStore(), NewRoomHub())
+	testSignUp(t, r, "alice")
+	token := testLogIn(t, r, "alice", "basic").AccessToken
+	project := testProject(t, r, token, "alice", "novel")
+
+	start := time.Now().Add(time.Hour).Truncate(time.Minute)
+	for i, sprint := range []struct {
+		wordCount   int
+		duration    int
+		isMilestone bool
+	}{
+		{100, 20, false},
+		{200, 30, true},
+		{300, 10, false},
+		{400, 40, true},
+		{500, 50, false},
+	} {
+		path := testSprint(t, r, token, project, start.Add(time.Duration(i)*time.Hour), sprint.duration)
+		w := testRequest(r, http.MethodPut, path, token, gin.H{"wordCount": sprint.wordCount, "isMilestone": sprint.isMilestone})
+		if w.Code != http.StatusOK {
+			t.Fatalf("update sprint %d: status %d", i, w.Code)
+		}
+	}
+
+	w := testRequest(r, http.MethodGet, project+"/milestones", "", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d", w.Code)
+	}
+	milestones := []*Milestone{}
+	decodeJSON(t, w, &milestones)
+
+	want := []Milestone{
+		{Index: 1, WordCount: 300, Duration: 50, Speed: 6},
+		{Index: 2, WordCount: 700, Duration: 50, Speed: 14},
+	}
+	if len(milestones) != len(want) {
+		t.Fatalf("%d milestones, want %d", len(milestones), len(want))
+	}
+	for i, m := range milestones {
+		if m.Index != want[i].Index || m.WordCount != want[i].WordCount || m.Duration != want[i].Duration || m.Speed != want[i].Speed {
+			t.Errorf("milestone %d = %+v, want %+v", i, *m, want[i])
+		}
+		if !m.TimeStart.Equal(start.Add(time.Duration(2*i+1) * time.Hour)) {
+			t.Errorf("milestone %d starts at %v", i, m.TimeStart)
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// RefreshToken is a single-use token exchanged for a new access token and a new refresh token.
+// Tokens issued from one another share a family, revoked as a whole if a used token is presented again.
+type RefreshToken struct {
+	// ID the sha256 hash of the token, which is never stored
+	ID string `db:"id"`
+
+	// FamilyID the ID shared by all the refresh and access tokens issued since authentication
+	FamilyID string `db:"family_id"`
+
+	// UserID the ID of the user the token was issued to
+	UserID int `db:"user_id"`
+
+	// Scope the space separated scopes of the access tokens issued with this token
+	Scope string `db:"scope"`
+
+	// IssuedAt the moment the token was issued
+	IssuedAt time.Time `db:"issued_at"`
+
+	// ExpiresAt the moment the token expires
+	ExpiresAt time.Time `db:"expires_at"`
+
+	// Used whether the token was already exchanged
+	Used bool `db:"used"`
+}
+
+// TokenPair is an access token along with the refresh token used to renew it
+type TokenPair struct {
+	// AccessToken the signed access token
+	AccessToken string `json:"token"`
+
+	// RefreshToken the opaque refresh token
+	RefreshToken string `json:"refreshToken"`
+
+	// ExpiresIn the access token lifetime in seconds
+	ExpiresIn int `json:"expiresIn"`
+}
+
+// ErrRefreshTokenReused is returned when a refresh token is exchanged more than once
+var ErrRefreshTokenReused = errors.New("refresh token reuse")
+
+// hashRefreshToken returns the identifier under which a refresh token is stored
+func hashRefreshToken(token string) string {
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(token)))
+}
+
+// NewRefreshToken generates a refresh token in the given family, records its hash and returns it
+func (u *User) NewRefreshToken(ctx context.Context, store Store, familyID string, scopes Scopes) (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(b)
+
+	now := time.Now().UTC()
+	rt := &RefreshToken{
+		ID:        hashRefreshToken(token),
+		FamilyID:  familyID,
+		UserID:    u.ID,
+		Scope:     scopes.String(),
+		IssuedAt:  now,
+		ExpiresAt: now.Add(config.Tokens.RefreshTokenLifetime),
+	}
+	if err := store.InsertRefreshToken(ctx, rt); err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// GetRefreshToken returns the unexpired refresh token record matching the given token and a potential error
+func GetRefreshToken(ctx context.Context, store Store, token string) (*RefreshToken, error) {
+	return store.GetRefreshTokenByID(ctx, hashRefreshToken(token))
+}
+
+// GenerateTokenPair generates an access token and a refresh token in the session family.
+// A new family is started if the session has none.
+func (u *User) GenerateTokenPair(ctx context.Context, store Store, scopes Scopes, session SessionInfo) (*TokenPair, error) {
+	if session.FamilyID == "" {
+		familyID, err := GenerateTokenID()
+		if err != nil {
+			return nil, err
+		}
+		session.FamilyID = familyID
+	}
+
+	var accessToken, refreshToken string
+	err := store.Transaction(ctx, func(tx Store) error {
+		var err error
+		if accessToken, err = u.GenerateToken(ctx, tx, scopes, session); err != nil {
+			return err
+		}
+
+		refreshToken, err = u.NewRefreshToken(ctx, tx, session.FamilyID, scopes)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &TokenPair{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int(config.Tokens.AccessTokenLifetime / time.Second),
+	}, nil
+}
+
+// InsertRefreshToken records a refresh token
+func (store *PostgresStore) InsertRefreshToken(ctx context.Context, rt *RefreshToken) error {
+	_, err := store.db.ExecContext(ctx, `insert into autochrone.refresh_tokens
+		(id, family_id, user_id, scope, issued_at, expires_at)
+		values ($1, $2, $3, $4, $5, $6)`, rt.ID, rt.FamilyID, rt.UserID, rt.Scope, rt.IssuedAt, rt.ExpiresAt)
+	return err
+}
+
+// GetRefreshTokenByID returns the unexpired refresh token with the given ID and a potential error
+func (store *PostgresStore) GetRefreshTokenByID(ctx context.Context, id string) (*RefreshToken, error) {
+	rt := &RefreshToken{}
+	if err := store.db.GetContext(ctx, rt, "select * from autochrone.refresh_tokens where id = $1 and expires_at >= $2", id, time.Now().UTC()); err != nil {
+		return nil, err
+	}
+
+	return rt, nil
+}
+
+// UseRefreshToken marks the refresh token as exchanged.
+// Returns ErrRefreshTokenReused if it already was.
+func (store *PostgresStore) UseRefreshToken(ctx context.Context, rt *RefreshToken) error {
+	res, err := store.db.ExecContext(ctx, "update autochrone.refresh_tokens set used = true where id = $1 and used = false", rt.ID)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrRefreshTokenReused
+	}
+
+	rt.Used = true
+	return nil
+}
+
+// DeleteTokenFamily deletes all refresh and access tokens in the given family
+func (store *PostgresStore) DeleteTokenFamily(ctx context.Context, familyID string) error {
+	return store.inTx(ctx, func(tx *PostgresStore) error {
+		if _, err := tx.db.ExecContext(ctx, "delete from autochrone.refresh_tokens where family_id = $1", familyID); err != nil {
+			return err
+		}
+
+		_, err := tx.db.ExecContext(ctx, "delete from autochrone.access_tokens where family_id = $1", familyID)
+		return err
+	})
+}
@@ -0,0 +1,62 @@
+package main
+
+import "context"
+
+// Role is a named set of scopes granted to users
+type Role struct {
+	// ID the role identifier
+	ID int `db:"id" json:"id"`
+
+	// Name the role name, unique
+	Name string `db:"name" json:"name"`
+}
+
+// GetRoleByName returns the role with the given name and a potential error
+func (store *PostgresStore) GetRoleByName(ctx context.Context, name string) (*Role, error) {
+	r := &Role{}
+	if err := store.db.GetContext(ctx, r, "select id, name from autochrone.roles where name = $1", name); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// GetUserRoles returns the roles granted to the user
+func (store *PostgresStore) GetUserRoles(ctx context.Context, u *User) ([]*Role, error) {
+	roles := []*Role{}
+	if err := store.db.SelectContext(ctx, &roles, `select roles.id, roles.name
+		from autochrone.roles
+		inner join autochrone.user_roles on roles.id = user_roles.role_id
+		where user_roles.user_id = $1
+		order by roles.name`, u.ID); err != nil {
+		return nil, err
+	}
+
+	return roles, nil
+}
+
+// GetUserScopes returns the scopes granted to the user by all of their roles
+func (store *PostgresStore) GetUserScopes(ctx context.Context, u *User) (Scopes, error) {
+	scopes := Scopes{}
+	if err := store.db.SelectContext(ctx, &scopes, `select distinct role_scopes.scope
+		from autochrone.role_scopes
+		inner join autochrone.user_roles on role_scopes.role_id = user_roles.role_id
+		where user_roles.user_id = $1
+		order by role_scopes.scope`, u.ID); err != nil {
+		return nil, err
+	}
+
+	return scopes, nil
+}
+
+// AddUserRole grants a role to the user, does nothing if it already was
+func (store *PostgresStore) AddUserRole(ctx context.Context, u *User, role *Role) error {
+	_, err := store.db.ExecContext(ctx, "insert into autochrone.user_roles (user_id, role_id) values ($1, $2) on conflict do nothing", u.ID, role.ID)
+	return err
+}
+
+// RemoveUserRole revokes a role from the user
+func (store *PostgresStore) RemoveUserRole(ctx context.Context, u *User, role *Role) error {
+	_, err := store.db.ExecContext(ctx, "delete from autochrone.user_roles where user_id = $1 and role_id = $2", u.ID, role.ID)
+	return err
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"github.com/gin-gonic/gin"
+
+	"net/http"
+)
+
+// RolesGET responds with the roles of a user and the scopes they grant
+func RolesGET(c *gin.Context) {
+	store := c.MustGet("store").(Store)
+	ctx := c.Request.Context()
+	user := c.MustGet("user").(*User)
+
+	roles, err := store.GetUserRoles(ctx, user)
+	if err != nil {
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	scopes, err := store.GetUserScopes(ctx, user)
+	if err != nil {
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"roles": roles, "scopes": scopes})
+}
+
+// RolesNamePUT grants a role to a user
+func RolesNamePUT(c *gin.Context) {
+	store := c.MustGet("store").(Store)
+	ctx := c.Request.Context()
+	user := c.MustGet("user").(*User)
+
+	role, err := store.GetRoleByName(ctx, c.Param("role"))
+	if err != nil {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+
+	if err := store.AddUserRole(ctx, user, role); err != nil {
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	c.Status(http.StatusOK)
+}
+
+// RolesNameDELETE revokes a role from a user
+func RolesNameDELETE(c *gin.Context) {
+	store := c.MustGet("store").(Store)
+	ctx := c.Request.Context()
+	user := c.MustGet("user").(*User)
+
+	role, err := store.GetRoleByName(ctx, c.Param("role"))
+	if err != nil {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+
+	if err := store.RemoveUserRole(ctx, user, role); err != nil {
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	c.Status(http.StatusOK)
+}
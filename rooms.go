@@ -0,0 +1,277 @@
+package main
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Room event types
+const (
+	roomEventState     = "state"
+	roomEventTick      = "tick"
+	roomEventStart     = "start"
+	roomEventEnd       = "end"
+	roomEventBreakOver = "break-over"
+	roomEventJoin      = "join"
+	roomEventLeave     = "leave"
+	roomEventWordCount = "word-count"
+	roomEventClosed    = "closed"
+)
+
+// roomClientBuffer the number of events queued for a client before it is considered too slow and dropped
+const roomClientBuffer = 32
+
+// RoomEvent is sent to the participants of a sprint room
+type RoomEvent struct {
+	// Type the event type: state, tick, start, end, break-over, join, leave, word-count or closed
+	Type string `json:"type"`
+
+	// Time the moment the event happened
+	Time time.Time `json:"time"`
+
+	// Phase the phase of the host sprint: upcoming, running, break or over
+	Phase string `json:"phase,omitempty"`
+
+	// Remaining the number of seconds until the next phase, for state and tick events
+	Remaining int `json:"remaining,omitempty"`
+
+	// Username the participant who joined, left or updated their word count
+	Username string `json:"username,omitempty"`
+
+	// SprintSlug the slug of the sprint whose word count was updated
+	SprintSlug string `json:"sslug,omitempty"`
+
+	// WordCount the updated word count
+	WordCount *int `json:"wordCount,omitempty"`
+
+	// Participants the usernames of the participants connected to the room, for state, join and leave events
+	Participants []string `json:"participants,omitempty"`
+}
+
+// RoomClient is a connection to a sprint room
+type RoomClient struct {
+	// Username the participant behind the connection
+	Username string
+
+	// Events the events to send to the participant, closed when the client leaves or is dropped
+	Events chan RoomEvent
+
+	room   *room
+	closed bool
+}
+
+// room is the set of clients connected to a host sprint
+type room struct {
+	host    Sprint
+	clients map[*RoomClient]struct{}
+	stop    chan struct{}
+}
+
+// RoomHub fans out the events of sprint rooms to their clients, in process.
+// A room exists while at least one client is connected to it, and ticks every TickInterval.
+type RoomHub struct {
+	// TickInterval the time between two tick events
+	TickInterval time.Duration
+
+	// TokenCheckInterval the time between two checks that the token of a client was not revoked
+	TokenCheckInterval time.Duration
+
+	// Now returns the current time
+	Now func() time.Time
+
+	mu    sync.Mutex
+	rooms map[int]*room
+}
+
+// NewRoomHub returns an empty hub ticking every second and checking tokens every 30 seconds
+func NewRoomHub() *RoomHub {
+	return &RoomHub{
+		TickInterval:       time.Second,
+		TokenCheckInterval: 30 * time.Second,
+		Now:                time.Now,
+		rooms:              map[int]*room{},
+	}
+}
+
+// Join connects a participant to the room of the host sprint, starting it if needed.
+// The client first receives the state of the room, then everyone receives a join event.
+func (h *RoomHub) Join(host *Sprint, username string) *RoomClient {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	r, ok := h.rooms[host.ID]
+	if !ok {
+		r = &room{host: *host, clients: map[*RoomClient]struct{}{}, stop: make(chan struct{})}
+		h.rooms[host.ID] = r
+		go h.run(r)
+	}
+
+	client := &RoomClient{Username: username, Events: make(chan RoomEvent, roomClientBuffer), room: r}
+	r.clients[client] = struct{}{}
+
+	state := h.phaseEvent(r, roomEventState, h.Now())
+	state.Participants = r.participants()
+	client.Events <- state
+
+	h.broadcast(r, RoomEvent{Type: roomEventJoin, Time: h.Now().UTC(), Username: username, Participants: r.participants()})
+	return client
+}
+
+// Leave disconnects the client from its room, stopping the room if it was the last one
+func (h *RoomHub) Leave(client *RoomClient) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	r := client.room
+	h.drop(r, client)
+	if len(r.clients) == 0 {
+		if h.rooms[r.host.ID] == r {
+			delete(h.rooms, r.host.ID)
+			close(r.stop)
+		}
+		return
+	}
+
+	h.broadcast(r, RoomEvent{Type: roomEventLeave, Time: h.Now().UTC(), Username: client.Username, Participants: r.participants()})
+}
+
+// Publish sends the event to every client of the room of the host sprint with the given ID, if it exists
+func (h *RoomHub) Publish(hostSprintID int, event RoomEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if r, ok := h.rooms[hostSprintID]; ok {
+		if event.Time.IsZero() {
+			event.Time = h.Now().UTC()
+		}
+		h.broadcast(r, event)
+	}
+}
+
+// Close sends a closed event to every client of the room of the host sprint with the given ID, if it exists,
+// then drops them and stops the room
+func (h *RoomHub) Close(hostSprintID int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	r, ok := h.rooms[hostSprintID]
+	if !ok {
+		return
+	}
+	h.broadcast(r, RoomEvent{Type: roomEventClosed, Time: h.Now().UTC()})
+	for client := range r.clients {
+		h.drop(r, client)
+	}
+	delete(h.rooms, hostSprintID)
+	close(r.stop)
+}
+
+// broadcast queues the event for every client of the room, dropping those whose queue is full.
+// Must be called with the hub locked.
+func (h *RoomHub) broadcast(r *room, event RoomEvent) {
+	for client := range r.clients {
+		select {
+		case client.Events <- event:
+		default:
+			h.drop(r, client)
+		}
+	}
+}
+
+// drop removes the client from the room and closes its events.
+// Must be called with the hub locked.
+func (h *RoomHub) drop(r *room, client *RoomClient) {
+	delete(r.clients, client)
+	if !client.closed {
+		close(client.Events)
+		client.closed = true
+	}
+}
+
+// run ticks the room and sends phase transitions until it stops
+func (h *RoomHub) run(r *room) {
+	ticker := time.NewTicker(h.TickInterval)
+	defer ticker.Stop()
+
+	h.mu.Lock()
+	phase, _ := r.host.Phase(h.Now())
+	h.mu.Unlock()
+
+	for {
+		select {
+		case <-r.stop:
+			return
+		case <-ticker.C:
+		}
+
+		h.mu.Lock()
+		now := h.Now()
+		newPhase, _ := r.host.Phase(now)
+		for _, eventType := range phaseTransitions(&r.host, phase, newPhase) {
+			h.broadcast(r, h.phaseEvent(r, eventType, now))
+		}
+		if newPhase != sprintOver {
+			h.broadcast(r, h.phaseEvent(r, roomEventTick, now))
+		}
+		phase = newPhase
+		h.mu.Unlock()
+	}
+}
+
+// phaseEvent returns an event of the given type with the phase of the room’s host sprint at the given time
+func (h *RoomHub) phaseEvent(r *room, eventType string, now time.Time) RoomEvent {
+	phase, next := r.host.Phase(now)
+	event := RoomEvent{Type: eventType, Time: now.UTC(), Phase: phase}
+	if !next.IsZero() {
+		event.Remaining = int(math.Ceil(next.Sub(now).Seconds()))
+	}
+	return event
+}
+
+// participants returns the sorted usernames of the clients of the room, once each
+func (r *room) participants() []string {
+	seen := map[string]bool{}
+	usernames := []string{}
+	for client := range r.clients {
+		if !seen[client.Username] {
+			seen[client.Username] = true
+			usernames = append(usernames, client.Username)
+		}
+	}
+	sort.Strings(usernames)
+	return usernames
+}
+
+// phaseTransitions returns the events marking the transitions from one phase of the sprint to a later one, in order
+func phaseTransitions(s *Sprint, from, to string) []string {
+	phases := []string{sprintUpcoming, sprintRunning, sprintBreak, sprintOver}
+	index := func(phase string) int {
+		for i, p := range phases {
+			if p == phase {
+				return i
+			}
+		}
+		return -1
+	}
+
+	events := []string{}
+	for i := index(from) + 1; i <= index(to); i++ {
+		switch phases[i] {
+		case sprintRunning:
+			events = append(events, roomEventStart)
+		case sprintBreak:
+			if s.Break > 0 {
+				events = append(events, roomEventEnd)
+			}
+		case sprintOver:
+			if s.Break > 0 {
+				events = append(events, roomEventBreakOver)
+			} else {
+				events = append(events, roomEventEnd)
+			}
+		}
+	}
+	return events
+}
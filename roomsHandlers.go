@@ -0,0 +1,165 @@
+package main
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Sprint room connection settings
+const (
+	// roomWriteWait the time allowed to write an event to a client
+	roomWriteWait = 10 * time.Second
+
+	// roomPongWait the time allowed between two pongs from a client before it is disconnected
+	roomPongWait = 60 * time.Second
+
+	// roomPingPeriod the time between two pings, shorter than roomPongWait
+	roomPingPeriod = roomPongWait * 9 / 10
+)
+
+// roomUpgrader upgrades sprint room requests to WebSocket connections from the allowed CORS origins
+var roomUpgrader = websocket.Upgrader{
+	CheckOrigin: func(r *http.Request) bool {
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			return true
+		}
+		for _, allowed := range config.CORS.AllowOrigins {
+			if allowed == "*" || strings.EqualFold(allowed, origin) {
+				return true
+			}
+		}
+		return false
+	},
+}
+
+// SprintsSlugRoomGET connects the host or a guest of a sprint open to guests to its room over WebSocket.
+// On a guest sprint, connects to the room of its host sprint.
+// Must be used after QueryTokenAuthorization and RoomHubProvider
+func SprintsSlugRoomGET(c *gin.Context) {
+	store := c.MustGet("store").(Store)
+	ctx := c.Request.Context()
+	rooms := c.MustGet("rooms").(*RoomHub)
+	sprint := c.MustGet("sprint").(*Sprint)
+
+	principal := principalFromRequest(c, "basic", "read", "admin")
+	if principal == nil {
+		return
+	}
+
+	// guests connect to the room of their host sprint
+	hostSprint := sprint
+	if host, err := store.GetHostSprint(ctx, sprint); err == nil {
+		hostSprint = host
+	}
+	if _, err := store.GetInvite(ctx, hostSprint.ID); err != nil {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": ErrSprintNotOpen.Error()})
+		return
+	}
+
+	if !principal.IsAdmin() && !principal.OwnsSprint(hostSprint) {
+		joined, err := store.UserJoinedSprint(ctx, principal.UserID, hostSprint)
+		if err != nil {
+			c.AbortWithStatus(http.StatusInternalServerError)
+			return
+		} else if !joined {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": fmt.Sprintf("forbidden for user %q", principal.Username)})
+			return
+		}
+	}
+
+	conn, err := roomUpgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		// the upgrader already responded
+		return
+	}
+	defer conn.Close()
+
+	client := rooms.Join(hostSprint, principal.Username)
+	defer rooms.Leave(client)
+
+	go writeRoomEvents(conn, client)
+	go watchRoomToken(ctx, conn, store, principal, rooms.TokenCheckInterval)
+	readRoomMessages(conn)
+}
+
+// writeRoomEvents sends the events of the client and pings over the connection,
+// until the client’s events are closed or a write fails
+func writeRoomEvents(conn *websocket.Conn, client *RoomClient) {
+	ticker := time.NewTicker(roomPingPeriod)
+	defer ticker.Stop()
+	defer conn.Close()
+
+	for {
+		select {
+		case event, ok := <-client.Events:
+			conn.SetWriteDeadline(time.Now().Add(roomWriteWait))
+			if !ok {
+				conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseGoingAway, "dropped"))
+				return
+			}
+			if err := conn.WriteJSON(event); err != nil {
+				return
+			}
+		case <-ticker.C:
+			conn.SetWriteDeadline(time.Now().Add(roomWriteWait))
+			if err := conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// watchRoomToken closes the connection once the token of the principal expires or is revoked,
+// checking it at the given interval until the context is done
+func watchRoomToken(ctx context.Context, conn *websocket.Conn, store Store, principal *Principal, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var expired <-chan time.Time
+	if !principal.ExpiresAt.IsZero() {
+		timer := time.NewTimer(time.Until(principal.ExpiresAt))
+		defer timer.Stop()
+		expired = timer.C
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-expired:
+		case <-ticker.C:
+			queryCtx, cancel := withQueryTimeout(ctx)
+			err := principal.CheckToken(queryCtx, store, time.Now())
+			cancel()
+			if err == nil || ctx.Err() != nil {
+				continue
+			}
+		}
+
+		conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "token expired or revoked"), time.Now().Add(roomWriteWait))
+		conn.Close()
+		return
+	}
+}
+
+// readRoomMessages discards client messages and handles pongs until the connection fails or is closed
+func readRoomMessages(conn *websocket.Conn) {
+	conn.SetReadLimit(512)
+	conn.SetReadDeadline(time.Now().Add(roomPongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(roomPongWait))
+	})
+
+	for {
+		if _, _, err := conn.ReadMessage(); err != nil {
+			return
+		}
+	}
+}
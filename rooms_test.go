@@ -0,0 +1,124 @@
+package main
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// nextRoomEvent returns the next event queued for the client, failing if there is none
+func nextRoomEvent(t *testing.T, client *RoomClient) RoomEvent {
+	t.Helper()
+	select {
+	case event, ok := <-client.Events:
+		if !ok {
+			t.Fatal("events closed")
+		}
+		return event
+	default:
+		t.Fatal("no event")
+	}
+	return RoomEvent{}
+}
+
+func TestRoomHubClose(t *testing.T) {
+	hub := NewRoomHub()
+	hub.TickInterval = time.Hour
+	host := &Sprint{ID: 1, TimeStart: time.Now().Add(time.Hour), Duration: 20}
+
+	alice := hub.Join(host, "alice")
+	bob := hub.Join(host, "bob")
+	hub.Close(host.ID)
+
+	for _, client := range []*RoomClient{alice, bob} {
+		var last RoomEvent
+		for event := range client.Events {
+			last = event
+		}
+		if last.Type != roomEventClosed {
+			t.Errorf("last event of %s %q, want %q", client.Username, last.Type, roomEventClosed)
+		}
+	}
+
+	// leaving a closed room is harmless and the next participant starts a new one
+	hub.Leave(alice)
+	hub.Leave(bob)
+	carol := hub.Join(host, "carol")
+	defer hub.Leave(carol)
+	if event := nextRoomEvent(t, carol); strings.Join(event.Participants, " ") != "carol" {
+		t.Errorf("participants %v, want [carol]", event.Participants)
+	}
+}
+
+func TestSprintsSlugRoomGET(t *testing.T) {
+	rooms := NewRoomHub()
+	rooms.TokenCheckInterval = 20 * time.Millisecond
+	r := NewRouter(NewMemoryStore(), rooms)
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	testSignUp(t, r, "alice")
+	alice := testLogIn(t, r, "alice", "basic").AccessToken
+	sprint := testSprint(t, r, alice, testProject(t, r, alice, "alice", "novel"), time.Now().Add(time.Hour), 20)
+	if w := testRequest(r, http.MethodPost, sprint+"/open", alice, gin.H{}); w.Code != http.StatusOK {
+		t.Fatalf("open: status %d", w.Code)
+	}
+
+	// dial connects to the room and reads the state and join events
+	dial := func(token string) *websocket.Conn {
+		t.Helper()
+		url := "ws" + strings.TrimPrefix(server.URL, "http") + sprint + "/room?access_token=" + token
+		conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		for i := 0; i < 2; i++ {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return conn
+	}
+	// closeCode reads until the connection is closed and returns the type of the last event and the close code
+	closeCode := func(conn *websocket.Conn) (string, int) {
+		t.Helper()
+		var event RoomEvent
+		for {
+			if err := conn.ReadJSON(&event); err != nil {
+				if ce, ok := err.(*websocket.CloseError); ok {
+					return event.Type, ce.Code
+				}
+				t.Fatal(err)
+			}
+		}
+	}
+
+	// closing the invite closes the room
+	conn := dial(alice)
+	if w := testRequest(r, http.MethodDelete, sprint+"/open", alice, nil); w.Code != http.StatusNoContent {
+		t.Fatalf("close invite: status %d", w.Code)
+	}
+	if last, code := closeCode(conn); last != roomEventClosed || code != websocket.CloseGoingAway {
+		t.Errorf("last event %q, close code %d, want %q, %d", last, code, roomEventClosed, websocket.CloseGoingAway)
+	}
+	conn.Close()
+
+	// logging out closes the connections of the token
+	if w := testRequest(r, http.MethodPost, sprint+"/open", alice, gin.H{}); w.Code != http.StatusOK {
+		t.Fatalf("reopen: status %d", w.Code)
+	}
+	conn = dial(alice)
+	defer conn.Close()
+	if w := testRequest(r, http.MethodPost, "/auth/logout", alice, nil); w.Code != http.StatusOK {
+		t.Fatalf("logout: status %d", w.Code)
+	}
+	if _, code := closeCode(conn); code != websocket.ClosePolicyViolation {
+		t.Errorf("close code %d, want %d", code, websocket.ClosePolicyViolation)
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"strings"
+)
+
+// Scopes is a set of scopes, written as a space separated string in tokens and requests
+type Scopes []string
+
+// ParseScopes splits a space separated string into scopes, ignoring duplicates
+func ParseScopes(s string) Scopes {
+	scopes := Scopes{}
+	for _, scope := range strings.Fields(s) {
+		if !scopes.Has(scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+	return scopes
+}
+
+// String joins the scopes with spaces
+func (scopes Scopes) String() string {
+	return strings.Join(scopes, " ")
+}
+
+// Has returns true if the given scope is in the set
+func (scopes Scopes) Has(scope string) bool {
+	for _, s := range scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// HasAny returns true if at least one of the given scopes is in the set
+func (scopes Scopes) HasAny(others ...string) bool {
+	for _, scope := range others {
+		if scopes.Has(scope) {
+			return true
+		}
+	}
+	return false
+}
+
+// Contains returns true if every scope of the other set is in this set
+func (scopes Scopes) Contains(others Scopes) bool {
+	for _, scope := range others {
+		if !scopes.Has(scope) {
+			return false
+		}
+	}
+	return true
+}
+
+// Covers returns true if every scope of the other set is in this set, or granted by its basic scope:
+// basic gives access to everything but admin
+func (scopes Scopes) Covers(others Scopes) bool {
+	for _, scope := range others {
+		if !scopes.Has(scope) && (scope == "admin" || !scopes.Has("basic")) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"github.com/gin-gonic/gin"
+
+	"net/http"
+)
+
+// SessionsGET responds with the unexpired access tokens of a user
+func SessionsGET(c *gin.Context) {
+	store := c.MustGet("store").(Store)
+	ctx := c.Request.Context()
+	user := c.MustGet("user").(*User)
+	principal := c.MustGet("principal").(*Principal)
+
+	tokens, err := store.GetUserAccessTokens(ctx, user)
+	if err != nil {
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	for _, t := range tokens {
+		t.Current = t.ID == principal.TokenID
+	}
+
+	c.JSON(http.StatusOK, tokens)
+}
+
+// SessionsIDDELETE revokes one of the user’s access tokens
+func SessionsIDDELETE(c *gin.Context) {
+	store := c.MustGet("store").(Store)
+	ctx := c.Request.Context()
+	user := c.MustGet("user").(*User)
+
+	token, err := store.GetAccessTokenByID(ctx, c.Param("id"))
+	if err != nil || token.UserID != user.ID {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+
+	if err := token.Delete(ctx, store); err != nil {
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	c.Status(http.StatusOK)
+}
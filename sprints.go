@@ -2,13 +2,23 @@ package main
 
 import (
 	"github.com/jmoiron/sqlx"
-	_ "github.com/lib/pq"
 
+	"context"
+	"database/sql"
 	"errors"
 	"fmt"
 	"time"
 )
 
+// Guest sprint errors
+var (
+	// ErrSprintAlreadyJoined is returned when a user joins a host sprint for the second time
+	ErrSprintAlreadyJoined = errors.New("sprint already joined")
+
+	// ErrSprintJoinedByHost is returned when the host of a sprint tries to join it
+	ErrSprintJoinedByHost = errors.New("cannot join one’s own sprint")
+)
+
 // Sprint is a sprint on a project
 type Sprint struct {
 	// ID the sprint ID
@@ -49,29 +59,22 @@ type Sprint struct {
 
 	// InviteComment the invite comment, empty if the sprint is not open to guests
 	InviteComment string `db:"invite_comment" json:"inviteComment"`
+
+	// CreatedAt the moment the sprint was created
+	CreatedAt time.Time `db:"created_at" json:"createdAt"`
+
+	// UpdatedAt the moment the sprint was last saved
+	UpdatedAt time.Time `db:"updated_at" json:"updatedAt"`
 }
 
 // FetchSprints fetches the sprints on a given project, returning a potential error
-func (p *Project) FetchSprints() error {
-	db, err := sqlx.Open("postgres", connStr)
-	if err != nil {
-		return err
-	}
-	defer db.Close()
-
-	rows, err := db.Queryx("select * from sprints_with_details where project_id = $1 order by time_start desc", p.ID)
+func (p *Project) FetchSprints(ctx context.Context, store Store) error {
+	sprints, err := store.GetProjectSprints(ctx, p)
 	if err != nil {
 		return err
 	}
-	p.Sprints = []*Sprint{}
-	for rows.Next() {
-		s := &Sprint{}
-		if err := rows.StructScan(s); err != nil {
-			return err
-		}
-		p.Sprints = append(p.Sprints, s)
-	}
 
+	p.Sprints = sprints
 	return nil
 }
 
@@ -84,78 +87,27 @@ type DateSprints struct {
 	Sprints []*Sprint `json:"sprints"`
 }
 
-// GetSprintsByDate returns the sprints for the project grouped by day
-func (p *Project) GetSprintsByDate() ([]DateSprints, error) {
-	var ret []DateSprints
+// GetSprintsByDate returns the sprints for the project grouped by their local date in loc, in the order of p.Sprints
+func (p *Project) GetSprintsByDate(loc *time.Location) ([]DateSprints, error) {
+	ret := []DateSprints{}
+	indexes := map[time.Time]int{}
 
 	for _, s := range p.Sprints {
-		index := -1
-		for i := range ret {
-			if ret[i].Date.UTC() == s.TimeStart.Truncate(24*time.Hour).UTC() {
-				index = i
-				break
-			}
-		}
-		if index == -1 {
-			ret = append(ret, DateSprints{
-				Date:    s.TimeStart.Truncate(24 * time.Hour),
-				Sprints: []*Sprint{s},
-			})
-		} else {
-			ret[index].Sprints = append(ret[index].Sprints, s)
+		date := LocalDate(s.TimeStart, loc)
+		index, ok := indexes[date]
+		if !ok {
+			index = len(ret)
+			indexes[date] = index
+			ret = append(ret, DateSprints{Date: date})
 		}
+		ret[index].Sprints = append(ret[index].Sprints, s)
 	}
 
 	return ret, nil
 }
 
-// GetSprintByID returns the sprint with the given ID and a potential error
-func GetSprintByID(id int) (*Sprint, error) {
-	db, err := sqlx.Open("postgres", connStr)
-	if err != nil {
-		return nil, err
-	}
-	defer db.Close()
-
-	s := &Sprint{}
-	if err := db.Get(s, "select * from sprints_with_details where id = $1", id); err != nil {
-		return nil, err
-	}
-	return s, nil
-}
-
-// GetSprintBySlug returns the sprint with the given slug and a potential error
-func GetSprintBySlug(slug string) (*Sprint, error) {
-	db, err := sqlx.Open("postgres", connStr)
-	if err != nil {
-		return nil, err
-	}
-	defer db.Close()
-
-	s := &Sprint{}
-	if err := db.Get(s, "select * from sprints_with_details where slug = $1", slug); err != nil {
-		return nil, err
-	}
-	return s, nil
-}
-
-// GetSprintByInviteSlug returns the sprint with the given invite slug in autochrone.host_sprints sql table
-func GetSprintByInviteSlug(inviteSlug string) (*Sprint, error) {
-	db, err := sqlx.Open("postgres", connStr)
-	if err != nil {
-		return nil, err
-	}
-	defer db.Close()
-
-	s := &Sprint{}
-	if err := db.Get(s, "select * from sprints_with_details where invite_slug = $1", inviteSlug); err != nil {
-		return nil, err
-	}
-	return s, nil
-}
-
 // NewSprint adds a sprint to a project and inserts it in the database
-func (p *Project) NewSprint(timeStart time.Time, duration, pomodoroBreak int) (*Sprint, error) {
+func (p *Project) NewSprint(ctx context.Context, store Store, timeStart time.Time, duration, pomodoroBreak int) (*Sprint, error) {
 	if duration < 1 || pomodoroBreak < 0 {
 		return nil, errors.New("NewSprint: invalid duration or pomodoroBreak values")
 	}
@@ -168,19 +120,7 @@ func (p *Project) NewSprint(timeStart time.Time, duration, pomodoroBreak int) (*
 		Break:     pomodoroBreak,
 	}
 
-	db, err := sqlx.Open("postgres", connStr)
-	if err != nil {
-		return nil, err
-	}
-	defer db.Close()
-
-	row := db.QueryRowx(`
-		insert into autochrone.sprints(
-			slug, project_id, time_start, duration, break, word_count, is_milestone, comment
-		) values ($1, $2, $3, $4, $5, $6, $7, $8)
-		returning id
-	`, s.Slug, s.ProjectID, s.TimeStart.UTC().Format("2006-01-02 15:04:05"), s.Duration, s.Break, 0, false, "")
-	if err := row.Scan(&(s.ID)); err != nil {
+	if err := store.InsertSprint(ctx, s); err != nil {
 		return nil, err
 	}
 
@@ -188,54 +128,13 @@ func (p *Project) NewSprint(timeStart time.Time, duration, pomodoroBreak int) (*
 	return s, nil
 }
 
-// Update saves an existing sprint in the database
-func (s *Sprint) Update() error {
-	db, err := sqlx.Open("postgres", connStr)
-	if err != nil {
-		return err
-	}
-	defer db.Close()
-
-	_, err = db.Queryx(`update autochrone.sprints
-		set (time_start, duration, break, word_count, is_milestone, comment)
-		= ($1, $2, $3, $4, $5, $6)
-		where id = $7`, s.TimeStart.UTC().Format("2006-01-02 15:04:05"), s.Duration, s.Break, s.WordCount, s.IsMilestone, s.Comment, s.ID)
-	if err != nil {
-		return err
-	}
-
-	return nil
-}
-
-// Delete removes a sprint from the database
-func (s *Sprint) Delete() error {
-	db, err := sqlx.Open("postgres", connStr)
-	if err != nil {
-		return err
-	}
-	defer db.Close()
-
-	_, err = db.Queryx("delete from autochrone.sprints where id = $1", s.ID)
-	if err != nil {
-		return err
-	}
-
-	return nil
-}
-
 // GetNextSprintIfExists returns a the sprint on the same project that starts at sprint.TimeEnd + sprint.Break.
 // returns a pointer to sprint and a boolean set to true if it was found.
-func (s *Sprint) GetNextSprintIfExists() (nextSprint *Sprint, ok bool) {
-	db, err := sqlx.Open("postgres", connStr)
+func (s *Sprint) GetNextSprintIfExists(ctx context.Context, store Store) (nextSprint *Sprint, ok bool) {
+	nextSprint, err := store.GetNextSprint(ctx, s)
 	if err != nil {
 		return nil, false
 	}
-	defer db.Close()
-
-	nextSprint = &Sprint{}
-	if err := db.Get(nextSprint, "select * from autochrone.sprints where project_id = $1 and time_start > $2 order by time_start asc limit 1", s.ProjectID, s.TimeEnd().UTC().Format("2006-01-02 15:04:05")); err != nil {
-		return nil, false
-	}
 
 	return nextSprint, true
 }
@@ -255,6 +154,11 @@ func (s *Sprint) TimeEnd() time.Time {
 	return s.TimeStart.Add(time.Duration(s.Duration) * time.Minute)
 }
 
+// TimeBreakEnd returns the time at which the break following the sprint ends
+func (s *Sprint) TimeBreakEnd() time.Time {
+	return s.TimeEnd().Add(time.Duration(s.Break) * time.Minute)
+}
+
 // Upcoming returns true if the sprint has not yet started
 func (s *Sprint) Upcoming() bool {
 	return s.TimeStart.After(time.Now())
@@ -270,175 +174,310 @@ func (s *Sprint) Over() bool {
 	return s.TimeEnd().Before(time.Now())
 }
 
+// Sprint phases, in order
+const (
+	sprintUpcoming = "upcoming"
+	sprintRunning  = "running"
+	sprintBreak    = "break"
+	sprintOver     = "over"
+)
+
+// Phase returns the phase of the sprint at the given time, and when the next phase starts (zero time when over)
+func (s *Sprint) Phase(now time.Time) (phase string, next time.Time) {
+	switch {
+	case now.Before(s.TimeStart):
+		return sprintUpcoming, s.TimeStart
+	case now.Before(s.TimeEnd()):
+		return sprintRunning, s.TimeEnd()
+	case now.Before(s.TimeBreakEnd()):
+		return sprintBreak, s.TimeBreakEnd()
+	default:
+		return sprintOver, time.Time{}
+	}
+}
+
 // MilestoneIndex returns the number of milestones prior to this sprint plus 1.
 // The sprint needs not be a milestone itself.
-func (s *Sprint) MilestoneIndex() (int, error) {
-	db, err := sqlx.Open("postgres", connStr)
+func (s *Sprint) MilestoneIndex(ctx context.Context, store Store) (int, error) {
+	return store.CountMilestones(ctx, s)
+}
+
+// PreviousMilestone returns the last milestone before this sprint or nil and an error
+func (s *Sprint) PreviousMilestone(ctx context.Context, store Store) (*Sprint, error) {
+	return store.GetPreviousMilestone(ctx, s)
+}
+
+// MilestoneWordCount returns the number of words written since the last milestone was set
+// excluding the sprint on which the last milestone was set and including the current sprint.
+// The current sprint needs not be a milestone itself.
+func (s *Sprint) MilestoneWordCount(ctx context.Context, store Store) (int, error) {
+	previousMilestone, err := s.PreviousMilestone(ctx, store)
 	if err != nil {
 		return 0, err
 	}
-	defer db.Close()
 
-	row := db.QueryRowx("select count(id) from autochrone.sprints where project_id = $1 and time_start <= $2 and is_milestone = true", s.ProjectID, s.TimeStart.UTC().Format("2006-01-02 15:04:05"))
-	var i int
-	if err := row.Err(); err != nil {
+	wc, _, err := store.SumSprints(ctx, s, previousMilestone)
+	if err != nil {
 		return 0, err
 	}
-	if err := row.Scan(&i); err != nil {
-		return 0, err
+
+	if wc == -1 {
+		return s.WordCount, nil
 	}
-	return i, nil
+
+	return wc, nil
 }
 
-// PreviousMilestone returns the last milestone before this sprint or nil and an error
-func (s *Sprint) PreviousMilestone() (*Sprint, error) {
-	db, err := sqlx.Open("postgres", connStr)
+// MilestoneTimeSpent returns the duration spent since the last milestone was set
+// excluding the sprint on which the last milestone was set and including the current sprint.
+// The current sprint needs not be a milestone itself.
+func (s *Sprint) MilestoneTimeSpent(ctx context.Context, store Store) (time.Duration, error) {
+	previousMilestone, err := s.PreviousMilestone(ctx, store)
 	if err != nil {
-		return nil, err
+		return 0, err
 	}
-	defer db.Close()
 
-	row := db.QueryRowx(`select id, time_start from autochrone.sprints where project_id = $1 and time_start < $2 and is_milestone = true
-		union all (select -1, time_start from autochrone.sprints where project_id = $1 order by time_start limit 1)
-		order by time_start desc limit 1`, s.ProjectID, s.TimeStart.UTC().Format("2006-01-02 15:04:05"))
-	var id int
-	if err := row.Err(); err != nil {
-		return nil, err
+	_, d, err := store.SumSprints(ctx, s, previousMilestone)
+	if err != nil {
+		return 0, err
 	}
 
-	var ts string
-	if err := row.Scan(&id, &ts); err != nil {
-		return nil, err
+	if d == -1 {
+		return time.Duration(s.Duration) * time.Minute, nil
 	}
 
-	if id == -1 {
-		return nil, nil
+	return time.Duration(d) * time.Minute, nil
+}
+
+// NewGuestSprint creates a guest sprint on the given project with the model host sprint, and links it to the host.
+// Returns ErrSprintJoinedByHost if the project’s user is the host, ErrSprintAlreadyJoined if they already joined the host sprint,
+// or the error of Invite.CheckJoinable if the invite does not let new guests in.
+func (p *Project) NewGuestSprint(ctx context.Context, store Store, hostSprint *Sprint) (*Sprint, error) {
+	if hostSprint.Over() {
+		return nil, errors.New("NewGuestSprint: host sprint is over.")
 	}
 
-	return GetSprintByID(id)
-}
+	var guestSprint *Sprint
+	err := store.Transaction(ctx, func(tx Store) error {
+		invite, err := tx.GetInvite(ctx, hostSprint.ID)
+		if err != nil {
+			return ErrSprintNotOpen
+		}
+		if err := invite.CheckJoinable(ctx, tx, time.Now()); err != nil {
+			return err
+		}
 
-// MilestoneWordCount returns the number of words written since the last milestone was set
-// excluding the sprint on which the last milestone was set and including the current sprint.
-// The current sprint needs not be a milestone itself.
-func (s *Sprint) MilestoneWordCount() (int, error) {
-	db, err := sqlx.Open("postgres", connStr)
+		if hostProject, err := tx.GetProjectByID(ctx, hostSprint.ProjectID); err != nil {
+			return err
+		} else if hostProject.UserID == p.UserID {
+			return ErrSprintJoinedByHost
+		}
+
+		if joined, err := tx.UserJoinedSprint(ctx, p.UserID, hostSprint); err != nil {
+			return err
+		} else if joined {
+			return ErrSprintAlreadyJoined
+		}
+
+		guestSprint, err = p.NewSprint(ctx, tx, hostSprint.TimeStart, hostSprint.Duration, hostSprint.Break)
+		if err != nil {
+			return err
+		}
+
+		return tx.InsertGuestSprint(ctx, guestSprint, hostSprint)
+	})
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
-	defer db.Close()
 
-	previousMilestone, err := s.PreviousMilestone()
-	if err != nil {
-		return 0, err
+	return guestSprint, nil
+}
+
+// GetProjectSprints returns the sprints on a given project, latest first
+func (store *PostgresStore) GetProjectSprints(ctx context.Context, p *Project) ([]*Sprint, error) {
+	sprints := []*Sprint{}
+	if err := store.db.SelectContext(ctx, &sprints, "select * from sprints_with_details where project_id = $1 order by time_start desc", p.ID); err != nil {
+		return nil, err
 	}
 
-	var row *sqlx.Row
-	if previousMilestone != nil {
-		row = db.QueryRowx("select sum(word_count) from autochrone.sprints where project_id = $1 and time_start <= $2 and time_start > $3", s.ProjectID, s.TimeStart.UTC().Format("2006-01-02 15:04:05"), previousMilestone.TimeStart.UTC().Format("2006-01-02 15:04:05"))
-	} else {
-		row = db.QueryRowx("select sum(word_count) from autochrone.sprints where project_id = $1 and time_start <= $2", s.ProjectID, s.TimeStart.UTC().Format("2006-01-02 15:04:05"))
+	return sprints, nil
+}
+
+// GetSprintByID returns the sprint with the given ID and a potential error
+func (store *PostgresStore) GetSprintByID(ctx context.Context, id int) (*Sprint, error) {
+	s := &Sprint{}
+	if err := store.db.GetContext(ctx, s, "select * from sprints_with_details where id = $1", id); err != nil {
+		return nil, err
 	}
-	var wc int
-	if err := row.Err(); err != nil {
-		return 0, err
+	return s, nil
+}
+
+// GetSprintBySlug returns the sprint with the given slug and a potential error
+func (store *PostgresStore) GetSprintBySlug(ctx context.Context, slug string) (*Sprint, error) {
+	s := &Sprint{}
+	if err := store.db.GetContext(ctx, s, "select * from sprints_with_details where slug = $1", slug); err != nil {
+		return nil, err
 	}
-	if err := row.Scan(&wc); err != nil {
-		return 0, err
+	return s, nil
+}
+
+// GetSprintByInviteSlug returns the sprint with the given invite slug in autochrone.host_sprints sql table
+func (store *PostgresStore) GetSprintByInviteSlug(ctx context.Context, inviteSlug string) (*Sprint, error) {
+	s := &Sprint{}
+	if err := store.db.GetContext(ctx, s, "select * from sprints_with_details where invite_slug = $1", inviteSlug); err != nil {
+		return nil, err
 	}
+	return s, nil
+}
 
-	if wc == -1 {
-		return s.WordCount, nil
+// InsertSprint inserts a new sprint in the database and sets its ID and creation time
+func (store *PostgresStore) InsertSprint(ctx context.Context, s *Sprint) error {
+	row := store.db.QueryRowxContext(ctx, `
+		insert into autochrone.sprints(
+			slug, project_id, time_start, duration, break, word_count, is_milestone, comment
+		) values ($1, $2, $3, $4, $5, $6, $7, $8)
+		returning id, created_at, updated_at
+	`, s.Slug, s.ProjectID, s.TimeStart.UTC().Format("2006-01-02 15:04:05"), s.Duration, s.Break, s.WordCount, s.IsMilestone, s.Comment)
+	return row.Scan(&(s.ID), &(s.CreatedAt), &(s.UpdatedAt))
+}
+
+// UpdateSprint saves an existing sprint in the database and sets its update time
+func (store *PostgresStore) UpdateSprint(ctx context.Context, s *Sprint) error {
+	row := store.db.QueryRowxContext(ctx, `update autochrone.sprints
+		set (time_start, duration, break, word_count, is_milestone, comment, updated_at)
+		= ($1, $2, $3, $4, $5, $6, now() at time zone 'utc')
+		where id = $7
+		returning updated_at`, s.TimeStart.UTC().Format("2006-01-02 15:04:05"), s.Duration, s.Break, s.WordCount, s.IsMilestone, s.Comment, s.ID)
+	if err := row.Scan(&(s.UpdatedAt)); err != nil && err != sql.ErrNoRows {
+		return err
 	}
+	return nil
+}
 
-	return wc, nil
+// DeleteSprint removes a sprint from the database
+func (store *PostgresStore) DeleteSprint(ctx context.Context, s *Sprint) error {
+	_, err := store.db.ExecContext(ctx, "delete from autochrone.sprints where id = $1", s.ID)
+	return err
 }
 
-// MilestoneTimeSpent returns the duration spent since the last milestone was set
-// excluding the sprint on which the last milestone was set and including the current sprint.
-// The current sprint needs not be a milestone itself.
-func (s *Sprint) MilestoneTimeSpent() (time.Duration, error) {
-	db, err := sqlx.Open("postgres", connStr)
-	if err != nil {
-		return 0, err
+// GetNextSprint returns the first sprint on the same project starting after the end of the given one
+func (store *PostgresStore) GetNextSprint(ctx context.Context, s *Sprint) (*Sprint, error) {
+	nextSprint := &Sprint{}
+	if err := store.db.GetContext(ctx, nextSprint, "select * from autochrone.sprints where project_id = $1 and time_start > $2 order by time_start asc limit 1", s.ProjectID, s.TimeEnd().UTC().Format("2006-01-02 15:04:05")); err != nil {
+		return nil, err
 	}
-	defer db.Close()
 
-	previousMilestone, err := s.PreviousMilestone()
-	if err != nil {
+	return nextSprint, nil
+}
+
+// CountMilestones returns the number of milestones on the sprint’s project up to and including the sprint
+func (store *PostgresStore) CountMilestones(ctx context.Context, s *Sprint) (int, error) {
+	var i int
+	if err := store.db.GetContext(ctx, &i, "select count(id) from autochrone.sprints where project_id = $1 and time_start <= $2 and is_milestone = true", s.ProjectID, s.TimeStart.UTC().Format("2006-01-02 15:04:05")); err != nil {
 		return 0, err
 	}
+	return i, nil
+}
 
-	var row *sqlx.Row
-	if previousMilestone != nil {
-		row = db.QueryRowx("select sum(duration) from autochrone.sprints where project_id = $1 and time_start <= $2 and time_start > $3", s.ProjectID, s.TimeStart.UTC().Format("2006-01-02 15:04:05"), previousMilestone.TimeStart.UTC().Format("2006-01-02 15:04:05"))
-	} else {
-		row = db.QueryRowx("select sum(duration) from autochrone.sprints where project_id = $1 and time_start <= $2", s.ProjectID, s.TimeStart.UTC().Format("2006-01-02 15:04:05"))
-	}
-	var d int
+// GetPreviousMilestone returns the last milestone before the sprint on its project,
+// or nil if there is none
+func (store *PostgresStore) GetPreviousMilestone(ctx context.Context, s *Sprint) (*Sprint, error) {
+	row := store.db.QueryRowxContext(ctx, `select id, time_start from autochrone.sprints where project_id = $1 and time_start < $2 and is_milestone = true
+		union all (select -1, time_start from autochrone.sprints where project_id = $1 order by time_start limit 1)
+		order by time_start desc limit 1`, s.ProjectID, s.TimeStart.UTC().Format("2006-01-02 15:04:05"))
+	var id int
 	if err := row.Err(); err != nil {
-		return 0, err
+		return nil, err
 	}
-	if err := row.Scan(&d); err != nil {
-		return 0, err
+
+	var ts string
+	if err := row.Scan(&id, &ts); err != nil {
+		return nil, err
 	}
 
-	if d == -1 {
-		return time.Duration(s.Duration) * time.Minute, nil
+	if id == -1 {
+		return nil, nil
 	}
 
-	return time.Duration(d) * time.Minute, nil
+	return store.GetSprintByID(ctx, id)
 }
 
-// OpenToGuests opens the sprint to guests, sets the public comment and returns the invite slug (and error).
-func (s *Sprint) OpenToGuests(comment string) (string, error) {
-	db, err := sqlx.Open("postgres", connStr)
-	if err != nil {
-		return "", err
+// SumSprints returns the word count and the duration in minutes of the sprints on the project of s
+// up to and including s, and after since if not nil, or -1 for both if there are no such sprints
+func (store *PostgresStore) SumSprints(ctx context.Context, s *Sprint, since *Sprint) (wordCount, duration int, err error) {
+	var row *sqlx.Row
+	if since != nil {
+		row = store.db.QueryRowxContext(ctx, "select coalesce(sum(word_count), -1), coalesce(sum(duration), -1) from autochrone.sprints where project_id = $1 and time_start <= $2 and time_start > $3", s.ProjectID, s.TimeStart.UTC().Format("2006-01-02 15:04:05"), since.TimeStart.UTC().Format("2006-01-02 15:04:05"))
+	} else {
+		row = store.db.QueryRowxContext(ctx, "select coalesce(sum(word_count), -1), coalesce(sum(duration), -1) from autochrone.sprints where project_id = $1 and time_start <= $2", s.ProjectID, s.TimeStart.UTC().Format("2006-01-02 15:04:05"))
 	}
-	defer db.Close()
-
-	inviteSlug := fmt.Sprintf("%s.%x", s.Slug, time.Now().UnixNano())
-	_, err = db.Queryx("insert into autochrone.host_sprints (host_sprint_id, invite_slug, comment) values ($1, $2, $3)", s.ID, inviteSlug, comment)
-	if err != nil {
-		return "", err
+	if err := row.Err(); err != nil {
+		return 0, 0, err
+	}
+	if err := row.Scan(&wordCount, &duration); err != nil {
+		return 0, 0, err
 	}
 
-	return inviteSlug, nil
+	return wordCount, duration, nil
 }
 
-// GetGuestSprints get the guest sprints from the database (and error).
-func (s *Sprint) GetGuestSprints() ([]*Sprint, error) {
-	db, err := sqlx.Open("postgres", connStr)
+// GetUserSprintsChangedSince returns the user’s sprints created, saved or whose break ends at or after the given time,
+// earliest first
+func (store *PostgresStore) GetUserSprintsChangedSince(ctx context.Context, u *User, since time.Time) ([]*Sprint, error) {
+	sprints := []*Sprint{}
+	err := store.db.SelectContext(ctx, &sprints, `select * from sprints_with_details
+		where project_id in (select id from autochrone.projects where user_id = $1)
+			and (updated_at >= $2 or time_start + make_interval(mins => duration + break) >= $2)
+		order by time_start`, u.ID, since.UTC())
 	if err != nil {
 		return nil, err
 	}
-	defer db.Close()
 
-	rows, err := db.Queryx(`select *
+	return sprints, nil
+}
+
+// InsertGuestSprint links a guest sprint to the host sprint it joined, on behalf of the guest project’s user
+func (store *PostgresStore) InsertGuestSprint(ctx context.Context, guest, host *Sprint) error {
+	_, err := store.db.ExecContext(ctx, `insert into autochrone.guest_sprints (guest_sprint_id, host_sprint_id, user_id)
+		select $1, $2, user_id from autochrone.projects where id = $3`, guest.ID, host.ID, guest.ProjectID)
+	if isUniqueViolation(err, "guest_sprints_host_sprint_id_user_id_key") {
+		return ErrSprintAlreadyJoined
+	}
+	return err
+}
+
+// UserJoinedSprint returns true if one of the user’s sprints already joined the host sprint
+func (store *PostgresStore) UserJoinedSprint(ctx context.Context, userID int, host *Sprint) (bool, error) {
+	var joined bool
+	err := store.db.GetContext(ctx, &joined, "select exists (select 1 from autochrone.guest_sprints where host_sprint_id = $1 and user_id = $2)", host.ID, userID)
+	return joined, err
+}
+
+// GetGuestSprints get the guest sprints of a host sprint from the database, by username (and error).
+func (store *PostgresStore) GetGuestSprints(ctx context.Context, s *Sprint) ([]*Sprint, error) {
+	guestSprints := []*Sprint{}
+	err := store.db.SelectContext(ctx, &guestSprints, `select sprints_with_details.*
 		from sprints_with_details
-		inner join guest_sprints on sprints_with_details.id = guest_sprints.host_sprint_id
-		where guest_sprints.host_sprint_id = $1`, s.ID)
+		inner join guest_sprints on sprints_with_details.id = guest_sprints.guest_sprint_id
+		where guest_sprints.host_sprint_id = $1
+		order by sprints_with_details.username`, s.ID)
 	if err != nil {
 		return nil, err
 	}
-	guestSprints := []*Sprint{}
-	for rows.Next() {
-		s := &Sprint{}
-		if err := rows.StructScan(s); err != nil {
-			return nil, err
-		}
-		guestSprints = append(guestSprints, s)
-	}
 
 	return guestSprints, nil
 }
 
-// NewGuestSprint creates a guest sprint on the given project with the model host sprint
-func (p *Project) NewGuestSprint(hostSprint *Sprint) (*Sprint, error) {
-	if hostSprint.Over() {
-		return nil, errors.New("NewGuestSprint: host sprint is over.")
+// GetHostSprint returns the host sprint a guest sprint joined
+func (store *PostgresStore) GetHostSprint(ctx context.Context, guest *Sprint) (*Sprint, error) {
+	s := &Sprint{}
+	err := store.db.GetContext(ctx, s, `select sprints_with_details.*
+		from sprints_with_details
+		inner join guest_sprints on sprints_with_details.id = guest_sprints.host_sprint_id
+		where guest_sprints.guest_sprint_id = $1`, guest.ID)
+	if err != nil {
+		return nil, err
 	}
 
-	return p.NewSprint(hostSprint.TimeStart, hostSprint.Duration, hostSprint.Break)
+	return s, nil
 }
@@ -10,9 +10,11 @@ import (
 
 // SprintsGET responds with a project’s sprints
 func SprintsGET(c *gin.Context) {
+	store := c.MustGet("store").(Store)
+	ctx := c.Request.Context()
 	project := c.MustGet("project").(*Project)
 
-	if err := project.FetchSprints(); err != nil {
+	if err := project.FetchSprints(ctx, store); err != nil {
 		c.AbortWithStatus(http.StatusInternalServerError)
 		return
 	}
@@ -30,6 +32,8 @@ type SprintPOSTRequest struct {
 // SprintsPOST saves a given sprint and returns its API location
 // requires json(timeStart, duration, break)
 func SprintsPOST(c *gin.Context) {
+	store := c.MustGet("store").(Store)
+	ctx := c.Request.Context()
 	user := c.MustGet("user").(*User)
 	project := c.MustGet("project").(*Project)
 
@@ -39,13 +43,13 @@ func SprintsPOST(c *gin.Context) {
 		return
 	}
 
-	timeStart, err := time.Parse("2006-01-02T15:04:05-0700", req.TimeStart)
+	timeStart, err := ParseTime(req.TimeStart)
 	if err != nil || req.Duration < 1 || req.Duration < 0 {
 		c.AbortWithStatus(http.StatusBadRequest)
 		return
 	}
 
-	sprint, err := project.NewSprint(timeStart, req.Duration, req.Break)
+	sprint, err := project.NewSprint(ctx, store, timeStart, req.Duration, req.Break)
 	if err != nil {
 		c.AbortWithStatus(http.StatusInternalServerError)
 		return
@@ -72,7 +76,10 @@ type SprintsSlugPUTRequest struct {
 // SprintsSlugPUT updates a sprint. Does not modify Slug, TimeStart or ProjectID.
 // requires json(wordCount, isMilestone, comment)
 func SprintsSlugPUT(c *gin.Context) {
+	store := c.MustGet("store").(Store)
+	ctx := c.Request.Context()
 	sprint := c.MustGet("sprint").(*Sprint)
+	rooms := c.MustGet("rooms").(*RoomHub)
 
 	req := &SprintsSlugPUTRequest{}
 	if err := c.BindJSON(req); err != nil {
@@ -84,11 +91,19 @@ func SprintsSlugPUT(c *gin.Context) {
 	sprint.IsMilestone = req.IsMilestone
 	sprint.Comment = req.Comment
 
-	if err := sprint.Update(); err != nil {
+	if err := store.UpdateSprint(ctx, sprint); err != nil {
 		c.AbortWithStatus(http.StatusInternalServerError)
 		return
 	}
 
+	// share the word count with the sprint room, that of the host sprint for a guest sprint
+	hostSprintID := sprint.ID
+	if hostSprint, err := store.GetHostSprint(ctx, sprint); err == nil {
+		hostSprintID = hostSprint.ID
+	}
+	wordCount := sprint.WordCount
+	rooms.Publish(hostSprintID, RoomEvent{Type: roomEventWordCount, Username: sprint.Username, SprintSlug: sprint.Slug, WordCount: &wordCount})
+
 	c.Status(http.StatusOK)
 }
 
@@ -100,6 +115,8 @@ type SprintsSlugNextSprintPOSTRequest struct {
 // SprintsSlugNextSprintPOST instantiates or gets the sprint following the current one.
 // requires post(timeStart)
 func SprintsSlugNextSprintPOST(c *gin.Context) {
+	store := c.MustGet("store").(Store)
+	ctx := c.Request.Context()
 	project := c.MustGet("project").(*Project)
 	sprint := c.MustGet("sprint").(*Sprint)
 
@@ -110,7 +127,7 @@ func SprintsSlugNextSprintPOST(c *gin.Context) {
 	}
 
 	// try to get an existing next sprint
-	if nextSprint, ok := sprint.GetNextSprintIfExists(); ok {
+	if nextSprint, ok := sprint.GetNextSprintIfExists(ctx, store); ok {
 		c.JSON(http.StatusOK, nextSprint)
 		return
 	}
@@ -121,14 +138,14 @@ func SprintsSlugNextSprintPOST(c *gin.Context) {
 		c.AbortWithStatus(http.StatusBadRequest)
 		return
 	}
-	timeStart, err := time.Parse("2006-01-02T15:04:05-0700", req.TimeStart)
+	timeStart, err := ParseTime(req.TimeStart)
 	if err != nil || timeStart.Before(sprint.TimeEnd()) {
 		c.AbortWithStatus(http.StatusBadRequest)
 		return
 	}
 
 	// otherwise, create new sprint and return
-	nextSprint, err := project.NewSprint(timeStart, sprint.Duration, sprint.Break)
+	nextSprint, err := project.NewSprint(ctx, store, timeStart, sprint.Duration, sprint.Break)
 	if err != nil {
 		c.AbortWithStatus(http.StatusInternalServerError)
 		return
@@ -138,23 +155,31 @@ func SprintsSlugNextSprintPOST(c *gin.Context) {
 
 // SprintsSlugDELETE deletes a sprint
 func SprintsSlugDELETE(c *gin.Context) {
+	store := c.MustGet("store").(Store)
+	ctx := c.Request.Context()
 	sprint := c.MustGet("sprint").(*Sprint)
+	rooms := c.MustGet("rooms").(*RoomHub)
 
-	if err := sprint.Delete(); err != nil {
+	if err := store.DeleteSprint(ctx, sprint); err != nil {
 		c.AbortWithStatus(http.StatusInternalServerError)
 		return
 	}
+	rooms.Close(sprint.ID)
 
 	c.Status(http.StatusOK)
 }
 
-// SprintsSlugOpenPOSTRequest: a comment is needed in open sprints
+// SprintsSlugOpenPOSTRequest: a comment is needed in open sprints, the invite may expire and cap its guests
 type SprintsSlugOpenPOSTRequest struct {
-	Comment string `json:"comment"`
+	Comment   string     `json:"comment"`
+	ExpiresAt *time.Time `json:"expiresAt"`
+	MaxGuests int        `json:"maxGuests"`
 }
 
 // SprintsSlugOpenPOST opens a sprint to guests
 func SprintsSlugOpenPOST(c *gin.Context) {
+	store := c.MustGet("store").(Store)
+	ctx := c.Request.Context()
 	sprint := c.MustGet("sprint").(*Sprint)
 
 	req := &SprintsSlugOpenPOSTRequest{}
@@ -163,25 +188,62 @@ func SprintsSlugOpenPOST(c *gin.Context) {
 		return
 	}
 
-	inviteSlug, err := sprint.OpenToGuests(req.Comment)
-	if err != nil {
+	invite, err := sprint.OpenToGuests(ctx, store, req.Comment, req.ExpiresAt, req.MaxGuests)
+	if err == ErrSprintAlreadyOpen {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, invite)
+}
+
+// SprintsSlugOpenDELETE closes the invite of a sprint, its guests remain
+func SprintsSlugOpenDELETE(c *gin.Context) {
+	store := c.MustGet("store").(Store)
+	ctx := c.Request.Context()
+	sprint := c.MustGet("sprint").(*Sprint)
+	rooms := c.MustGet("rooms").(*RoomHub)
+
+	if err := sprint.CloseInvite(ctx, store); err == ErrSprintNotOpen {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	} else if err != nil {
 		c.AbortWithStatus(http.StatusInternalServerError)
 		return
 	}
+	rooms.Close(sprint.ID)
 
-	c.JSON(http.StatusOK, gin.H{"inviteSlug": inviteSlug})
+	c.Status(http.StatusNoContent)
 }
 
-// SprintsSlugGuestsGET fetches the guest sprints
-func SprintsSlugGuestsGET(c *gin.Context) {
+// SprintsSlugOpenRegeneratePOST replaces the invite slug of a sprint open to guests
+func SprintsSlugOpenRegeneratePOST(c *gin.Context) {
+	store := c.MustGet("store").(Store)
+	ctx := c.Request.Context()
 	sprint := c.MustGet("sprint").(*Sprint)
 
-	if !sprint.IsOpenToGuests() {
-		c.AbortWithStatus(http.StatusBadRequest)
+	invite, err := sprint.RegenerateInvite(ctx, store)
+	if err == ErrSprintNotOpen {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	} else if err != nil {
+		c.AbortWithStatus(http.StatusInternalServerError)
 		return
 	}
 
-	guestSprints, err := sprint.GetGuestSprints()
+	c.JSON(http.StatusOK, invite)
+}
+
+// SprintsSlugGuestsGET fetches the guest sprints
+func SprintsSlugGuestsGET(c *gin.Context) {
+	store := c.MustGet("store").(Store)
+	ctx := c.Request.Context()
+	sprint := c.MustGet("sprint").(*Sprint)
+
+	guestSprints, err := store.GetGuestSprints(ctx, sprint)
 	if err != nil {
 		c.AbortWithStatus(http.StatusInternalServerError)
 		return
@@ -189,3 +251,18 @@ func SprintsSlugGuestsGET(c *gin.Context) {
 
 	c.JSON(http.StatusOK, guestSprints)
 }
+
+// SprintsSlugHostGET fetches the host sprint of a guest sprint
+func SprintsSlugHostGET(c *gin.Context) {
+	store := c.MustGet("store").(Store)
+	ctx := c.Request.Context()
+	sprint := c.MustGet("sprint").(*Sprint)
+
+	hostSprint, err := store.GetHostSprint(ctx, sprint)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "not a guest sprint"})
+		return
+	}
+
+	c.JSON(http.StatusOK, hostSprint)
+}
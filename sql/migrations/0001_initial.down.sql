@@ -0,0 +1,6 @@
+drop view if exists sprints_with_details;
+drop table if exists guest_sprints;
+drop table if exists host_sprints;
+drop table if exists sprints;
+drop table if exists projects;
+drop table if exists users;
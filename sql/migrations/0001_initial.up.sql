@@ -1,5 +1,5 @@
-create schema if not exists autochrone;
-set schema 'autochrone';
+-- schema of the first deployments, which created it with sql/schema.sql
+-- every statement is idempotent so that these databases can be migrated
 
 -- users
 create table if not exists
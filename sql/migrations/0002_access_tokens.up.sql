@@ -0,0 +1,12 @@
+-- access_tokens
+create table if not exists
+access_tokens (
+	id varchar(64) primary key, -- jti
+	user_id int not null references users(id) on delete cascade,
+	scope varchar not null,
+	issued_at timestamp not null,
+	expires_at timestamp not null,
+	user_agent varchar(512) not null default '',
+	ip varchar(64) not null default ''
+);
+create index if not exists access_tokens_user_id on access_tokens(user_id);
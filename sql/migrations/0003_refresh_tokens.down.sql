@@ -0,0 +1,3 @@
+drop table if exists refresh_tokens;
+drop index if exists access_tokens_family_id;
+alter table access_tokens drop column if exists family_id;
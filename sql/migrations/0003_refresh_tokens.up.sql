@@ -0,0 +1,15 @@
+alter table access_tokens add column if not exists family_id varchar(64) not null default '';
+create index if not exists access_tokens_family_id on access_tokens(family_id);
+
+-- refresh_tokens
+create table if not exists
+refresh_tokens (
+	id varchar(64) primary key, -- sha256 of the token
+	family_id varchar(64) not null,
+	user_id int not null references users(id) on delete cascade,
+	scope varchar not null,
+	issued_at timestamp not null,
+	expires_at timestamp not null,
+	used boolean not null default false
+);
+create index if not exists refresh_tokens_family_id on refresh_tokens(family_id);
@@ -0,0 +1 @@
+alter table users alter column password_salt drop default;
@@ -0,0 +1,2 @@
+-- salts are only stored separately for legacy sha256 hashes
+alter table users alter column password_salt set default '';
@@ -0,0 +1,33 @@
+-- roles
+create table if not exists
+roles (
+	id serial primary key,
+	name varchar(32) unique not null
+);
+
+-- role_scopes
+create table if not exists
+role_scopes (
+	role_id int not null references roles(id) on delete cascade,
+	scope varchar(64) not null,
+	primary key (role_id, scope)
+);
+
+-- user_roles
+create table if not exists
+user_roles (
+	user_id int not null references users(id) on delete cascade,
+	role_id int not null references roles(id) on delete cascade,
+	primary key (user_id, role_id)
+);
+
+insert into roles (name) values ('writer'), ('admin') on conflict do nothing;
+insert into role_scopes (role_id, scope)
+	select id, unnest(array['basic', 'read']) from roles where name = 'writer'
+	on conflict do nothing;
+insert into role_scopes (role_id, scope)
+	select id, unnest(array['basic', 'read', 'admin']) from roles where name = 'admin'
+	on conflict do nothing;
+insert into user_roles (user_id, role_id)
+	select users.id, roles.id from users, roles where roles.name = 'writer'
+	on conflict do nothing;
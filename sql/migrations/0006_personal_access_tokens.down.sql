@@ -0,0 +1,2 @@
+drop table if exists personal_access_tokens;
+delete from role_scopes where scope = 'sprints:write';
@@ -0,0 +1,17 @@
+insert into role_scopes (role_id, scope)
+	select id, 'sprints:write' from roles where name in ('writer', 'admin')
+	on conflict do nothing;
+
+-- personal_access_tokens
+create table if not exists
+personal_access_tokens (
+	id serial primary key,
+	user_id int not null references users(id) on delete cascade,
+	name varchar(64) not null,
+	token_hash varchar(64) unique not null, -- sha256 of the token
+	scope varchar not null,
+	created_at timestamp not null,
+	expires_at timestamp, -- null if the token never expires
+	last_used_at timestamp,
+	unique (user_id, name)
+);
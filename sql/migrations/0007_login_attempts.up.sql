@@ -0,0 +1,8 @@
+-- login_attempts
+create table if not exists
+login_attempts (
+	key varchar(160) primary key, -- 'ip:<address>' or 'username:<username>'
+	failures int not null,
+	last_failure_at timestamp not null,
+	locked_until timestamp
+);
@@ -0,0 +1,4 @@
+drop table if exists recovery_codes;
+alter table users drop column if exists totp_last_step;
+alter table users drop column if exists totp_enabled;
+alter table users drop column if exists totp_secret;
@@ -0,0 +1,13 @@
+alter table users add column if not exists totp_secret varchar(64) not null default '';
+alter table users add column if not exists totp_enabled boolean not null default false;
+alter table users add column if not exists totp_last_step bigint not null default 0;
+
+-- recovery_codes
+create table if not exists
+recovery_codes (
+	id serial primary key,
+	user_id int not null references users(id) on delete cascade,
+	code_hash varchar(64) not null, -- sha256 of the normalized code
+	used_at timestamp,
+	unique (user_id, code_hash)
+);
@@ -0,0 +1,4 @@
+drop table if exists email_tokens;
+drop index if exists users_email;
+alter table users drop column if exists email_verified;
+alter table users drop column if exists email;
@@ -0,0 +1,13 @@
+alter table users add column if not exists email varchar(254) not null default '';
+alter table users add column if not exists email_verified boolean not null default false;
+create unique index if not exists users_email on users(lower(email)) where email <> '';
+
+-- email_tokens
+create table if not exists
+email_tokens (
+	id varchar(64) primary key, -- sha256 of the token
+	user_id int not null references users(id) on delete cascade,
+	purpose varchar(16) not null, -- 'verify' or 'reset'
+	email varchar(254) not null, -- address the token was sent to
+	expires_at timestamp not null
+);
@@ -0,0 +1,6 @@
+alter table guest_sprints drop constraint guest_sprints_guest_sprint_id_fkey;
+alter table guest_sprints add constraint guest_sprints_guest_sprint_id_fkey
+	foreign key (guest_sprint_id) references sprints(id);
+
+alter table guest_sprints drop constraint guest_sprints_host_sprint_id_user_id_key;
+alter table guest_sprints drop column user_id;
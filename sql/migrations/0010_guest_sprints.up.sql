@@ -0,0 +1,12 @@
+-- guests are linked to their user, who may only join a host sprint once
+alter table guest_sprints add column user_id int references users(id) on delete cascade;
+update guest_sprints set user_id = projects.user_id
+	from sprints inner join projects on sprints.project_id = projects.id
+	where sprints.id = guest_sprints.guest_sprint_id;
+alter table guest_sprints alter column user_id set not null;
+alter table guest_sprints add constraint guest_sprints_host_sprint_id_user_id_key unique (host_sprint_id, user_id);
+
+-- deleting a guest sprint leaves the host sprint
+alter table guest_sprints drop constraint guest_sprints_guest_sprint_id_fkey;
+alter table guest_sprints add constraint guest_sprints_guest_sprint_id_fkey
+	foreign key (guest_sprint_id) references sprints(id) on delete cascade;
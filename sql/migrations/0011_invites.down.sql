@@ -0,0 +1,16 @@
+drop view sprints_with_details;
+create view sprints_with_details as select
+	sprints.*,
+	coalesce(host_sprints.invite_slug, '') invite_slug,
+	coalesce(host_sprints.comment, '') invite_comment,
+	projects.slug project_slug,
+	users.username
+	from autochrone.sprints
+		inner join autochrone.projects on sprints.project_id = projects.id
+		inner join autochrone.users on projects.user_id = users.id
+		left outer join host_sprints on sprints.id = host_sprints.host_sprint_id;
+
+alter table host_sprints drop column closed_at;
+alter table host_sprints drop column max_guests;
+alter table host_sprints drop column expires_at;
+alter table host_sprints drop column created_at;
@@ -0,0 +1,18 @@
+alter table host_sprints add column created_at timestamp not null default (now() at time zone 'utc');
+alter table host_sprints add column expires_at timestamp; -- null if the invite never expires
+alter table host_sprints add column max_guests int not null default 0; -- 0 for no limit
+alter table host_sprints add column closed_at timestamp; -- null while the invite is open
+
+-- closed invites keep their guests, but their slug and comment are no longer shown
+drop view sprints_with_details;
+create view sprints_with_details as select
+	sprints.*,
+	coalesce(open_invites.invite_slug, '') invite_slug,
+	coalesce(open_invites.comment, '') invite_comment,
+	projects.slug project_slug,
+	users.username
+	from autochrone.sprints
+		inner join autochrone.projects on sprints.project_id = projects.id
+		inner join autochrone.users on projects.user_id = users.id
+		left outer join (select * from host_sprints where closed_at is null) open_invites
+			on sprints.id = open_invites.host_sprint_id;
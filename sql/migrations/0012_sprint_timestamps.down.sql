@@ -0,0 +1,16 @@
+drop view sprints_with_details;
+
+alter table sprints drop column updated_at;
+alter table sprints drop column created_at;
+
+create view sprints_with_details as select
+	sprints.*,
+	coalesce(open_invites.invite_slug, '') invite_slug,
+	coalesce(open_invites.comment, '') invite_comment,
+	projects.slug project_slug,
+	users.username
+	from autochrone.sprints
+		inner join autochrone.projects on sprints.project_id = projects.id
+		inner join autochrone.users on projects.user_id = users.id
+		left outer join (select * from host_sprints where closed_at is null) open_invites
+			on sprints.id = open_invites.host_sprint_id;
@@ -0,0 +1,26 @@
+-- sprints remember when they were created and last saved, so that their events can be replayed
+alter table sprints add column created_at timestamp;
+alter table sprints add column updated_at timestamp;
+
+-- existing sprints are deemed created when they started, or now for upcoming ones
+update sprints set
+	created_at = least(time_start, now() at time zone 'utc'),
+	updated_at = least(time_start, now() at time zone 'utc');
+alter table sprints alter column created_at set not null;
+alter table sprints alter column created_at set default (now() at time zone 'utc');
+alter table sprints alter column updated_at set not null;
+alter table sprints alter column updated_at set default (now() at time zone 'utc');
+
+-- sprints.* is expanded when the view is created
+drop view sprints_with_details;
+create view sprints_with_details as select
+	sprints.*,
+	coalesce(open_invites.invite_slug, '') invite_slug,
+	coalesce(open_invites.comment, '') invite_comment,
+	projects.slug project_slug,
+	users.username
+	from autochrone.sprints
+		inner join autochrone.projects on sprints.project_id = projects.id
+		inner join autochrone.users on projects.user_id = users.id
+		left outer join (select * from host_sprints where closed_at is null) open_invites
+			on sprints.id = open_invites.host_sprint_id;
@@ -0,0 +1 @@
+drop index if exists sprints_project_id_time_start;
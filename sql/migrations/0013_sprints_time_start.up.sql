@@ -0,0 +1,2 @@
+-- sprints are looked up by project and time, for calendars and sums
+create index if not exists sprints_project_id_time_start on sprints(project_id, time_start);
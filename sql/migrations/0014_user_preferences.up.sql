@@ -0,0 +1,3 @@
+-- users choose the time zone (IANA name) their days are counted in, and their locale (BCP 47 tag)
+alter table users add column if not exists timezone varchar(64) not null default 'UTC';
+alter table users add column if not exists locale varchar(35) not null default 'en';
@@ -0,0 +1 @@
+drop table if exists rest_days;
@@ -0,0 +1,7 @@
+-- rest_days: dates, in the user’s time zone, on which missing the daily target does not break a streak
+create table if not exists
+rest_days (
+	user_id int not null references users(id) on delete cascade,
+	date date not null,
+	primary key (user_id, date)
+);
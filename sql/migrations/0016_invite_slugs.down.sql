@@ -0,0 +1 @@
+-- the guessable invite slugs are not restored
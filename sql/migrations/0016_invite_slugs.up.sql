@@ -0,0 +1,5 @@
+-- invite slugs from before 0011 were derived from the sprint slug and guessable: they are replaced by random ones,
+-- 32 hex digits like those of GenerateInviteSlug.
+-- gen_random_uuid is built in from PostgreSQL 13, older servers need the pgcrypto extension
+update host_sprints set invite_slug = replace(gen_random_uuid()::text, '-', '')
+	where invite_slug !~ '^[0-9a-f]{32}$';
@@ -0,0 +1,3 @@
+-- fails if several users have the same address
+drop index if exists users_email;
+create unique index if not exists users_email on users(lower(email)) where email <> '';
@@ -0,0 +1,3 @@
+-- only verified email addresses are unique: an unverified one cannot keep its owner from using it
+drop index if exists users_email;
+create unique index if not exists users_email on users(lower(email)) where email <> '' and email_verified;
@@ -0,0 +1,7 @@
+-- deleting a host sprint deletes its invite and the links of its guests, whose sprints remain
+alter table host_sprints drop constraint host_sprints_host_sprint_id_fkey;
+alter table host_sprints add constraint host_sprints_host_sprint_id_fkey
+	foreign key (host_sprint_id) references sprints(id) on delete cascade;
+alter table guest_sprints drop constraint guest_sprints_host_sprint_id_fkey;
+alter table guest_sprints add constraint guest_sprints_host_sprint_id_fkey
+	foreign key (host_sprint_id) references host_sprints(host_sprint_id) on delete cascade;
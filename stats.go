@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"math"
+	"sort"
+	"time"
+)
+
+// oneDay the duration of a day, the unit of pace
+const oneDay = 24 * time.Hour
+
+// ProjectStats tells a writer whether they are on track to reach their project’s goal
+type ProjectStats struct {
+	// WordsWritten the number of words written during the sprints on the project
+	WordsWritten int `json:"wordsWritten"`
+
+	// WordCount the current word count of the project, from its initial word count
+	WordCount int `json:"wordCount"`
+
+	// WordsRemaining the number of words left to reach the goal
+	WordsRemaining int `json:"wordsRemaining"`
+
+	// DaysElapsed the number of days since the start of the project, including today
+	DaysElapsed int `json:"daysElapsed"`
+
+	// DaysRemaining the number of days until the end of the project, including today
+	DaysRemaining int `json:"daysRemaining"`
+
+	// RequiredDailyAverage the number of words to write each remaining day to reach the goal, nil if no day remains
+	RequiredDailyAverage *float64 `json:"requiredDailyAverage"`
+
+	// ActualDailyAverage the number of words written per elapsed day
+	ActualDailyAverage float64 `json:"actualDailyAverage"`
+
+	// WordsPerMinute the number of words written per minute of sprint
+	WordsPerMinute float64 `json:"wordsPerMinute"`
+
+	// ProjectedCompletionDate the date at which the goal will be reached at the pace of the sprint history,
+	// nil if there is not enough history or the goal is reached
+	ProjectedCompletionDate *time.Time `json:"projectedCompletionDate"`
+
+	// OnTrack whether the goal is reached or projected to be by the end of the project
+	OnTrack bool `json:"onTrack"`
+}
+
+// GetStats computes the statistics of the project at the given time from its sprints, counting days in loc
+func (p *Project) GetStats(ctx context.Context, store Store, now time.Time, loc *time.Location) (*ProjectStats, error) {
+	sprints, err := store.GetProjectSprints(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+
+	return p.Stats(sprints, now, loc), nil
+}
+
+// Stats computes the statistics of the project at the given time from the given sprints, counting days in loc.
+// Sprints that have not started yet are left out.
+func (p *Project) Stats(sprints []*Sprint, now time.Time, loc *time.Location) *ProjectStats {
+	started := []*Sprint{}
+	for _, s := range sprints {
+		if !s.TimeStart.After(now) {
+			started = append(started, s)
+		}
+	}
+	sort.Slice(started, func(i, j int) bool { return started[i].TimeStart.Before(started[j].TimeStart) })
+
+	stats := &ProjectStats{}
+	minutes := 0
+	for _, s := range started {
+		stats.WordsWritten += s.WordCount
+		minutes += s.Duration
+	}
+	stats.WordCount = p.WordCountStart + stats.WordsWritten
+	if remaining := p.WordCountGoal - stats.WordCount; remaining > 0 {
+		stats.WordsRemaining = remaining
+	}
+	if minutes > 0 {
+		stats.WordsPerMinute = float64(stats.WordsWritten) / float64(minutes)
+	}
+
+	// days are counted from the project dates, both included
+	today := LocalDate(now, loc)
+	totalDays := int(p.DateEnd.Sub(p.DateStart)/oneDay) + 1
+	stats.DaysElapsed = clampInt(int(today.Sub(p.DateStart)/oneDay)+1, 0, totalDays)
+	stats.DaysRemaining = clampInt(int(p.DateEnd.Sub(today)/oneDay)+1, 0, totalDays)
+	if stats.DaysRemaining > 0 {
+		required := float64(stats.WordsRemaining) / float64(stats.DaysRemaining)
+		stats.RequiredDailyAverage = &required
+	}
+	if stats.DaysElapsed > 0 {
+		stats.ActualDailyAverage = float64(stats.WordsWritten) / float64(stats.DaysElapsed)
+	}
+
+	if stats.WordsRemaining == 0 {
+		stats.OnTrack = true
+		return stats
+	}
+
+	stats.ProjectedCompletionDate = p.projectCompletionDate(started, now, loc)
+	stats.OnTrack = stats.ProjectedCompletionDate != nil && !stats.ProjectedCompletionDate.After(p.DateEnd)
+	return stats
+}
+
+// projectCompletionDate fits a line through the words written since the start of the project at the end of each sprint,
+// and returns the date it reaches the goal, nil with fewer than two sprints at different times or if the words do not increase
+func (p *Project) projectCompletionDate(sprints []*Sprint, now time.Time, loc *time.Location) *time.Time {
+	var n, sumX, sumY, sumXX, sumXY float64
+	written := 0
+	for _, s := range sprints {
+		written += s.WordCount
+		end := s.TimeEnd()
+		if end.After(now) {
+			end = now
+		}
+
+		x := end.Sub(p.DateStart).Hours() / 24
+		y := float64(written)
+		n++
+		sumX += x
+		sumY += y
+		sumXX += x * x
+		sumXY += x * y
+	}
+
+	denominator := n*sumXX - sumX*sumX
+	if n < 2 || denominator == 0 {
+		return nil
+	}
+	slope := (n*sumXY - sumX*sumY) / denominator
+	if slope <= 0 {
+		return nil
+	}
+	intercept := (sumY - slope*sumX) / n
+
+	days := (float64(p.WordCountGoal-p.WordCountStart) - intercept) / slope
+	if math.IsNaN(days) || math.Abs(days) >= float64(math.MaxInt64/int64(oneDay)) {
+		return nil
+	}
+	date := p.DateStart.Add(time.Duration(days * float64(oneDay))).Truncate(oneDay)
+	if today := LocalDate(now, loc); date.Before(today) {
+		date = today
+	}
+	return &date
+}
+
+// clampInt returns n bounded to [min, max]
+func clampInt(n, min, max int) int {
+	if n < min {
+		return min
+	}
+	if n > max {
+		return max
+	}
+	return n
+}
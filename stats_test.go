@@ -0,0 +1,62 @@
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestProjectStats(t *testing.T) {
+	day := func(d int, hour int) time.Time {
+		return time.Date(2030, 1, d, hour, 0, 0, 0, time.UTC)
+	}
+	p := &Project{WordCountStart: 1000, WordCountGoal: 11000, DateStart: day(1, 0), DateEnd: day(10, 0)}
+	sprints := []*Sprint{
+		{TimeStart: day(3, 10), Duration: 30, WordCount: 1000},
+		{TimeStart: day(1, 10), Duration: 30, WordCount: 1000},
+		{TimeStart: day(2, 10), Duration: 30, WordCount: 1000},
+		// not started yet
+		{TimeStart: day(5, 10), Duration: 30, WordCount: 5000},
+	}
+
+	stats := p.Stats(sprints, day(3, 12), time.UTC)
+	if stats.WordsWritten != 3000 || stats.WordCount != 4000 || stats.WordsRemaining != 7000 {
+		t.Errorf("words written %d, count %d, remaining %d, want 3000, 4000, 7000", stats.WordsWritten, stats.WordCount, stats.WordsRemaining)
+	}
+	if stats.DaysElapsed != 3 || stats.DaysRemaining != 8 {
+		t.Errorf("days elapsed %d, remaining %d, want 3, 8", stats.DaysElapsed, stats.DaysRemaining)
+	}
+	if stats.RequiredDailyAverage == nil || *stats.RequiredDailyAverage != 875 {
+		t.Errorf("required daily average %v, want 875", stats.RequiredDailyAverage)
+	}
+	if stats.ActualDailyAverage != 1000 || math.Abs(stats.WordsPerMinute-100.0/3) > 1e-9 {
+		t.Errorf("actual daily average %v, words per minute %v, want 1000, 33.33", stats.ActualDailyAverage, stats.WordsPerMinute)
+	}
+	// 1000 words a day from 562.5 on the first day reach the 10000 words of the goal on the 10th
+	if stats.ProjectedCompletionDate == nil || !stats.ProjectedCompletionDate.Equal(day(10, 0)) || !stats.OnTrack {
+		t.Errorf("projected completion %v, on track %v, want 2030-01-10, true", stats.ProjectedCompletionDate, stats.OnTrack)
+	}
+
+	// days are counted in the writer’s time zone
+	auckland, err := time.LoadLocation("Pacific/Auckland")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats := p.Stats(sprints, day(3, 12), auckland); stats.DaysElapsed != 4 || stats.DaysRemaining != 7 {
+		t.Errorf("days elapsed %d, remaining %d in Auckland, want 4, 7", stats.DaysElapsed, stats.DaysRemaining)
+	}
+
+	// a single sprint is not enough history
+	if stats := p.Stats(sprints, day(1, 12), time.UTC); stats.ProjectedCompletionDate != nil || stats.OnTrack {
+		t.Errorf("projected completion %v, on track %v after one sprint, want nil, false", stats.ProjectedCompletionDate, stats.OnTrack)
+	}
+
+	// once the project ended, nothing is required anymore and the goal is reached or not
+	if stats := p.Stats(sprints, day(20, 12), time.UTC); stats.DaysElapsed != 10 || stats.DaysRemaining != 0 || stats.RequiredDailyAverage != nil {
+		t.Errorf("days elapsed %d, remaining %d, required %v after the end, want 10, 0, nil", stats.DaysElapsed, stats.DaysRemaining, stats.RequiredDailyAverage)
+	}
+	done := &Project{WordCountStart: 1000, WordCountGoal: 5000, DateStart: day(1, 0), DateEnd: day(10, 0)}
+	if stats := done.Stats(sprints, day(20, 12), time.UTC); stats.WordsRemaining != 0 || stats.ProjectedCompletionDate != nil || !stats.OnTrack {
+		t.Errorf("remaining %d, projected completion %v, on track %v with the goal reached, want 0, nil, true", stats.WordsRemaining, stats.ProjectedCompletionDate, stats.OnTrack)
+	}
+}
@@ -0,0 +1,303 @@
+package main
+
+import (
+	"context"
+	"time"
+)
+
+// UserStore reads and writes users, their credentials and second factor
+type UserStore interface {
+	// InsertUser inserts a new user with the given password hash and returns it
+	InsertUser(ctx context.Context, username, passwordHash string) (*User, error)
+
+	// GetPasswordHash returns the password hash of the user, and its salt for legacy hashes
+	GetPasswordHash(ctx context.Context, u *User) (passwordHash, passwordSalt string, err error)
+
+	// UpdatePasswordHash replaces the password hash of the user, dropping any legacy salt
+	UpdatePasswordHash(ctx context.Context, u *User, passwordHash string) error
+
+	// UserExistsWithUsername returns true if a user could be found with such username
+	UserExistsWithUsername(ctx context.Context, username string) bool
+
+	// UserExistsWithID returns true if a user could be found with such ID
+	UserExistsWithID(ctx context.Context, id int) bool
+
+	// GetUserByUsername returns the user with the given username
+	GetUserByUsername(ctx context.Context, username string) (*User, error)
+
+	// GetUserByID returns the user with the given ID
+	GetUserByID(ctx context.Context, id int) (*User, error)
+
+	// GetUserByEmail returns the user with the given verified email address, case insensitive
+	GetUserByEmail(ctx context.Context, email string) (*User, error)
+
+	// GetUsers returns all users
+	GetUsers(ctx context.Context) ([]*User, error)
+
+	// DeleteUser deletes a user along with their credentials and tokens
+	DeleteUser(ctx context.Context, user *User) error
+
+	// UpdateUserEmail sets the email address of the user, unverified
+	UpdateUserEmail(ctx context.Context, u *User, email string) error
+
+	// UpdateUserEmailVerified sets whether the user’s email address is verified, ErrEmailTaken if another user verified it
+	UpdateUserEmailVerified(ctx context.Context, u *User, verified bool) error
+
+	// DeleteUnverifiedEmails removes the user’s email address from the other users who did not verify it
+	DeleteUnverifiedEmails(ctx context.Context, u *User) error
+
+	// UpdateUserTimezone sets the IANA name of the user’s time zone
+	UpdateUserTimezone(ctx context.Context, u *User, timezone string) error
+
+	// UpdateUserLocale sets the BCP 47 tag of the user’s locale
+	UpdateUserLocale(ctx context.Context, u *User, locale string) error
+
+	// GetTOTPSettings returns the second factor settings of the user
+	GetTOTPSettings(ctx context.Context, u *User) (*TOTPSettings, error)
+
+	// UpdateTOTPSecret sets a new pending TOTP secret for the user, returns false if TOTP is already enabled
+	UpdateTOTPSecret(ctx context.Context, u *User, secret string) (bool, error)
+
+	// EnableTOTP enables the pending TOTP secret of the user, the given step being the first one used
+	EnableTOTP(ctx context.Context, u *User, step int64) error
+
+	// DisableTOTP removes the user’s TOTP secret and recovery codes
+	DisableTOTP(ctx context.Context, u *User) error
+
+	// UpdateTOTPLastStep records the step of an accepted code, returns false if this or a later step was already used
+	UpdateTOTPLastStep(ctx context.Context, u *User, step int64) (bool, error)
+
+	// ReplaceRecoveryCodes replaces the user’s recovery codes with the given hashes
+	ReplaceRecoveryCodes(ctx context.Context, u *User, hashes []string) error
+
+	// UseRecoveryCode marks the user’s recovery code with the given hash as used, returns false if there is no such unused code
+	UseRecoveryCode(ctx context.Context, u *User, hash string) (bool, error)
+}
+
+// RoleStore reads roles and grants them to users
+type RoleStore interface {
+	// GetRoleByName returns the role with the given name
+	GetRoleByName(ctx context.Context, name string) (*Role, error)
+
+	// GetUserRoles returns the roles granted to the user, by name
+	GetUserRoles(ctx context.Context, u *User) ([]*Role, error)
+
+	// GetUserScopes returns the scopes granted to the user by all of their roles, sorted
+	GetUserScopes(ctx context.Context, u *User) (Scopes, error)
+
+	// AddUserRole grants a role to the user, does nothing if it already was
+	AddUserRole(ctx context.Context, u *User, role *Role) error
+
+	// RemoveUserRole revokes a role from the user
+	RemoveUserRole(ctx context.Context, u *User, role *Role) error
+}
+
+// TokenStore records the access, refresh, personal access and email tokens issued to users
+type TokenStore interface {
+	// InsertAccessToken records an access token
+	InsertAccessToken(ctx context.Context, t *AccessToken) error
+
+	// DeleteExpiredAccessTokens deletes the user’s access tokens expired before the given time
+	DeleteExpiredAccessTokens(ctx context.Context, u *User, before time.Time) error
+
+	// GetAccessTokenByID returns the unexpired access token with the given ID
+	GetAccessTokenByID(ctx context.Context, id string) (*AccessToken, error)
+
+	// GetUserAccessTokens returns the unexpired access tokens of the user, most recent first
+	GetUserAccessTokens(ctx context.Context, u *User) ([]*AccessToken, error)
+
+	// DeleteAccessToken deletes the access token
+	DeleteAccessToken(ctx context.Context, t *AccessToken) error
+
+	// DeleteUserTokens deletes all access and refresh tokens of the user
+	DeleteUserTokens(ctx context.Context, u *User) error
+
+	// InsertRefreshToken records a refresh token
+	InsertRefreshToken(ctx context.Context, rt *RefreshToken) error
+
+	// GetRefreshTokenByID returns the unexpired refresh token with the given ID
+	GetRefreshTokenByID(ctx context.Context, id string) (*RefreshToken, error)
+
+	// UseRefreshToken marks the refresh token as exchanged, returns ErrRefreshTokenReused if it already was
+	UseRefreshToken(ctx context.Context, rt *RefreshToken) error
+
+	// DeleteTokenFamily deletes all refresh and access tokens in the given family
+	DeleteTokenFamily(ctx context.Context, familyID string) error
+
+	// InsertPersonalAccessToken records a personal access token and sets its ID, ErrTokenNameTaken if the user has one with the same name
+	InsertPersonalAccessToken(ctx context.Context, t *PersonalAccessToken) error
+
+	// UsePersonalAccessToken returns the unexpired personal access token with the given hash and records its use
+	UsePersonalAccessToken(ctx context.Context, tokenHash string) (*PersonalAccessToken, error)
+
+	// GetPersonalAccessTokenByID returns the personal access token with the given ID
+	GetPersonalAccessTokenByID(ctx context.Context, id int) (*PersonalAccessToken, error)
+
+	// GetUserPersonalAccessTokens returns the personal access tokens of the user, by name
+	GetUserPersonalAccessTokens(ctx context.Context, u *User) ([]*PersonalAccessToken, error)
+
+	// DeletePersonalAccessToken revokes the personal access token
+	DeletePersonalAccessToken(ctx context.Context, t *PersonalAccessToken) error
+
+	// DeleteUserPersonalAccessTokens revokes all personal access tokens of the user
+	DeleteUserPersonalAccessTokens(ctx context.Context, u *User) error
+
+	// InsertEmailToken records an email token
+	InsertEmailToken(ctx context.Context, t *EmailToken) error
+
+	// UseEmailToken deletes the unexpired email token with the given ID and purpose and returns it
+	UseEmailToken(ctx context.Context, id, purpose string) (*EmailToken, error)
+
+	// DeleteUserEmailTokens deletes the user’s email tokens for the given purpose
+	DeleteUserEmailTokens(ctx context.Context, u *User, purpose string) error
+}
+
+// LoginAttemptStore records authentication failures for the login throttle
+type LoginAttemptStore interface {
+	// GetLoginLockout returns the latest time until which one of the keys is locked out, the zero time if none is
+	GetLoginLockout(ctx context.Context, keys ...string) (time.Time, error)
+
+	// RecordLoginFailure records a failure for the key and returns the number of consecutive failures,
+	// starting over if the previous failure happened before resetBefore
+	RecordLoginFailure(ctx context.Context, key string, at, resetBefore time.Time) (int, error)
+
+	// LockLogin locks the key out until the given time
+	LockLogin(ctx context.Context, key string, until time.Time) error
+
+	// DeleteLoginAttempts forgets the failures recorded for the key
+	DeleteLoginAttempts(ctx context.Context, key string) error
+}
+
+// ProjectStore reads and writes projects
+type ProjectStore interface {
+	// GetUserProjects returns a user’s projects ordered by name
+	GetUserProjects(ctx context.Context, u *User) ([]*Project, error)
+
+	// GetProjectByID returns the project with the given ID
+	GetProjectByID(ctx context.Context, id int) (*Project, error)
+
+	// GetProjectBySlug returns the project with the given slug belonging to the given user
+	GetProjectBySlug(ctx context.Context, u *User, slug string) (*Project, error)
+
+	// InsertProject inserts a new project and sets its ID
+	InsertProject(ctx context.Context, p *Project) error
+
+	// UpdateProject saves an existing project
+	UpdateProject(ctx context.Context, p *Project) error
+
+	// DeleteProject deletes a project along with all of the sprints on it
+	DeleteProject(ctx context.Context, p *Project) error
+}
+
+// SprintStore reads and writes sprints and their invites
+type SprintStore interface {
+	// GetProjectSprints returns the sprints on a given project, latest first
+	GetProjectSprints(ctx context.Context, p *Project) ([]*Sprint, error)
+
+	// GetProjectSprintsBetween returns the sprints on the project starting in [from, to), earliest first
+	GetProjectSprintsBetween(ctx context.Context, p *Project, from, to time.Time) ([]*Sprint, error)
+
+	// SumProjectWordCount returns the words written during the sprints on the project starting before the given time
+	SumProjectWordCount(ctx context.Context, p *Project, before time.Time) (int, error)
+
+	// GetSprintByID returns the sprint with the given ID
+	GetSprintByID(ctx context.Context, id int) (*Sprint, error)
+
+	// GetSprintBySlug returns the sprint with the given slug
+	GetSprintBySlug(ctx context.Context, slug string) (*Sprint, error)
+
+	// GetSprintByInviteSlug returns the sprint open to guests with the given invite slug
+	GetSprintByInviteSlug(ctx context.Context, inviteSlug string) (*Sprint, error)
+
+	// InsertSprint inserts a new sprint and sets its ID and creation time
+	InsertSprint(ctx context.Context, s *Sprint) error
+
+	// UpdateSprint saves an existing sprint and sets its update time
+	UpdateSprint(ctx context.Context, s *Sprint) error
+
+	// DeleteSprint removes a sprint with its invite and the links of its guests, whose sprints remain
+	DeleteSprint(ctx context.Context, s *Sprint) error
+
+	// GetNextSprint returns the first sprint on the same project starting after the end of the given one
+	GetNextSprint(ctx context.Context, s *Sprint) (*Sprint, error)
+
+	// CountMilestones returns the number of milestones on the sprint’s project up to and including the sprint
+	CountMilestones(ctx context.Context, s *Sprint) (int, error)
+
+	// GetPreviousMilestone returns the last milestone before the sprint on its project, or nil if there is none
+	GetPreviousMilestone(ctx context.Context, s *Sprint) (*Sprint, error)
+
+	// SumSprints returns the word count and the duration in minutes of the sprints on the project of s
+	// up to and including s, and after since if not nil, or -1 for both if there are no such sprints
+	SumSprints(ctx context.Context, s *Sprint, since *Sprint) (wordCount, duration int, err error)
+
+	// GetProjectMilestones returns the milestones on the project with the words written and time spent since the previous one,
+	// earliest first
+	GetProjectMilestones(ctx context.Context, p *Project) ([]*Milestone, error)
+
+	// GetUserSprintsChangedSince returns the user’s sprints created, saved or whose break ends at or after the given time,
+	// earliest first
+	GetUserSprintsChangedSince(ctx context.Context, u *User, since time.Time) ([]*Sprint, error)
+
+	// InsertGuestSprint links a guest sprint to the host sprint it joined, returns ErrSprintAlreadyJoined if its user already did
+	InsertGuestSprint(ctx context.Context, guest, host *Sprint) error
+
+	// UserJoinedSprint returns true if one of the user’s sprints already joined the host sprint
+	UserJoinedSprint(ctx context.Context, userID int, host *Sprint) (bool, error)
+
+	// GetGuestSprints returns the guest sprints of a host sprint, by username
+	GetGuestSprints(ctx context.Context, s *Sprint) ([]*Sprint, error)
+
+	// GetHostSprint returns the host sprint a guest sprint joined
+	GetHostSprint(ctx context.Context, guest *Sprint) (*Sprint, error)
+}
+
+// InviteStore reads and writes the invites opening sprints to guests
+type InviteStore interface {
+	// InsertInvite opens a sprint to guests
+	InsertInvite(ctx context.Context, i *Invite) error
+
+	// GetInvite returns the invite of the host sprint with the given ID, open or closed.
+	// Within a transaction, the invite is locked until the transaction ends.
+	GetInvite(ctx context.Context, hostSprintID int) (*Invite, error)
+
+	// GetInviteBySlug returns the open invite with the given slug
+	GetInviteBySlug(ctx context.Context, slug string) (*Invite, error)
+
+	// UpdateInvite saves an existing invite
+	UpdateInvite(ctx context.Context, i *Invite) error
+
+	// CountGuestSprints returns the number of guest sprints of the host sprint with the given ID
+	CountGuestSprints(ctx context.Context, hostSprintID int) (int, error)
+}
+
+// RestDayStore reads and writes the rest days declared by users
+type RestDayStore interface {
+	// GetUserRestDays returns the user’s rest days from one date to another, both included, earliest first
+	GetUserRestDays(ctx context.Context, u *User, from, to time.Time) ([]time.Time, error)
+
+	// InsertRestDay declares a rest day for the user, does nothing if it already was
+	InsertRestDay(ctx context.Context, u *User, date time.Time) error
+
+	// DeleteRestDay removes a rest day of the user, does nothing if there is none
+	DeleteRestDay(ctx context.Context, u *User, date time.Time) error
+}
+
+// Store gives access to all models, PostgresStore in production and MemoryStore for testing
+type Store interface {
+	UserStore
+	RoleStore
+	TokenStore
+	LoginAttemptStore
+	ProjectStore
+	SprintStore
+	InviteStore
+	RestDayStore
+
+	// Transaction runs fn with a store whose writes are committed if it returns nil and rolled back otherwise.
+	// Within a transaction, fn joins it.
+	Transaction(ctx context.Context, fn func(tx Store) error) error
+
+	// Close releases the resources held by the store
+	Close() error
+}
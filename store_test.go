@@ -0,0 +1,318 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+)
+
+// errTestWrite is returned by failingStore after a write
+var errTestWrite = errors.New("test: failure after write")
+
+// failingStore fails after writing refresh tokens and guest sprints, within transactions too
+type failingStore struct {
+	Store
+
+	// refreshTokens the refresh tokens written
+	refreshTokens *[]*RefreshToken
+}
+
+// newFailingStore returns a failingStore writing to the given store
+func newFailingStore(store Store) *failingStore {
+	return &failingStore{Store: store, refreshTokens: &[]*RefreshToken{}}
+}
+
+func (store *failingStore) Transaction(ctx context.Context, fn func(tx Store) error) error {
+	return store.Store.Transaction(ctx, func(tx Store) error {
+		return fn(&failingStore{Store: tx, refreshTokens: store.refreshTokens})
+	})
+}
+
+func (store *failingStore) InsertRefreshToken(ctx context.Context, rt *RefreshToken) error {
+	if err := store.Store.InsertRefreshToken(ctx, rt); err != nil {
+		return err
+	}
+	*store.refreshTokens = append(*store.refreshTokens, rt)
+	return errTestWrite
+}
+
+func (store *failingStore) InsertGuestSprint(ctx context.Context, guest, host *Sprint) error {
+	if err := store.Store.InsertGuestSprint(ctx, guest, host); err != nil {
+		return err
+	}
+	return errTestWrite
+}
+
+// testStores returns the stores to test: a MemoryStore, and a PostgresStore on the migrated database
+// at AUTOCHRONE_TEST_DB_URL if set
+func testStores(t *testing.T) map[string]Store {
+	t.Helper()
+	stores := map[string]Store{"memory": NewMemoryStore()}
+
+	if url := os.Getenv("AUTOCHRONE_TEST_DB_URL"); url != "" {
+		store, err := NewPostgresStore(url, PoolConfig{MaxOpenConns: 4})
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { store.Close() })
+
+		migrator, err := NewMigrator(store)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := migrator.Up(); err != nil {
+			t.Fatal(err)
+		}
+		stores["postgres"] = store
+	}
+	return stores
+}
+
+// testUsername returns a username unused in the test database
+func testUsername(name string) string {
+	return fmt.Sprintf("%s%x", name, time.Now().UnixNano())
+}
+
+func TestTransactionGenerateTokenPair(t *testing.T) {
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			user, err := NewUser(ctx, store, testUsername("alice"), testPassword)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			failing := newFailingStore(store)
+			if _, err := user.GenerateTokenPair(ctx, failing, Scopes{"basic"}, SessionInfo{}); err != errTestWrite {
+				t.Fatalf("GenerateTokenPair error %v, want %v", err, errTestWrite)
+			}
+
+			if tokens, err := store.GetUserAccessTokens(ctx, user); err != nil || len(tokens) != 0 {
+				t.Errorf("%d access tokens persisted, error %v", len(tokens), err)
+			}
+			if len(*failing.refreshTokens) != 1 {
+				t.Fatalf("%d refresh tokens written, want 1", len(*failing.refreshTokens))
+			}
+			rt := (*failing.refreshTokens)[0]
+			if _, err := store.GetRefreshTokenByID(ctx, rt.ID); err == nil {
+				t.Errorf("refresh token of family %q persisted", rt.FamilyID)
+			}
+		})
+	}
+}
+
+func TestTransactionNewGuestSprint(t *testing.T) {
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			today := LocalDate(time.Now(), time.UTC)
+
+			host, err := NewUser(ctx, store, testUsername("alice"), testPassword)
+			if err != nil {
+				t.Fatal(err)
+			}
+			hostProject, err := host.NewProject(ctx, store, "Novel", "novel", today, today.AddDate(0, 0, 29), 0, 50000)
+			if err != nil {
+				t.Fatal(err)
+			}
+			hostSprint, err := hostProject.NewSprint(ctx, store, time.Now().Add(time.Hour), 20, 5)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := hostSprint.OpenToGuests(ctx, store, "", nil, 0); err != nil {
+				t.Fatal(err)
+			}
+
+			guest, err := NewUser(ctx, store, testUsername("bob"), testPassword)
+			if err != nil {
+				t.Fatal(err)
+			}
+			guestProject, err := guest.NewProject(ctx, store, "Essay", "essay", today, today.AddDate(0, 0, 29), 0, 10000)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := guestProject.NewGuestSprint(ctx, newFailingStore(store), hostSprint); err != errTestWrite {
+				t.Fatalf("NewGuestSprint error %v, want %v", err, errTestWrite)
+			}
+
+			if sprints, err := store.GetProjectSprints(ctx, guestProject); err != nil || len(sprints) != 0 {
+				t.Errorf("%d guest sprints persisted, error %v", len(sprints), err)
+			}
+			if n, err := store.CountGuestSprints(ctx, hostSprint.ID); err != nil || n != 0 {
+				t.Errorf("%d guests persisted, error %v", n, err)
+			}
+			if joined, err := store.UserJoinedSprint(ctx, guest.ID, hostSprint); err != nil || joined {
+				t.Errorf("guest joined the host sprint, error %v", err)
+			}
+
+			// without failure, the guest joins
+			if _, err := guestProject.NewGuestSprint(ctx, store, hostSprint); err != nil {
+				t.Fatal(err)
+			}
+			if n, err := store.CountGuestSprints(ctx, hostSprint.ID); err != nil || n != 1 {
+				t.Errorf("%d guests, error %v, want 1", n, err)
+			}
+		})
+	}
+}
+
+func TestDeleteOpenedSprint(t *testing.T) {
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			today := LocalDate(time.Now(), time.UTC)
+
+			host, err := NewUser(ctx, store, testUsername("alice"), testPassword)
+			if err != nil {
+				t.Fatal(err)
+			}
+			hostProject, err := host.NewProject(ctx, store, "Novel", "novel", today, today.AddDate(0, 0, 29), 0, 50000)
+			if err != nil {
+				t.Fatal(err)
+			}
+			guest, err := NewUser(ctx, store, testUsername("bob"), testPassword)
+			if err != nil {
+				t.Fatal(err)
+			}
+			guestProject, err := guest.NewProject(ctx, store, "Essay", "essay", today, today.AddDate(0, 0, 29), 0, 10000)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// openSprint returns a sprint open to guests and the sprint of a guest who joined it
+			openSprint := func(start time.Time) (*Sprint, *Sprint) {
+				t.Helper()
+				hostSprint, err := hostProject.NewSprint(ctx, store, start, 20, 5)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if _, err := hostSprint.OpenToGuests(ctx, store, "", nil, 0); err != nil {
+					t.Fatal(err)
+				}
+				guestSprint, err := guestProject.NewGuestSprint(ctx, store, hostSprint)
+				if err != nil {
+					t.Fatal(err)
+				}
+				return hostSprint, guestSprint
+			}
+
+			hostSprint, guestSprint := openSprint(time.Now().Add(time.Hour))
+			if err := store.DeleteSprint(ctx, hostSprint); err != nil {
+				t.Fatalf("DeleteSprint: %v", err)
+			}
+			if _, err := store.GetInvite(ctx, hostSprint.ID); err == nil {
+				t.Error("invite of the deleted sprint kept")
+			}
+			if _, err := store.GetSprintBySlug(ctx, guestSprint.Slug); err != nil {
+				t.Errorf("guest sprint deleted with its host: %v", err)
+			}
+			if _, err := store.GetHostSprint(ctx, guestSprint); err == nil {
+				t.Error("guest sprint still linked to the deleted host")
+			}
+
+			// and so does deleting the project of a sprint open to guests
+			hostSprint, guestSprint = openSprint(time.Now().Add(2 * time.Hour))
+			if err := store.DeleteProject(ctx, hostProject); err != nil {
+				t.Fatalf("DeleteProject: %v", err)
+			}
+			if _, err := store.GetInvite(ctx, hostSprint.ID); err == nil {
+				t.Error("invite of the deleted project kept")
+			}
+			if _, err := store.GetSprintBySlug(ctx, guestSprint.Slug); err != nil {
+				t.Errorf("guest sprint deleted with its host project: %v", err)
+			}
+		})
+	}
+}
+
+func TestGetMilestones(t *testing.T) {
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			today := LocalDate(time.Now(), time.UTC)
+
+			u, err := NewUser(ctx, store, testUsername("alice"), testPassword)
+			if err != nil {
+				t.Fatal(err)
+			}
+			p, err := u.NewProject(ctx, store, "Novel", "novel", today, today.AddDate(0, 0, 29), 0, 50000)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// a project without milestones has an empty list
+			milestones, err := p.GetMilestones(ctx, store)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if milestones == nil || len(milestones) != 0 {
+				t.Errorf("milestones %v without sprints, want []", milestones)
+			}
+
+			// the first milestone has no words written, the sprints after the last milestone are not counted
+			start := time.Now().Add(time.Hour).Truncate(time.Minute)
+			sprints := []*Sprint{}
+			for i, sprint := range []struct {
+				wordCount   int
+				isMilestone bool
+			}{
+				{0, true},
+				{100, false},
+				{300, true},
+				{500, false},
+			} {
+				s, err := p.NewSprint(ctx, store, start.Add(time.Duration(i)*time.Hour), 20, 0)
+				if err != nil {
+					t.Fatal(err)
+				}
+				s.WordCount = sprint.wordCount
+				s.IsMilestone = sprint.isMilestone
+				if err := store.UpdateSprint(ctx, s); err != nil {
+					t.Fatal(err)
+				}
+				sprints = append(sprints, s)
+			}
+
+			milestones, err = p.GetMilestones(ctx, store)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := []Milestone{
+				{Index: 1, SprintSlug: sprints[0].Slug, WordCount: 0, Duration: 20, Speed: 0},
+				{Index: 2, SprintSlug: sprints[2].Slug, WordCount: 400, Duration: 40, Speed: 10},
+			}
+			if len(milestones) != len(want) {
+				t.Fatalf("%d milestones, want %d", len(milestones), len(want))
+			}
+			for i, m := range milestones {
+				if m.Index != want[i].Index || m.SprintSlug != want[i].SprintSlug || m.WordCount != want[i].WordCount || m.Duration != want[i].Duration || m.Speed != want[i].Speed {
+					t.Errorf("milestone %d = %+v, want %+v", i, *m, want[i])
+				}
+			}
+
+			// the sprint methods count the milestones up to and including the sprint, and the words since the previous one
+			for i, wantIndex := range []int{1, 1, 2, 2} {
+				index, err := sprints[i].MilestoneIndex(ctx, store)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if index != wantIndex {
+					t.Errorf("sprint %d milestone index %d, want %d", i, index, wantIndex)
+				}
+			}
+			for i, wantWords := range []int{0, 100, 400, 500} {
+				words, err := sprints[i].MilestoneWordCount(ctx, store)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if words != wantWords {
+					t.Errorf("sprint %d milestone word count %d, want %d", i, words, wantWords)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"time"
+)
+
+// Streak is a run of days on which the daily target was met, rest days aside
+type Streak struct {
+	// Start the first day of the streak
+	Start time.Time `json:"start"`
+
+	// End the last day of the streak
+	End time.Time `json:"end"`
+
+	// Days the number of days on which the target was met, rest days excluded
+	Days int `json:"days"`
+}
+
+// Streaks are the streaks of a user or of one of their projects
+type Streaks struct {
+	// Current the days of the streak still going on, 0 if it was broken.
+	// Today does not break a streak until it is over.
+	Current int `json:"current"`
+
+	// Longest the days of the longest streak
+	Longest int `json:"longest"`
+
+	// History every streak, earliest first
+	History []*Streak `json:"history"`
+}
+
+// ProjectStreaks are the streaks on a project, counted from its start date
+type ProjectStreaks struct {
+	// ProjectSlug the slug of the project
+	ProjectSlug string `json:"pslug"`
+
+	Streaks
+}
+
+// UserStreaks are the streaks of a user on all of their projects together, and on each of them
+type UserStreaks struct {
+	Streaks
+
+	// Projects the streaks on each of the user’s projects, ordered by name
+	Projects []*ProjectStreaks `json:"projects"`
+}
+
+// streakDay is a day of the history streaks are found in
+type streakDay struct {
+	date time.Time
+	met  bool
+	rest bool
+}
+
+// GetStreaks computes the user’s streaks up to the given time, counting days in their time zone
+// and looking back at most calendarMaxDays days.
+// On a project, the target of a day is the words left to reach the goal on time, so days after its end
+// or once its goal is reached break the streak.
+// Overall, it is the sum of the targets of the projects, or a single word if none has one that day.
+func (u *User) GetStreaks(ctx context.Context, store Store, now time.Time) (*UserStreaks, error) {
+	loc := u.Location()
+	today := LocalDate(now, loc)
+
+	projects, err := store.GetUserProjects(ctx, u)
+	if err != nil {
+		return nil, err
+	}
+
+	// days are counted from the start of the first project
+	from := today
+	for _, p := range projects {
+		if date := LocalDate(p.DateStart, time.UTC); date.Before(from) {
+			from = date
+		}
+	}
+	if earliest := today.AddDate(0, 0, 1-calendarMaxDays); from.Before(earliest) {
+		from = earliest
+	}
+
+	restDays, err := store.GetUserRestDays(ctx, u, from, today)
+	if err != nil {
+		return nil, err
+	}
+	rest := map[time.Time]bool{}
+	for _, d := range restDays {
+		rest[d] = true
+	}
+
+	n := int(today.Sub(from)/oneDay) + 1
+	wordCounts := make([]int, n)
+	targets := make([]int, n)
+
+	streaks := &UserStreaks{Projects: []*ProjectStreaks{}}
+	for _, p := range projects {
+		calendar, err := p.GetCalendar(ctx, store, loc, from, today)
+		if err != nil {
+			return nil, err
+		}
+
+		days := []streakDay{}
+		for i, d := range calendar {
+			wordCounts[i] += d.WordCount
+			targets[i] += d.Target
+			if !d.Date.Before(p.DateStart) {
+				days = append(days, streakDay{date: d.Date, met: d.Target > 0 && d.WordCount >= d.Target, rest: rest[d.Date]})
+			}
+		}
+		streaks.Projects = append(streaks.Projects, &ProjectStreaks{ProjectSlug: p.Slug, Streaks: findStreaks(days)})
+	}
+
+	days := make([]streakDay, n)
+	for i := range days {
+		target := targets[i]
+		if target == 0 {
+			target = 1
+		}
+		date := from.AddDate(0, 0, i)
+		days[i] = streakDay{date: date, met: wordCounts[i] >= target, rest: rest[date]}
+	}
+	streaks.Streaks = findStreaks(days)
+
+	return streaks, nil
+}
+
+// findStreaks returns the streaks in consecutive days ending today.
+// Rest days on which the target is not met neither break nor extend a streak, and neither does today.
+func findStreaks(days []streakDay) Streaks {
+	streaks := Streaks{History: []*Streak{}}
+	var current *Streak
+	for i, d := range days {
+		switch {
+		case d.met:
+			if current == nil {
+				current = &Streak{Start: d.date}
+				streaks.History = append(streaks.History, current)
+			}
+			current.End = d.date
+			current.Days++
+			if current.Days > streaks.Longest {
+				streaks.Longest = current.Days
+			}
+		case d.rest || i == len(days)-1:
+		default:
+			current = nil
+		}
+	}
+
+	if current != nil {
+		streaks.Current = current.Days
+	}
+	return streaks
+}
+
+// GetUserRestDays returns the user’s rest days from one date to another, both included, earliest first
+func (store *PostgresStore) GetUserRestDays(ctx context.Context, u *User, from, to time.Time) ([]time.Time, error) {
+	dates := []time.Time{}
+	err := store.db.SelectContext(ctx, &dates, "select date from autochrone.rest_days where user_id = $1 and date between $2 and $3 order by date",
+		u.ID, from.Format("2006-01-02"), to.Format("2006-01-02"))
+	if err != nil {
+		return nil, err
+	}
+
+	// dates are midnight UTC like project dates
+	for i, d := range dates {
+		dates[i] = LocalDate(d, time.UTC)
+	}
+	return dates, nil
+}
+
+// InsertRestDay declares a rest day for the user, does nothing if it already was
+func (store *PostgresStore) InsertRestDay(ctx context.Context, u *User, date time.Time) error {
+	_, err := store.db.ExecContext(ctx, "insert into autochrone.rest_days (user_id, date) values ($1, $2) on conflict do nothing",
+		u.ID, date.Format("2006-01-02"))
+	return err
+}
+
+// DeleteRestDay removes a rest day of the user, does nothing if there is none
+func (store *PostgresStore) DeleteRestDay(ctx context.Context, u *User, date time.Time) error {
+	_, err := store.db.ExecContext(ctx, "delete from autochrone.rest_days where user_id = $1 and date = $2", u.ID, date.Format("2006-01-02"))
+	return err
+}
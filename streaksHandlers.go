@@ -0,0 +1,103 @@
+package main
+
+import (
+	"github.com/gin-gonic/gin"
+
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// restDaysAhead how far ahead rest days are listed by default
+const restDaysAhead = 366
+
+// StreaksGET responds with the streaks of a user, overall and on each of their projects
+func StreaksGET(c *gin.Context) {
+	store := c.MustGet("store").(Store)
+	ctx := c.Request.Context()
+	user := c.MustGet("user").(*User)
+
+	streaks, err := user.GetStreaks(ctx, store, time.Now())
+	if err != nil {
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	c.JSON(http.StatusOK, streaks)
+}
+
+// RestDaysGET responds with the rest days of a user from one date to another, both included,
+// by default up to a year ahead and over at most calendarMaxDays days
+func RestDaysGET(c *gin.Context) {
+	store := c.MustGet("store").(Store)
+	ctx := c.Request.Context()
+	user := c.MustGet("user").(*User)
+
+	var err error
+	to := LocalDate(time.Now(), user.Location()).AddDate(0, 0, restDaysAhead)
+	if c.Query("to") != "" {
+		if to, err = ParseDate(c.Query("to")); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid date %q", c.Query("to"))})
+			return
+		}
+	}
+	from := to.AddDate(0, 0, 1-calendarMaxDays)
+	if c.Query("from") != "" {
+		if from, err = ParseDate(c.Query("from")); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid date %q", c.Query("from"))})
+			return
+		}
+	}
+	if err := CheckDateRange(from, to); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	dates, err := store.GetUserRestDays(ctx, user, from, to)
+	if err != nil {
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	c.JSON(http.StatusOK, dates)
+}
+
+// RestDaysDatePUT declares a rest day for a user
+func RestDaysDatePUT(c *gin.Context) {
+	store := c.MustGet("store").(Store)
+	ctx := c.Request.Context()
+	user := c.MustGet("user").(*User)
+
+	date, err := time.Parse("2006-01-02", c.Param("date"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid date %q", c.Param("date"))})
+		return
+	}
+
+	if err := store.InsertRestDay(ctx, user, date); err != nil {
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	c.Status(http.StatusOK)
+}
+
+// RestDaysDateDELETE removes a rest day of a user
+func RestDaysDateDELETE(c *gin.Context) {
+	store := c.MustGet("store").(Store)
+	ctx := c.Request.Context()
+	user := c.MustGet("user").(*User)
+
+	date, err := time.Parse("2006-01-02", c.Param("date"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid date %q", c.Param("date"))})
+		return
+	}
+
+	if err := store.DeleteRestDay(ctx, user, date); err != nil {
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	c.Status(http.StatusOK)
+}
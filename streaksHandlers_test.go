@@ -0,0 +1,45 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestRestDaysGET(t *testing.T) {
+	r := NewRouter(NewMemoryStore(), NewRoomHub())
+	testSignUp(t, r, "alice")
+	alice := testLogIn(t, r, "alice", "basic").AccessToken
+
+	today := LocalDate(time.Now(), time.UTC)
+	ahead := today.AddDate(0, 0, restDaysAhead).Format("2006-01-02")
+	if w := testRequest(r, http.MethodPut, "/users/alice/rest-days/"+ahead, alice, nil); w.Code != http.StatusOK {
+		t.Fatalf("put rest day: status %d", w.Code)
+	}
+
+	// the default range holds the rest days up to a year ahead
+	w := testRequest(r, http.MethodGet, "/users/alice/rest-days/", "", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("default range: status %d %s", w.Code, w.Body.String())
+	}
+	dates := []time.Time{}
+	decodeJSON(t, w, &dates)
+	if len(dates) != 1 || dates[0].Format("2006-01-02") != ahead {
+		t.Errorf("rest days %v, want [%s]", dates, ahead)
+	}
+
+	for _, test := range []struct {
+		from, to time.Time
+		code     int
+	}{
+		{today, today, http.StatusOK},
+		{today, today.AddDate(0, 0, calendarMaxDays-1), http.StatusOK},
+		{today, today.AddDate(0, 0, calendarMaxDays), http.StatusBadRequest},
+		{today, today.AddDate(0, 0, -1), http.StatusBadRequest},
+	} {
+		path := "/users/alice/rest-days/?from=" + test.from.Format("2006-01-02") + "&to=" + test.to.Format("2006-01-02")
+		if w := testRequest(r, http.MethodGet, path, "", nil); w.Code != test.code {
+			t.Errorf("%s: status %d, want %d", path, w.Code, test.code)
+		}
+	}
+}
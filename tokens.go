@@ -1,104 +1,109 @@
 package main
 
 import (
-	"github.com/dgrijalva/jwt-go"
+	"github.com/golang-jwt/jwt/v4"
 
+	"context"
 	"errors"
-	"os"
+	"strconv"
 	"time"
 )
 
 // CanUseScope checks if a string is a valid scope for this user
-func (user *User) CanUseScope(scope string) bool {
-	// TODO access user authorized scopes in the DB
-	switch scope {
-	case "null", "basic":
-		return true
+func (user *User) CanUseScope(ctx context.Context, store Store, scope string) bool {
+	return user.CanUseScopes(ctx, store, Scopes{scope})
+}
+
+// CanUseScopes checks if all scopes are granted to this user by their roles.
+// The "null" scope is granted to everyone.
+func (user *User) CanUseScopes(ctx context.Context, store Store, scopes Scopes) bool {
+	granted, err := store.GetUserScopes(ctx, user)
+	if err != nil {
+		return false
 	}
-	return false
+
+	for _, scope := range scopes {
+		if scope != "null" && !granted.Has(scope) {
+			return false
+		}
+	}
+	return true
 }
 
 // UserAuthClaims includes custom claims for authenticating users
 type UserAuthClaims struct {
 	Username string `json:"username"`
-	Scope    string `json:"scope"`
+	// Scope space separated scopes
+	Scope string `json:"scope"`
+	// PendingScope space separated scopes granted once a "mfa_pending" token is exchanged with a second factor
+	PendingScope string `json:"pendingScope,omitempty"`
 	jwt.StandardClaims
 }
 
-// GenerateToken generate, signs and returns a token as a string
-func (user *User) GenerateToken(scope string) (string, error) {
-	// check scope
-	if !user.CanUseScope(scope) {
+// Scopes returns the scopes granted by the token
+func (claims UserAuthClaims) Scopes() Scopes {
+	return ParseScopes(claims.Scope)
+}
+
+// GenerateToken generate, signs, records and returns a token as a string
+func (user *User) GenerateToken(ctx context.Context, store Store, scopes Scopes, session SessionInfo) (string, error) {
+	// check scopes
+	if len(scopes) == 0 || !user.CanUseScopes(ctx, store, scopes) {
 		return "", errors.New("invalid scope")
 	}
 
-	// generate token with method HS384
-	now := time.Now()
-	token := jwt.NewWithClaims(jwt.SigningMethodHS384, UserAuthClaims{
-		Username: user.Username,
-		Scope:    "basic",
-		StandardClaims: jwt.StandardClaims{
-			Audience:  "autochrone-front",
-			ExpiresAt: now.Add(time.Minute * time.Duration(15)).Unix(),
-			// Id
-			IssuedAt:  now.Unix(),
-			Issuer:    "autochrone-api",
-			NotBefore: now.Unix(),
-			// Subject
-		},
-	})
-
-	// get signing key
-	tokenSigningKeyFile, err := os.Open(tokenSigningKeyFilePath)
-	if err != nil {
-		return "", errors.New("could not access signing key")
-	}
-	var tokenSigningKey []byte
-	_, err = tokenSigningKeyFile.Read(tokenSigningKey)
-	if err != nil {
-		return "", errors.New("could not access signing key")
+	return user.signToken(ctx, store, UserAuthClaims{Scope: scopes.String()}, config.Tokens.AccessTokenLifetime, session)
+}
+
+// GenerateMFAPendingToken generates, signs, records and returns a short-lived "mfa_pending" token as a string.
+// It can only be exchanged at /auth/mfa, along with a second factor, for tokens in the given scopes.
+func (user *User) GenerateMFAPendingToken(ctx context.Context, store Store, scopes Scopes, session SessionInfo) (string, error) {
+	// check scopes
+	if len(scopes) == 0 || !user.CanUseScopes(ctx, store, scopes) {
+		return "", errors.New("invalid scope")
 	}
 
-	// sign and return
-	return token.SignedString(tokenSigningKey)
+	return user.signToken(ctx, store, UserAuthClaims{Scope: "mfa_pending", PendingScope: scopes.String()}, config.Tokens.MFAPendingTokenLifetime, session)
 }
 
-// ParseToken parses a token from a string
-// returns token claims or an error
-func ParseToken(tokenString string) (UserAuthClaims, error) {
-	// get signing key
-	tokenSigningKeyFile, err := os.Open(tokenSigningKeyFilePath)
+// signToken fills in the standard claims, records the token and signs it
+func (user *User) signToken(ctx context.Context, store Store, claims UserAuthClaims, lifetime time.Duration, session SessionInfo) (string, error) {
+	// record token
+	id, err := GenerateTokenID()
 	if err != nil {
-		return UserAuthClaims{}, errors.New("could not access signing key")
+		return "", errors.New("could not generate token id")
 	}
-	var tokenSigningKey []byte
-	_, err = tokenSigningKeyFile.Read(tokenSigningKey)
-	if err != nil {
-		return UserAuthClaims{}, errors.New("could not access signing key")
+	now := time.Now()
+	expiresAt := now.Add(lifetime)
+	if _, err := user.NewAccessToken(ctx, store, id, claims.Scope, now, expiresAt, session); err != nil {
+		return "", errors.New("could not record token")
 	}
 
-	// parse token
-	token, err := jwt.ParseWithClaims(tokenString, &UserAuthClaims{}, func(token *jwt.Token) (interface{}, error) {
-		// check token was signed with HMAC
-		if method, ok := token.Method.(*jwt.SigningMethodHMAC); !ok || method != jwt.SigningMethodHS384 {
-			return nil, errors.New("invalid signing method")
-		}
-
-		return tokenSigningKey, nil
-	})
+	// sign token with the current signing key
+	claims.Username = user.Username
+	claims.StandardClaims = jwt.StandardClaims{
+		Audience:  "autochrone-front",
+		ExpiresAt: expiresAt.Unix(),
+		Id:        id,
+		IssuedAt:  now.Unix(),
+		Issuer:    "autochrone-api",
+		NotBefore: now.Unix(),
+		Subject:   strconv.Itoa(user.ID),
+	}
+	token, err := signingKeys.Sign(claims)
 	if err != nil {
-		return UserAuthClaims{}, errors.New("could not parse token")
+		return "", errors.New("could not sign token")
 	}
 
-	// token has been parsed
-	if token.Valid {
-		// valid token: get claims
-		if claims, ok := token.Claims.(*UserAuthClaims); ok {
-			return *claims, nil
-		} else {
-			return UserAuthClaims{}, errors.New("could not get claims")
-		}
-	} else if ve, ok := err.(*jwt.ValidationError); ok {
+	return token, nil
+}
+
+// ParseToken parses a token from a string
+// returns token claims or an error
+func ParseToken(ctx context.Context, store Store, tokenString string) (UserAuthClaims, error) {
+	// parse token, verifying it with the key it was signed with
+	token, err := jwt.ParseWithClaims(tokenString, &UserAuthClaims{}, signingKeys.Keyfunc)
+	if ve, ok := err.(*jwt.ValidationError); ok {
 		// token validation
 		if ve.Errors&(jwt.ValidationErrorMalformed|jwt.ValidationErrorUnverifiable) != 0 {
 			return UserAuthClaims{}, errors.New("malformed or unverifiable token")
@@ -109,20 +114,23 @@ func ParseToken(tokenString string) (UserAuthClaims, error) {
 		} else if ve.Errors&jwt.ValidationErrorClaimsInvalid != 0 {
 			return UserAuthClaims{}, errors.New("invalid token claims")
 		}
-	}
-	return UserAuthClaims{}, errors.New("unknown error")
-}
-
-// TokenValidInScope parses a token string and checks if it gives a given scope to a user
-func (user *User) TokenValidInScope(tokenString, scope string) (ok bool, err error) {
-	if !user.CanUseScope(scope) {
-		return false, errors.New("unauthorized scope for user")
+		return UserAuthClaims{}, errors.New("could not parse token")
+	} else if err != nil {
+		return UserAuthClaims{}, errors.New("could not parse token")
 	}
 
-	userAuthClaims, err := ParseToken(tokenString)
-	if err != nil {
-		return false, err
+	// token has been parsed
+	if token.Valid {
+		// valid token: get claims
+		if claims, ok := token.Claims.(*UserAuthClaims); ok {
+			// check token has not been revoked
+			if _, err := store.GetAccessTokenByID(ctx, claims.Id); err != nil {
+				return UserAuthClaims{}, errors.New("revoked token")
+			}
+			return *claims, nil
+		} else {
+			return UserAuthClaims{}, errors.New("could not get claims")
+		}
 	}
-
-	return userAuthClaims.Scope == scope, nil
+	return UserAuthClaims{}, errors.New("unknown error")
 }
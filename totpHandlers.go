@@ -0,0 +1,115 @@
+package main
+
+import (
+	"github.com/gin-gonic/gin"
+
+	"net/http"
+)
+
+// TOTPPOST starts a TOTP enrollment and responds with the secret and its otpauth URI.
+// requires the user password in the Secret header
+func TOTPPOST(c *gin.Context) {
+	store := c.MustGet("store").(Store)
+	ctx := c.Request.Context()
+	user := c.MustGet("user").(*User)
+	secret := c.GetHeader("Secret")
+
+	// check secret
+	if !user.CheckPassword(ctx, store, secret) {
+		c.JSON(http.StatusUnauthorized, nil)
+		return
+	}
+
+	totpSecret, err := user.EnrollTOTP(ctx, store)
+	if err == ErrTOTPEnabled {
+		c.AbortWithStatus(http.StatusConflict)
+		return
+	} else if err != nil {
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"secret": totpSecret, "uri": TOTPURI(user.Username, totpSecret)})
+}
+
+// TOTPConfirmPOSTRequest contains a code from the authenticator app
+type TOTPConfirmPOSTRequest struct {
+	Code string `json:"code"`
+}
+
+// TOTPConfirmPOST enables TOTP with a first code and responds with recovery codes
+func TOTPConfirmPOST(c *gin.Context) {
+	store := c.MustGet("store").(Store)
+	ctx := c.Request.Context()
+	user := c.MustGet("user").(*User)
+
+	req := &TOTPConfirmPOSTRequest{}
+	if err := c.BindJSON(req); err != nil {
+		return
+	}
+
+	recoveryCodes, err := user.EnableTOTP(ctx, store, req.Code)
+	if err == ErrNoTOTPEnrollment || err == ErrInvalidTOTPCode {
+		c.AbortWithStatus(http.StatusBadRequest)
+		return
+	} else if err != nil {
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"recoveryCodes": recoveryCodes})
+}
+
+// TOTPDELETE disables TOTP.
+// requires the user password in the Secret header
+func TOTPDELETE(c *gin.Context) {
+	store := c.MustGet("store").(Store)
+	ctx := c.Request.Context()
+	user := c.MustGet("user").(*User)
+	secret := c.GetHeader("Secret")
+
+	// check secret
+	if !user.CheckPassword(ctx, store, secret) {
+		c.JSON(http.StatusUnauthorized, nil)
+		return
+	}
+
+	if err := store.DisableTOTP(ctx, user); err != nil {
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	c.Status(http.StatusOK)
+}
+
+// TOTPRecoveryCodesPOST replaces the recovery codes and responds with the new ones.
+// requires the user password in the Secret header
+func TOTPRecoveryCodesPOST(c *gin.Context) {
+	store := c.MustGet("store").(Store)
+	ctx := c.Request.Context()
+	user := c.MustGet("user").(*User)
+	secret := c.GetHeader("Secret")
+
+	// check secret
+	if !user.CheckPassword(ctx, store, secret) {
+		c.JSON(http.StatusUnauthorized, nil)
+		return
+	}
+
+	hasTOTP, err := user.HasTOTP(ctx, store)
+	if err != nil {
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	} else if !hasTOTP {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+
+	recoveryCodes, err := user.RegenerateRecoveryCodes(ctx, store)
+	if err != nil {
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"recoveryCodes": recoveryCodes})
+}
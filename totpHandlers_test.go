@@ -0,0 +1,145 @@
+package main
+
+import (
+	"github.com/gin-gonic/gin"
+
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// totpFailingStore fails to read and write TOTP settings once fail is set
+type totpFailingStore struct {
+	Store
+
+	fail bool
+}
+
+func (store *totpFailingStore) GetTOTPSettings(ctx context.Context, u *User) (*TOTPSettings, error) {
+	if store.fail {
+		return nil, errTestWrite
+	}
+	return store.Store.GetTOTPSettings(ctx, u)
+}
+
+func (store *totpFailingStore) UpdateTOTPSecret(ctx context.Context, u *User, secret string) (bool, error) {
+	if store.fail {
+		return false, errTestWrite
+	}
+	return store.Store.UpdateTOTPSecret(ctx, u, secret)
+}
+
+// testTOTPRequest posts to the TOTP routes of alice with her password
+func testTOTPRequest(r http.Handler, path, token string, body interface{}) *httptest.ResponseRecorder {
+	req := newTestRequest(http.MethodPost, "/users/alice/totp"+path, token, body)
+	req.Header.Set("Secret", testPassword)
+	return serve(r, req)
+}
+
+func TestTOTPPOSTErrors(t *testing.T) {
+	store := &totpFailingStore{Store: NewMemoryStore()}
+	r := NewRouter(store, NewRoomHub())
+	testSignUp(t, r, "alice")
+	alice := testLogIn(t, r, "alice", "basic").AccessToken
+
+	// confirming requires a pending enrollment and a valid code
+	if code := testTOTPRequest(r, "/confirm", alice, gin.H{"code": "000000"}).Code; code != http.StatusBadRequest {
+		t.Errorf("confirm without enrollment: status %d, want %d", code, http.StatusBadRequest)
+	}
+	w := testTOTPRequest(r, "", alice, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("enroll: status %d", w.Code)
+	}
+	var enrollment struct{ Secret string }
+	decodeJSON(t, w, &enrollment)
+	wrong, _ := TOTPCode(enrollment.Secret, TOTPStep(time.Now())+10)
+	if code := testTOTPRequest(r, "/confirm", alice, gin.H{"code": wrong}).Code; code != http.StatusBadRequest {
+		t.Errorf("confirm with a wrong code: status %d, want %d", code, http.StatusBadRequest)
+	}
+
+	// store failures are not the client’s fault
+	store.fail = true
+	if code := testTOTPRequest(r, "", alice, nil).Code; code != http.StatusInternalServerError {
+		t.Errorf("enroll with a failing store: status %d, want %d", code, http.StatusInternalServerError)
+	}
+	if code := testTOTPRequest(r, "/confirm", alice, gin.H{"code": wrong}).Code; code != http.StatusInternalServerError {
+		t.Errorf("confirm with a failing store: status %d, want %d", code, http.StatusInternalServerError)
+	}
+	store.fail = false
+
+	// enrolling again once enabled conflicts
+	current, _ := TOTPCode(enrollment.Secret, TOTPStep(time.Now()))
+	if code := testTOTPRequest(r, "/confirm", alice, gin.H{"code": current}).Code; code != http.StatusOK {
+		t.Fatalf("confirm: status %d", code)
+	}
+	if code := testTOTPRequest(r, "", alice, nil).Code; code != http.StatusConflict {
+		t.Errorf("enroll when enabled: status %d, want %d", code, http.StatusConflict)
+	}
+}
+
+func TestAuthMFAPOST(t *testing.T) {
+	r := NewRouter(NewMemoryStore(), NewRoomHub())
+	testSignUp(t, r, "alice")
+	alice := testLogIn(t, r, "alice", "basic").AccessToken
+
+	// enroll and confirm with the code of the current step
+	w := testTOTPRequest(r, "", alice, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("enroll: status %d", w.Code)
+	}
+	var enrollment struct{ Secret string }
+	decodeJSON(t, w, &enrollment)
+	step := TOTPStep(time.Now())
+	current, _ := TOTPCode(enrollment.Secret, step)
+	w = testTOTPRequest(r, "/confirm", alice, gin.H{"code": current})
+	if w.Code != http.StatusOK {
+		t.Fatalf("confirm: status %d", w.Code)
+	}
+	var confirmation struct{ RecoveryCodes []string }
+	decodeJSON(t, w, &confirmation)
+	if len(confirmation.RecoveryCodes) != recoveryCodesCount {
+		t.Fatalf("%d recovery codes, want %d", len(confirmation.RecoveryCodes), recoveryCodesCount)
+	}
+
+	// secondFactor logs alice in with her password then the second factor
+	secondFactor := func(body gin.H) int {
+		t.Helper()
+		w := testRequest(r, http.MethodPost, "/auth/", "", gin.H{"username": "alice", "password": testPassword, "scope": "basic"})
+		var pending struct {
+			MFARequired bool
+			MFAToken    string
+		}
+		decodeJSON(t, w, &pending)
+		if w.Code != http.StatusOK || !pending.MFARequired {
+			t.Fatalf("log in: status %d, mfa required %v", w.Code, pending.MFARequired)
+		}
+		body["mfaToken"] = pending.MFAToken
+		return testRequest(r, http.MethodPost, "/auth/mfa", "", body).Code
+	}
+
+	// a code cannot be replayed, nor an earlier one used after it
+	if code := secondFactor(gin.H{"code": current}); code != http.StatusUnauthorized {
+		t.Errorf("replayed confirmation code: status %d, want %d", code, http.StatusUnauthorized)
+	}
+	next, _ := TOTPCode(enrollment.Secret, step+1)
+	if code := secondFactor(gin.H{"code": next}); code != http.StatusOK {
+		t.Errorf("next code: status %d, want %d", code, http.StatusOK)
+	}
+	if code := secondFactor(gin.H{"code": next}); code != http.StatusUnauthorized {
+		t.Errorf("replayed code: status %d, want %d", code, http.StatusUnauthorized)
+	}
+
+	// recovery codes are single-use
+	recoveryCode := confirmation.RecoveryCodes[0]
+	if code := secondFactor(gin.H{"recoveryCode": recoveryCode}); code != http.StatusOK {
+		t.Errorf("recovery code: status %d, want %d", code, http.StatusOK)
+	}
+	if code := secondFactor(gin.H{"recoveryCode": recoveryCode}); code != http.StatusUnauthorized {
+		t.Errorf("reused recovery code: status %d, want %d", code, http.StatusUnauthorized)
+	}
+	if code := secondFactor(gin.H{"recoveryCode": confirmation.RecoveryCodes[1]}); code != http.StatusOK {
+		t.Errorf("other recovery code: status %d, want %d", code, http.StatusOK)
+	}
+}
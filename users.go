@@ -1,12 +1,8 @@
 package main
 
 import (
-	"github.com/jmoiron/sqlx"
-	_ "github.com/lib/pq"
-
-	"crypto/sha256"
-	"fmt"
-	"time"
+	"context"
+	"log"
 )
 
 // User holds the ID, username and projects of a user, but NOT their credentials
@@ -17,129 +13,163 @@ type User struct {
 	// Username the user connection string
 	Username string `db:"username" json:"username"`
 
+	// Email the user email address, empty if none, never public
+	Email string `db:"email" json:"-"`
+
+	// EmailVerified whether the user proved they own their email address
+	EmailVerified bool `db:"email_verified" json:"-"`
+
+	// Timezone the IANA name of the time zone the user’s days are counted in
+	Timezone string `db:"timezone" json:"timezone"`
+
+	// Locale the BCP 47 tag of the user’s language and region, for clients to render dates and numbers
+	Locale string `db:"locale" json:"locale"`
+
 	// Projects the user’s projects
 	Projects []*Project `json:"projects"`
 }
 
 // NewUser registers a new user in the database and returns it, alongide a potential error
-func NewUser(username, password string) (*User, error) {
-	db, err := sqlx.Open("postgres", connStr)
+func NewUser(ctx context.Context, store Store, username, password string) (*User, error) {
+	passwordHash, err := passwordHasher.Hash(password)
 	if err != nil {
 		return nil, err
 	}
-	defer db.Close()
-
-	u := &User{
-		Username: username,
-	}
 
-	passwordSalt := GenerateSalt(username, password)
-	passwordHash := HashPassword(password, passwordSalt)
-
-	row := db.QueryRowx(`insert into autochrone.users
-		(username, password_hash, password_salt)
-		values ($1, $2, $3) returning id`, u.Username, passwordHash, passwordSalt)
-	if err := row.Err(); err != nil {
-		return nil, err
-	}
+	var u *User
+	err = store.Transaction(ctx, func(tx Store) error {
+		u, err = tx.InsertUser(ctx, username, passwordHash)
+		if err != nil {
+			return err
+		}
 
-	if err := row.Scan(&u.ID); err != nil {
+		// new users are writers
+		role, err := tx.GetRoleByName(ctx, "writer")
+		if err != nil {
+			return err
+		}
+		return tx.AddUserRole(ctx, u, role)
+	})
+	if err != nil {
 		return nil, err
 	}
 
 	return u, nil
 }
 
-// GenerateSalt generates a long string used as a salt for a user’s password
-func GenerateSalt(username, password string) string {
-	return fmt.Sprintf("%x", sha256.Sum256([]byte(fmt.Sprintf("%s--autochrone--%s--autochrone--%s", username, time.Now().Format(time.RFC3339Nano), password))))
+// CheckPassword returns true if given password is correct, false otherwise
+func (u *User) CheckPassword(ctx context.Context, store Store, password string) bool {
+	ok, _ := u.checkPassword(ctx, store, password)
+	return ok
 }
 
-// HashPassword hashes the password with the salt
-func HashPassword(password, passwordSalt string) string {
-	return fmt.Sprintf("%x", sha256.Sum256([]byte(fmt.Sprintf("%s--autochrone--%s--autochrone--%s", password, passwordSalt, password))))
+// CheckPasswordAndRehash returns true if given password is correct, false otherwise.
+// On success, a legacy or outdated password hash is replaced with one from the current hasher.
+func (u *User) CheckPasswordAndRehash(ctx context.Context, store Store, password string) bool {
+	ok, needsRehash := u.checkPassword(ctx, store, password)
+	if ok && needsRehash {
+		if err := u.setPasswordHash(ctx, store, password); err != nil {
+			log.Printf("could not rehash password for user %q: %v", u.Username, err)
+		}
+	}
+	return ok
 }
 
-// CheckPassword returns true if given password is correct, false otherwise
-func (u *User) CheckPassword(password string) bool {
-	db, err := sqlx.Open("postgres", connStr)
+// checkPassword verifies the password and tells whether its hash needs to be upgraded
+func (u *User) checkPassword(ctx context.Context, store Store, password string) (ok, needsRehash bool) {
+	passwordHash, passwordSalt, err := store.GetPasswordHash(ctx, u)
 	if err != nil {
-		return false
+		return false, false
 	}
-	defer db.Close()
 
-	row := db.QueryRowx("select password_hash, password_salt from autochrone.users where username = $1", u.Username)
-	if err := row.Err(); err != nil {
-		return false
+	// legacy hashes are the only ones stored with a separate salt
+	if passwordSalt != "" {
+		return VerifyLegacyPassword(password, passwordHash, passwordSalt), true
 	}
 
-	var passwordHash, passwordSalt string
-	if err := row.Scan(&passwordHash, &passwordSalt); err != nil {
-		return false
-	}
-
-	if passwordHash != HashPassword(password, passwordSalt) {
-		return false
+	ok, needsRehash, err = VerifyPassword(password, passwordHash)
+	if err != nil {
+		return false, false
 	}
-
-	return true
+	return ok, needsRehash
 }
 
-// UpdatePassword sets a new password in the database for the given user, returns nil on success, an error otherwise
-func (u *User) UpdatePassword(password string) error {
-	db, err := sqlx.Open("postgres", connStr)
+// setPasswordHash hashes the password with the current hasher and stores it
+func (u *User) setPasswordHash(ctx context.Context, store Store, password string) error {
+	passwordHash, err := passwordHasher.Hash(password)
 	if err != nil {
 		return err
 	}
-	defer db.Close()
 
-	passwordSalt := GenerateSalt(u.Username, password)
-	passwordHash := HashPassword(password, passwordSalt)
-	_, err = db.Queryx("update autochrone.users set (password_salt, password_hash) = ($1, $2) where id = $3", passwordSalt, passwordHash, u.ID)
-	if err != nil {
-		return err
-	}
+	return store.UpdatePasswordHash(ctx, u, passwordHash)
+}
 
-	_, err = db.Queryx("delete from autochrone.access_tokens where user_id = $1", u.ID)
-	return err
+// UpdatePassword sets a new password in the database for the given user and revokes all of their tokens,
+// returns nil on success, an error otherwise
+func (u *User) UpdatePassword(ctx context.Context, store Store, password string) error {
+	return store.Transaction(ctx, func(tx Store) error {
+		if err := u.setPasswordHash(ctx, tx, password); err != nil {
+			return err
+		}
+
+		if err := tx.DeleteUserTokens(ctx, u); err != nil {
+			return err
+		}
+
+		return tx.DeleteUserPersonalAccessTokens(ctx, u)
+	})
 }
 
-// UserExistsWithUsername returns true if a user could be found with such username, otherwise false
-func UserExistsWithUsername(username string) bool {
-	db, err := sqlx.Open("postgres", connStr)
-	if err != nil {
-		return false
+// InsertUser inserts a new user with the given password hash and returns it, alongside a potential error
+func (store *PostgresStore) InsertUser(ctx context.Context, username, passwordHash string) (*User, error) {
+	u := &User{
+		Username: username,
 	}
-	defer db.Close()
 
-	row := db.QueryRowx("select true from autochrone.users where username = $1", username)
+	row := store.db.QueryRowxContext(ctx, `insert into autochrone.users
+		(username, password_hash)
+		values ($1, $2) returning id, timezone, locale`, u.Username, passwordHash)
 	if err := row.Err(); err != nil {
-		return false
+		return nil, err
 	}
 
-	var found bool
-	if err := row.Scan(&found); err != nil {
-		return false
+	if err := row.Scan(&u.ID, &u.Timezone, &u.Locale); err != nil {
+		return nil, err
 	}
 
-	return found
+	return u, nil
 }
 
-// UserExistsWithID returns true if a user could be found with such ID, otherwise false
-func UserExistsWithID(id int) bool {
-	db, err := sqlx.Open("postgres", connStr)
-	if err != nil {
-		return false
+// GetPasswordHash returns the password hash of the user, and its salt for legacy hashes
+func (store *PostgresStore) GetPasswordHash(ctx context.Context, u *User) (passwordHash, passwordSalt string, err error) {
+	row := store.db.QueryRowxContext(ctx, "select password_hash, password_salt from autochrone.users where id = $1", u.ID)
+	if err := row.Scan(&passwordHash, &passwordSalt); err != nil {
+		return "", "", err
 	}
-	defer db.Close()
 
-	row := db.QueryRowx("select true from autochrone.users where id = $1", id)
-	if err := row.Err(); err != nil {
+	return passwordHash, passwordSalt, nil
+}
+
+// UpdatePasswordHash replaces the password hash of the user, dropping any legacy salt
+func (store *PostgresStore) UpdatePasswordHash(ctx context.Context, u *User, passwordHash string) error {
+	_, err := store.db.ExecContext(ctx, "update autochrone.users set (password_hash, password_salt) = ($1, '') where id = $2", passwordHash, u.ID)
+	return err
+}
+
+// UserExistsWithUsername returns true if a user could be found with such username, otherwise false
+func (store *PostgresStore) UserExistsWithUsername(ctx context.Context, username string) bool {
+	var found bool
+	if err := store.db.GetContext(ctx, &found, "select true from autochrone.users where username = $1", username); err != nil {
 		return false
 	}
 
+	return found
+}
+
+// UserExistsWithID returns true if a user could be found with such ID, otherwise false
+func (store *PostgresStore) UserExistsWithID(ctx context.Context, id int) bool {
 	var found bool
-	if err := row.Scan(&found); err != nil {
+	if err := store.db.GetContext(ctx, &found, "select true from autochrone.users where id = $1", id); err != nil {
 		return false
 	}
 
@@ -147,15 +177,9 @@ func UserExistsWithID(id int) bool {
 }
 
 // GetUserByUsername returns the user with given username and a potential an error
-func GetUserByUsername(username string) (*User, error) {
-	db, err := sqlx.Open("postgres", connStr)
-	if err != nil {
-		return nil, err
-	}
-	defer db.Close()
-
+func (store *PostgresStore) GetUserByUsername(ctx context.Context, username string) (*User, error) {
 	u := &User{}
-	err = db.Get(u, "select id, username from autochrone.users where username = $1", username)
+	err := store.db.GetContext(ctx, u, "select id, username, email, email_verified, timezone, locale from autochrone.users where username = $1", username)
 	if err != nil {
 		return nil, err
 	}
@@ -164,15 +188,9 @@ func GetUserByUsername(username string) (*User, error) {
 }
 
 // GetUserByID returns the user with given ID and a potential error
-func GetUserByID(id int) (*User, error) {
-	db, err := sqlx.Open("postgres", connStr)
-	if err != nil {
-		return nil, err
-	}
-	defer db.Close()
-
+func (store *PostgresStore) GetUserByID(ctx context.Context, id int) (*User, error) {
 	u := &User{}
-	err = db.Get(u, "select id, username from autochrone.users where id = $1", id)
+	err := store.db.GetContext(ctx, u, "select id, username, email, email_verified, timezone, locale from autochrone.users where id = $1", id)
 	if err != nil {
 		return nil, err
 	}
@@ -181,41 +199,17 @@ func GetUserByID(id int) (*User, error) {
 }
 
 // GetUsers returns several users
-func GetUsers() ([]*User, error) {
-	db, err := sqlx.Open("postgres", connStr)
-	if err != nil {
-		return nil, err
-	}
-	defer db.Close()
-
-	rows, err := db.Queryx("select id, username from autochrone.users")
-	if err != nil {
-		return nil, err
-	}
-
+func (store *PostgresStore) GetUsers(ctx context.Context) ([]*User, error) {
 	users := []*User{}
-	for rows.Next() {
-		u := &User{}
-		if err := rows.StructScan(u); err != nil {
-			return nil, err
-		}
-		users = append(users, u)
+	if err := store.db.SelectContext(ctx, &users, "select id, username, email, email_verified, timezone, locale from autochrone.users"); err != nil {
+		return nil, err
 	}
 
 	return users, nil
 }
 
 // DeleteUser deletes a user from the database
-func DeleteUser(user *User) error {
-	db, err := sqlx.Open("postgres", connStr)
-	if err != nil {
-		return err
-	}
-	defer db.Close()
-
-	if _, err := db.Queryx("delete from autochrone.users where id = $1", user.ID); err != nil {
-		return err
-	}
-
-	return nil
+func (store *PostgresStore) DeleteUser(ctx context.Context, user *User) error {
+	_, err := store.db.ExecContext(ctx, "delete from autochrone.users where id = $1", user.ID)
+	return err
 }
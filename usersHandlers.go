@@ -5,12 +5,15 @@ import (
 
 	"encoding/json"
 	"fmt"
+	"log"
 	"net/http"
 )
 
 // UsersGET sends users as JSON
 func UsersGET(c *gin.Context) {
-	users, err := GetUsers()
+	store := c.MustGet("store").(Store)
+	ctx := c.Request.Context()
+	users, err := store.GetUsers(ctx)
 	if err != nil {
 		c.JSON(http.StatusNotFound, nil)
 		return
@@ -25,10 +28,14 @@ type UsersPOSTRequest struct {
 	Username string `json:"username"`
 	Password string `json:"password"`
 	Confirm  string `json:"confirm"`
+	// Email optional email address, a verification link is sent to it
+	Email string `json:"email"`
 }
 
 // UsersPOST registers new user
 func UsersPOST(c *gin.Context) {
+	store := c.MustGet("store").(Store)
+	ctx := c.Request.Context()
 	req := &UsersPOSTRequest{}
 	if err := c.BindJSON(req); err != nil {
 		return
@@ -39,14 +46,38 @@ func UsersPOST(c *gin.Context) {
 		c.JSON(http.StatusUnauthorized, nil)
 		return
 	}
+	if req.Email != "" && !ValidEmail(req.Email) {
+		c.JSON(http.StatusBadRequest, nil)
+		return
+	}
 
-	// register user
-	user, err := NewUser(req.Username, req.Password)
-	if err != nil {
+	// register user with their email, or not at all
+	var user *User
+	err := store.Transaction(ctx, func(tx Store) error {
+		var err error
+		if user, err = NewUser(ctx, tx, req.Username, req.Password); err != nil {
+			return err
+		}
+		if req.Email != "" {
+			return user.UpdateEmail(ctx, tx, req.Email)
+		}
+		return nil
+	})
+	if err == ErrEmailTaken {
+		c.JSON(http.StatusConflict, nil)
+		return
+	} else if err != nil {
 		c.JSON(http.StatusInternalServerError, nil)
 		return
 	}
 
+	// send verification link
+	if req.Email != "" {
+		if err := user.SendVerificationEmail(ctx, store); err != nil {
+			log.Printf("could not send verification email to user %q: %v", user.Username, err)
+		}
+	}
+
 	// Respond with new user location in the api
 	c.Header("Location", fmt.Sprintf("/users/%v", user.Username))
 	c.JSON(http.StatusCreated, nil)
@@ -69,6 +100,8 @@ type UsersUsernamePATCHRequest struct {
 // UsersUsernamePATCH updates a user
 // requires a UsersUsernamePATCHRequest as JSON
 func UsersUsernamePATCH(c *gin.Context) {
+	store := c.MustGet("store").(Store)
+	ctx := c.Request.Context()
 	user := c.MustGet("user").(*User)
 	req := &UsersUsernamePATCHRequest{}
 	if err := c.BindJSON(req); err != nil {
@@ -82,7 +115,7 @@ func UsersUsernamePATCH(c *gin.Context) {
 	case "set":
 		switch req.Path {
 		case "password":
-			if !user.CheckPassword(secret) {
+			if !user.CheckPassword(ctx, store, secret) {
 				c.JSON(http.StatusUnauthorized, nil)
 				return
 			}
@@ -90,7 +123,45 @@ func UsersUsernamePATCH(c *gin.Context) {
 				c.JSON(http.StatusBadRequest, nil)
 				return
 			}
-			if err := user.UpdatePassword(req.Value); err != nil {
+			if err := user.UpdatePassword(ctx, store, req.Value); err != nil {
+				c.JSON(http.StatusInternalServerError, nil)
+				return
+			}
+		case "email":
+			if !user.CheckPassword(ctx, store, secret) {
+				c.JSON(http.StatusUnauthorized, nil)
+				return
+			}
+			if req.Value != "" && !ValidEmail(req.Value) {
+				c.JSON(http.StatusBadRequest, nil)
+				return
+			}
+			if err := user.UpdateEmail(ctx, store, req.Value); err == ErrEmailTaken {
+				c.JSON(http.StatusConflict, nil)
+				return
+			} else if err != nil {
+				c.JSON(http.StatusInternalServerError, nil)
+				return
+			}
+			if req.Value != "" {
+				if err := user.SendVerificationEmail(ctx, store); err != nil {
+					c.JSON(http.StatusInternalServerError, nil)
+					return
+				}
+			}
+		case "timezone":
+			if err := user.SetTimezone(ctx, store, req.Value); err == ErrInvalidTimezone {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			} else if err != nil {
+				c.JSON(http.StatusInternalServerError, nil)
+				return
+			}
+		case "locale":
+			if err := user.SetLocale(ctx, store, req.Value); err == ErrInvalidLocale {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			} else if err != nil {
 				c.JSON(http.StatusInternalServerError, nil)
 				return
 			}
@@ -108,17 +179,19 @@ func UsersUsernamePATCH(c *gin.Context) {
 
 // UsersUsernameDELETE deletes a user
 func UsersUsernameDELETE(c *gin.Context) {
+	store := c.MustGet("store").(Store)
+	ctx := c.Request.Context()
 	user := c.MustGet("user").(*User)
 	secret := c.GetHeader("Secret")
 
 	// check secret
-	if !user.CheckPassword(secret) {
+	if !user.CheckPassword(ctx, store, secret) {
 		c.JSON(http.StatusUnauthorized, nil)
 		return
 	}
 
 	// delete user
-	if err := DeleteUser(user); err != nil {
+	if err := store.DeleteUser(ctx, user); err != nil {
 		c.JSON(http.StatusInternalServerError, nil)
 		return
 	}
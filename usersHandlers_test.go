@@ -0,0 +1,126 @@
+package main
+
+import (
+	"github.com/gin-gonic/gin"
+
+	"context"
+	"net/http"
+	"regexp"
+	"testing"
+)
+
+func TestUsersPOSTEmail(t *testing.T) {
+	r := NewRouter(NewMemoryStore(), NewRoomHub())
+
+	signUp := func(username, email string) int {
+		return testRequest(r, http.MethodPost, "/users/", "", gin.H{"username": username, "password": testPassword, "confirm": testPassword, "email": email}).Code
+	}
+
+	if code := signUp("alice", "alice@example.com"); code != http.StatusCreated {
+		t.Fatalf("sign up alice: status %d", code)
+	}
+	if code := testRequest(r, http.MethodPost, "/auth/verify-email", "", gin.H{"token": testEmailToken(t, "alice@example.com")}).Code; code != http.StatusOK {
+		t.Fatalf("verify alice: status %d", code)
+	}
+
+	// a verified address fails the whole sign up, so that it can be retried
+	if code := signUp("bob", "Alice@example.com"); code != http.StatusConflict {
+		t.Errorf("sign up with a verified email: status %d, want %d", code, http.StatusConflict)
+	}
+	if code := testRequest(r, http.MethodGet, "/users/bob", "", nil).Code; code != http.StatusNotFound {
+		t.Errorf("user of the failed sign up: status %d, want %d", code, http.StatusNotFound)
+	}
+	if code := signUp("bob", "bob@example.com"); code != http.StatusCreated {
+		t.Errorf("retried sign up: status %d, want %d", code, http.StatusCreated)
+	}
+}
+
+func TestVerifyEmailConflict(t *testing.T) {
+	store := NewMemoryStore()
+	r := NewRouter(store, NewRoomHub())
+
+	signUp := func(username string) {
+		t.Helper()
+		w := testRequest(r, http.MethodPost, "/users/", "", gin.H{"username": username, "password": testPassword, "confirm": testPassword, "email": "carol@example.com"})
+		if w.Code != http.StatusCreated {
+			t.Fatalf("sign up %s: status %d", username, w.Code)
+		}
+	}
+
+	// anyone may claim an address until its owner verifies it
+	signUp("mallory")
+	mallory := testEmailToken(t, "carol@example.com")
+	signUp("carol")
+	carol := testEmailToken(t, "carol@example.com")
+
+	if code := testRequest(r, http.MethodPost, "/auth/verify-email", "", gin.H{"token": carol}).Code; code != http.StatusOK {
+		t.Fatalf("verify carol: status %d", code)
+	}
+	u, err := store.GetUserByUsername(context.Background(), "mallory")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Email != "" {
+		t.Errorf("unverified claim %q kept once verified by its owner", u.Email)
+	}
+	if code := testRequest(r, http.MethodPost, "/auth/verify-email", "", gin.H{"token": mallory}).Code; code != http.StatusUnauthorized {
+		t.Errorf("verify the claim: status %d, want %d", code, http.StatusUnauthorized)
+	}
+}
+
+// testEmailToken returns the token of the last email sent to the address
+func testEmailToken(t *testing.T, to string) string {
+	t.Helper()
+	messages := mailer.(*MemoryMailer).Messages()
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].To == to {
+			if m := regexp.MustCompile(`token=([0-9a-f]+)`).FindStringSubmatch(messages[i].Body); m != nil {
+				return m[1]
+			}
+		}
+	}
+	t.Fatalf("no token sent to %s", to)
+	return ""
+}
+
+func TestUsersUsernamePATCHPreferences(t *testing.T) {
+	r := NewRouter(NewMemoryStore(), NewRoomHub())
+	testSignUp(t, r, "alice")
+	alice := testLogIn(t, r, "alice", "basic").AccessToken
+
+	getUser := func() *User {
+		t.Helper()
+		w := testRequest(r, http.MethodGet, "/users/alice", "", nil)
+		if w.Code != http.StatusOK {
+			t.Fatalf("get user: status %d", w.Code)
+		}
+		u := &User{}
+		decodeJSON(t, w, u)
+		return u
+	}
+	if u := getUser(); u.Timezone != defaultTimezone || u.Locale != defaultLocale {
+		t.Errorf("new user time zone %q, locale %q, want %q, %q", u.Timezone, u.Locale, defaultTimezone, defaultLocale)
+	}
+
+	for _, tc := range []struct {
+		path  string
+		value string
+		want  int
+	}{
+		{"timezone", "America/New_York", http.StatusOK},
+		{"timezone", "Local", http.StatusBadRequest},
+		{"timezone", "Eastern", http.StatusBadRequest},
+		{"locale", "fr-fr", http.StatusOK},
+		{"locale", "not a locale", http.StatusBadRequest},
+	} {
+		w := testRequest(r, http.MethodPatch, "/users/alice", alice, gin.H{"operator": "set", "path": tc.path, "value": tc.value})
+		if w.Code != tc.want {
+			t.Errorf("set %s to %q: status %d, want %d", tc.path, tc.value, w.Code, tc.want)
+		}
+	}
+
+	// invalid values are not saved and locales are canonical
+	if u := getUser(); u.Timezone != "America/New_York" || u.Locale != "fr-FR" {
+		t.Errorf("time zone %q, locale %q, want %q, %q", u.Timezone, u.Locale, "America/New_York", "fr-FR")
+	}
+}